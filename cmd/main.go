@@ -1,9 +1,18 @@
 package cmd
 
 import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/prometheus/client_golang/prometheus"
@@ -15,12 +24,24 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// shutdownTimeout is how long in-flight requests may take on shutdown
+const shutdownTimeout = 5 * time.Second
+
 var (
-	configFile             = kingpin.Flag("config.file", "Configuration file for prusa_exporter.").Default("./prusa.yml").ExistingFile()
+	configFile             = kingpin.Flag("config.file", "Configuration file for prusa_exporter, - reads it from stdin, http(s) URL fetches it from the server.").Default("./prusa.yml").String()
+	dryRun                 = kingpin.Flag("dry-run", "Validate configuration and print UDP metrics gcode and labels of printers without contacting them.").Default("false").Bool()
 	metricsPath            = kingpin.Flag("exporter.metrics-path", "Path where to expose Prusa Link metrics.").Default("/metrics/prusalink").String()
 	udpMetricsPath         = kingpin.Flag("exporter.udp-metrics-path", "Path where to expose udp metrics.").Default("/metrics/udp").String()
+	combinedMetricsPath    = kingpin.Flag("exporter.combined-metrics-path", "Path where to expose Prusa Link and udp metrics together. Empty disables it.").Default("/metrics").String()
 	metricsPort            = kingpin.Flag("exporter.metrics-port", "Port where to expose metrics.").Default("10009").Int()
+	maintenanceToken       = kingpin.Flag("web.maintenance-token", "Bearer token required by /maintenance endpoint, which changes state of the exporter. Empty disables the endpoint.").Default("").String()
+	webUnixSocket          = kingpin.Flag("web.unix-socket", "Path of unix socket where to expose metrics in addition to the port. Socket file is removed on shutdown.").Default("").String()
 	prusaLinkScrapeTimeout = kingpin.Flag("prusalink.scrape-timeout", "Timeout in seconds to scrape prusalink metrics.").Default("10").Int()
+	prusaLinkLengthUnit    = kingpin.Flag("prusalink.length-unit", "Unit of length based prusalink metrics - legacy, meters or millimeters. Legacy keeps nozzle size and axis in millimeters as reported before.").Default(prusalink.LengthUnitLegacy).Enum(prusalink.LengthUnitLegacy, prusalink.LengthUnitMeters, prusalink.LengthUnitMillimeters)
+	prusaLinkStripPort     = kingpin.Flag("prusalink.strip-address-port", "Strip port from printer_address label of prusalink metrics, requests still use the port.").Default("false").Bool()
+	prusaLinkPrefix        = kingpin.Flag("prusalink.prefix", "Prefix of prusalink metric names.").Default(prusalink.DefaultMetricPrefix).String()
+	prusaLinkMaxScrapes    = kingpin.Flag("prusalink.max-concurrent-scrapes", "Maximum number of printers scraped concurrently. 0 means unlimited.").Default("16").Int()
+	httpUserAgent          = kingpin.Flag("http.user-agent", "User-Agent header of requests to printers.").Default(prusalink.DefaultUserAgent).String()
 	logLevel               = kingpin.Flag("log.level", "Log level for zerolog.").Default("info").String()
 	udpIPOverride          = kingpin.Flag("udp.ip-override", "Override the IP address of the server with this value.").Default("").String()
 	syslogListenAddress    = kingpin.Flag("udp.listen-address", "Address where to expose port for gathering metrics. - format <address>:<port>").Default("0.0.0.0:8514").String()
@@ -28,9 +49,27 @@ var (
 	udpExtraMetrics        = kingpin.Flag("udp.extra-metrics", "Comma separated list of extra udp metrics to expose.").Default("").String()
 	udpAllMetrics          = kingpin.Flag("udp.all-metrics", "Expose all udp metrics. SEVERELY IMPACT CPU CAPABILITIES OF THE PRINTER! - default false").Default("false").Bool()
 	udpGcodeEnabled        = kingpin.Flag("udp.gcode-enabled", "Enable generating and sending metrics gcode. - default true").Default("true").Bool()
+	udpMaxConcurrentGcode  = kingpin.Flag("udp.max-concurrent-gcode", "Maximum number of printers receiving UDP metrics gcode concurrently. 0 means unlimited.").Default("4").Int()
+	udpStaleThreshold      = kingpin.Flag("udp.stale-threshold", "Enable UDP metrics again at printers that did not push metrics for this duration, e.g. after reboot. 0 disables it.").Default("0").Duration()
+	udpMACAllowlist        = kingpin.Flag("udp.mac-allowlist", "Comma separated list of printer MAC addresses whose udp metrics are accepted, others are dropped. Takes precedence over udp.mac-blocklist.").Default("").String()
+	udpMACBlocklist        = kingpin.Flag("udp.mac-blocklist", "Comma separated list of printer MAC addresses whose udp metrics are dropped.").Default("").String()
+	udpSourceTimestamps    = kingpin.Flag("udp.source-timestamps", "Expose udp samples with the timestamp sent by the printer instead of scrape time. - default false").Default("false").Bool()
+	udpMaxClockSkew        = kingpin.Flag("udp.max-clock-skew", "Source timestamps further than this from the exporter time are replaced by scrape time.").Default("5m").Duration()
+	udpExtraLabels         = kingpin.Flag("udp.extra-labels", "Comma separated list of key=value labels added to all udp metrics, e.g. site=garage.").Default("").String()
+	udpNormalizeNames      = kingpin.Flag("udp.normalize-names", "Append unit suffix (_celsius, _amperes, _volts, _rpm) to names of udp metrics with known unit. - default false").Default("false").Bool()
+	udpMetricMetadata      = kingpin.Flag("udp.metric-metadata", "Use curated metric types for known udp metrics, counters among them change type from gauge. - default false").Default("false").Bool()
 	udpRegistry            = prometheus.NewRegistry()
 	lokiEnabled            = kingpin.Flag("loki.enabled", "Enable pushing job images to loki.").Default("false").Bool()
 	lokiPushURL            = kingpin.Flag("loki.push-url", "Loki push URL to send job image to loki. If empty, image will not appear in dashboard.").Default("").String()
+	lokiUsername           = kingpin.Flag("loki.username", "Username for Loki basic auth. Overrides loki_username from configuration file.").Default("").String()
+	lokiPassword           = kingpin.Flag("loki.password", "Password for Loki basic auth. Overrides loki_password from configuration file.").Default("").String()
+	lokiTenant             = kingpin.Flag("loki.tenant", "Loki tenant sent as X-Scope-OrgID header. Overrides loki_tenant from configuration file.").Default("").String()
+	remoteWriteURL         = kingpin.Flag("remote-write.url", "Prometheus remote write URL where to push metrics, e.g. when Prometheus can not scrape the exporter. Credentials in URL are sent as basic auth.").Default("").String()
+	remoteWriteInterval    = kingpin.Flag("remote-write.interval", "Interval of pushing metrics to remote write URL.").Default("30s").Duration()
+	lokiCheckReady         = kingpin.Flag("loki.check-ready", "Check at startup that Loki behind loki.push-url is ready.").Default("false").Bool()
+	lokiImageSize          = kingpin.Flag("loki.image-size", "Size of the job thumbnail pushed to Loki - small or large. Large falls back to small if the printer does not provide it.").Default(prusalink.ImageSizeLarge).Enum(prusalink.ImageSizeSmall, prusalink.ImageSizeLarge)
+	lokiImageTimeout       = kingpin.Flag("loki.image-timeout", "Timeout in seconds to fetch job image from the printer, separate from prusalink.scrape-timeout as images can be large. 0 uses the timeout of other printer requests.").Default("60").Int()
+	lokiCompress           = kingpin.Flag("loki.compress", "Gzip job images pushed to Loki. Enables loki_compress from configuration file.").Default("false").Bool()
 )
 
 // Run function to start the exporter
@@ -42,7 +81,7 @@ func Run() {
 		log.Panic().Msg("udp_metrics_path must be different from metrics_path")
 	}
 
-	if _, err := os.Stat(*configFile); os.IsNotExist(err) {
+	if _, err := os.Stat(*configFile); config.IsLocalFile(*configFile) && os.IsNotExist(err) {
 		log.Panic().Msg("Configuration file does not exist: " + *configFile)
 	}
 
@@ -54,6 +93,27 @@ func Run() {
 		log.Panic().Msg("Error loading configuration file " + err.Error())
 	}
 
+	if *lokiUsername != "" {
+		config.Exporter.LokiUsername = *lokiUsername
+	}
+	if *lokiPassword != "" {
+		config.Exporter.LokiPassword = *lokiPassword
+	}
+	if *lokiTenant != "" {
+		config.Exporter.LokiTenant = *lokiTenant
+	}
+	config.Exporter.LokiImageSize = *lokiImageSize
+	config.Exporter.ImageTimeout = *lokiImageTimeout
+	if *lokiCompress {
+		config.Exporter.LokiCompress = true
+	}
+	config.Exporter.MaxConcurrentGcode = *udpMaxConcurrentGcode
+	config.Exporter.UserAgent = *httpUserAgent
+	config.PrusaLink.LengthUnit = *prusaLinkLengthUnit
+	config.PrusaLink.MaxConcurrentScrapes = *prusaLinkMaxScrapes
+	config.PrusaLink.Prefix = *prusaLinkPrefix
+	config.PrusaLink.StripAddressPort = *prusaLinkStripPort
+
 	logLevel, err := zerolog.ParseLevel(*logLevel)
 
 	if err != nil {
@@ -61,36 +121,94 @@ func Run() {
 	}
 	zerolog.SetGlobalLevel(logLevel)
 
-	var collectors []prometheus.Collector
+	// flags are validated before printers are contacted, dry run included
+	extraLabels, err := parseLabels(*udpExtraLabels)
+	if err != nil {
+		log.Fatal().Msg("Invalid udp.extra-labels - " + err.Error())
+	}
+
+	if *dryRun {
+		if err := prusalink.DryRun(os.Stdout, config); err != nil {
+			log.Fatal().Msg("Dry run failed - " + err.Error())
+		}
+		log.Info().Msg("Dry run finished, configuration is valid")
+		return
+	}
+
+	if *lokiCheckReady {
+		for _, pushURL := range prusalink.LokiPushURLs(config) {
+			if err := prusalink.CheckLokiReady(context.Background(), pushURL); err != nil {
+				log.Warn().Msg("Loki readiness check of " + pushURL + " failed, job images may not be pushed - " + err.Error())
+			} else {
+				log.Info().Msg("Loki at " + pushURL + " is ready")
+			}
+		}
+	}
 
 	log.Info().Msg("PrusaLink metrics enabled!")
-	collectors = append(collectors, prusalink.NewCollector(config))
+	collector := prusalink.NewCollector(config)
 
 	if *udpGcodeEnabled {
 		prusalink.EnableUDPmetrics(config.Printers)
+		if *udpStaleThreshold > 0 {
+			go prusalink.WatchUDPMetrics(*udpStaleThreshold, udp.LastPush)
+		}
 	} else {
 		log.Warn().Msg("Not enabling UDP metrics, because gcode generation is disabled")
 	}
 	// starting syslog server
 
+	udp.Configure(udp.Settings{
+		NormalizeNames:   *udpNormalizeNames,
+		ExtraLabels:      extraLabels,
+		Metadata:         *udpMetricMetadata,
+		TagRenames:       config.UDP.TagRenames,
+		Materials:        config.UDP.Materials,
+		MACAllowlist:     splitList(*udpMACAllowlist),
+		MACBlocklist:     splitList(*udpMACBlocklist),
+		SourceTimestamps: *udpSourceTimestamps,
+		MaxClockSkew:     *udpMaxClockSkew,
+	})
+
 	log.Info().Msg("Syslog server starting at: " + *syslogListenAddress)
 	go udp.MetricsListener(*syslogListenAddress, *udpPrefix)
 	log.Info().Msg("Syslog server ready to receive metrics")
 
 	// registering the prometheus metrics
 
-	prometheus.MustRegister(collectors...)
+	// collector is served by its own handler to abort requests to printers when the scrape is abandoned,
+	// the registry is used only for remote write
+	prusaLinkRegistry := prometheus.NewRegistry()
+	prusaLinkRegistry.MustRegister(collector)
 	log.Info().Msg("Metrics registered")
-	http.Handle(*metricsPath, promhttp.Handler())
+	http.Handle(*metricsPath, promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, collector.Handler(prometheus.DefaultGatherer)))
 	log.Info().Msg("PrusaLink metrics initialized")
 
 	udp.Init(udpRegistry)
 
-	http.Handle(*udpMetricsPath, promhttp.HandlerFor(udpRegistry, promhttp.HandlerOpts{
-		Registry: udpRegistry,
-	}))
+	http.Handle(*udpMetricsPath, udpMetricsHandler(udpRegistry))
 	log.Info().Msg("UDP metrics initialized")
 
+	// link is rendered at root page only when the combined handler is registered
+	combinedMetricsLink := ""
+	if *combinedMetricsPath != "" && *combinedMetricsPath != *metricsPath && *combinedMetricsPath != *udpMetricsPath {
+		combinedMetricsLink = `<p><a href="` + *combinedMetricsPath + `">All metrics</a></p>`
+		http.Handle(*combinedMetricsPath, promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, combinedMetricsHandler(collector, udpRegistry)))
+		log.Info().Msg("Combined metrics initialized at " + *combinedMetricsPath)
+	}
+
+	if *remoteWriteURL != "" {
+		go runRemoteWrite(context.Background(), *remoteWriteURL, *remoteWriteInterval, prometheus.Gatherers{prometheus.DefaultGatherer, prusaLinkRegistry, udpRegistry})
+		log.Info().Msg("Pushing metrics to remote write endpoint every " + remoteWriteInterval.String())
+	}
+
+	if *maintenanceToken != "" {
+		http.Handle("/maintenance", requireToken(*maintenanceToken, http.HandlerFunc(prusalink.MaintenanceHandler)))
+		log.Info().Msg("Maintenance endpoint enabled")
+	}
+	http.HandleFunc("/udp-status", prusalink.UDPStatusHandler(udp.LastPush))
+	http.HandleFunc("/status.json", collector.StatusHandler())
+
 	log.Info().Msg("Listening at port: " + strconv.Itoa(*metricsPort))
 
 	// Handle job image requests and root path
@@ -102,11 +220,111 @@ func Run() {
 	<p>Syslog server running at - <b>` + *syslogListenAddress + `</b></p>
     <p><a href="` + *metricsPath + `">PrusaLink metrics</a></p>
 	<p><a href="` + *udpMetricsPath + `">UDP Metrics</a></p>
+	` + combinedMetricsLink + `
 	</body>
     </html>`
 		w.Write([]byte(html))
 	})
 
-	log.Fatal().Msg(http.ListenAndServe(":"+strconv.Itoa(*metricsPort), nil).Error())
+	servers := []*http.Server{{Addr: ":" + strconv.Itoa(*metricsPort)}}
+	go func() {
+		if err := servers[0].ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal().Msg(err.Error())
+		}
+	}()
+
+	if *webUnixSocket != "" {
+		listener, err := listenUnixSocket(*webUnixSocket)
+		if err != nil {
+			log.Fatal().Msg("Error listening at unix socket " + *webUnixSocket + " - " + err.Error())
+		}
+		socketServer := &http.Server{}
+		servers = append(servers, socketServer)
+		go func() {
+			if err := socketServer.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+				log.Error().Msg("Unix socket server stopped - " + err.Error())
+			}
+		}()
+		log.Info().Msg("Listening at unix socket: " + *webUnixSocket)
+	}
+
+	signals, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-signals.Done()
+
+	log.Info().Msg("Shutting down")
+	shutdownServers(servers, shutdownTimeout)
+}
+
+// udpMetricsHandler returns handler of udp metrics, OpenMetrics format is served if the scraper accepts it.
+// Units are not declared with # UNIT, promhttp does not write them, units are kept as metric name suffixes.
+func udpMetricsHandler(registry *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+		Registry:          registry,
+		EnableOpenMetrics: true,
+	})
+}
+
+// combinedMetricsHandler returns handler of Prusa Link and udp metrics together, so a single scrape job gets everything
+func combinedMetricsHandler(collector *prusalink.Collector, udpRegistry *prometheus.Registry) http.Handler {
+	return collector.Handler(prometheus.Gatherers{prometheus.DefaultGatherer, udpRegistry})
+}
+
+// listenUnixSocket listens at the unix socket, stale socket file left by previous run is removed
+func listenUnixSocket(path string) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// shutdownServers gracefully shuts down the servers, closing their listeners removes the unix socket file
+func shutdownServers(servers []*http.Server, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			log.Error().Msg("Error shutting down server - " + err.Error())
+		}
+	}
+}
+
+// requireToken rejects requests without the bearer token in Authorization header
+func requireToken(token string, next http.Handler) http.Handler {
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// parseLabels parses comma separated key=value pairs
+func parseLabels(list string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, pair := range splitList(list) {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("label %q is not in key=value format", pair)
+		}
+		labels[key] = strings.TrimSpace(value)
+	}
+	return labels, nil
+}
 
+// splitList returns non-empty trimmed items of a comma separated list
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
@@ -1,13 +1,21 @@
 package cmd
 
 import (
+	"context"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pstrobl96/prusa_exporter/config"
+	prusalink "github.com/pstrobl96/prusa_exporter/prusalink/buddy"
 )
 
 func TestMain(t *testing.T) {
@@ -296,3 +304,193 @@ func BenchmarkHTTPHandler(b *testing.B) {
 		handler.ServeHTTP(rr, req)
 	}
 }
+
+func TestRunDryRun(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+
+	configPath := filepath.Join(t.TempDir(), "prusa.yml")
+	printerConfig := `
+printers:
+  - address: "` + strings.TrimPrefix(server.URL, "http://") + `"
+    username: "test_user"
+    password: "test_pass"
+    name: "TestPrinter1"
+    type: "MK4"
+`
+	if err := os.WriteFile(configPath, []byte(printerConfig), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	origArgs := os.Args
+	defer func() { os.Args = origArgs }()
+	os.Args = []string{
+		"prusa_exporter",
+		"--config.file=" + configPath,
+		"--udp.ip-override=10.0.0.1",
+		"--dry-run",
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Run()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() with --dry-run did not return")
+	}
+
+	if count := requests.Load(); count != 0 {
+		t.Errorf("dry run made %d requests to the printer, expected 0", count)
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := parseLabels("site=garage, rack = 2,")
+	if err != nil {
+		t.Fatalf("parseLabels() error: %v", err)
+	}
+	if len(labels) != 2 || labels["site"] != "garage" || labels["rack"] != "2" {
+		t.Errorf("parseLabels() = %v, expected site=garage and rack=2", labels)
+	}
+
+	for _, invalid := range []string{"site", "=garage"} {
+		if _, err := parseLabels(invalid); err == nil {
+			t.Errorf("parseLabels(%q) expected error", invalid)
+		}
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	handler := requireToken("secret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for authorization, expected := range map[string]int{
+		"":              http.StatusUnauthorized,
+		"Bearer wrong":  http.StatusUnauthorized,
+		"secret":        http.StatusUnauthorized,
+		"Bearer secret": http.StatusNoContent,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/maintenance?address=192.168.1.100&duration=30m", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != expected {
+			t.Errorf("Authorization %q: status %d, expected %d", authorization, rr.Code, expected)
+		}
+	}
+}
+
+func TestUnixSocketListener(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "prusa_exporter.sock")
+
+	// stale socket file of previous run must not prevent listening
+	stale, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("net.Listen() error: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listener, err := listenUnixSocket(socketPath)
+	if err != nil {
+		t.Fatalf("listenUnixSocket() error: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics/prusalink", prusalink.NewCollector(config.Config{}).Handler(prometheus.NewRegistry()))
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+		},
+	}}
+	resp, err := client.Get("http://unix/metrics/prusalink")
+	if err != nil {
+		t.Fatalf("GET over unix socket error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "prusa_collections_total") {
+		t.Errorf("GET /metrics/prusalink = %d, expected 200 with prusalink metrics, got:\n%s", resp.StatusCode, body)
+	}
+
+	shutdownServers([]*http.Server{server}, time.Second)
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Errorf("socket file %s exists after server was shut down", socketPath)
+	}
+}
+
+func TestMetricsHandlersOpenMetrics(t *testing.T) {
+	udpRegistry := prometheus.NewRegistry()
+	udpRegistry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "prusa_temp_noz", Help: "test"}))
+
+	handlers := map[string]http.Handler{
+		"prusalink": prusalink.NewCollector(config.Config{}).Handler(prometheus.NewRegistry()),
+		"udp":       udpMetricsHandler(udpRegistry),
+	}
+
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			req.Header.Set("Accept", "application/openmetrics-text;version=1.0.0,text/plain;q=0.5")
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "application/openmetrics-text") {
+				t.Errorf("Content-Type = %q, expected OpenMetrics", contentType)
+			}
+			if !strings.HasSuffix(recorder.Body.String(), "# EOF\n") {
+				t.Errorf("response is not terminated by # EOF:\n%s", recorder.Body.String())
+			}
+
+			req = httptest.NewRequest("GET", "/metrics", nil)
+			recorder = httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain") {
+				t.Errorf("Content-Type without Accept = %q, expected text format", contentType)
+			}
+		})
+	}
+}
+
+func TestCombinedMetricsHandler(t *testing.T) {
+	printer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer printer.Close()
+
+	udpRegistry := prometheus.NewRegistry()
+	udpTemp := prometheus.NewGauge(prometheus.GaugeOpts{Name: "prusa_temp_noz", Help: "test"})
+	udpTemp.Set(215)
+	udpRegistry.MustRegister(udpTemp)
+
+	cfg := config.Config{Printers: []config.Printers{{Address: strings.TrimPrefix(printer.URL, "http://"), Name: "TestPrinter", Type: "MK4"}}}
+	cfg.Exporter.ScrapeTimeout = 1
+	handler := combinedMetricsHandler(prusalink.NewCollector(cfg), udpRegistry)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("GET /metrics returned %d, expected %d", recorder.Code, http.StatusOK)
+	}
+
+	body := recorder.Body.String()
+	for _, family := range []string{prusalink.MetricPrinterUp + "{", "prusa_temp_noz 215", "go_goroutines"} {
+		if !strings.Contains(body, family) {
+			t.Errorf("GET /metrics does not contain %s", family)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const remoteWriteTimeout = 10 * time.Second
+
+// remoteWriteLabel is a label of a remote write time series
+type remoteWriteLabel struct {
+	name  string
+	value string
+}
+
+// remoteWriteSeries is a single sample time series of a remote write request
+type remoteWriteSeries struct {
+	labels    []remoteWriteLabel
+	value     float64
+	timestamp int64 // milliseconds
+}
+
+// runRemoteWrite pushes metrics gathered from gatherer to the remote write endpoint every interval
+func runRemoteWrite(ctx context.Context, endpoint string, interval time.Duration, gatherer prometheus.Gatherer) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := pushRemoteWrite(ctx, endpoint, gatherer); err != nil {
+				log.Error().Msg("Error while pushing metrics to remote write endpoint - " + err.Error())
+			}
+		}
+	}
+}
+
+// pushRemoteWrite gathers metrics and sends them as snappy compressed protobuf to the remote write endpoint.
+// Credentials in the endpoint URL are sent as basic auth.
+func pushRemoteWrite(ctx context.Context, endpoint string, gatherer prometheus.Gatherer) error {
+	families, err := gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("failed to gather metrics: %w", err)
+	}
+
+	target, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid remote write URL: %w", err)
+	}
+	user := target.User
+	target.User = nil
+
+	payload := snappy.Encode(nil, encodeWriteRequest(toRemoteWriteSeries(families, time.Now())))
+
+	ctx, cancel := context.WithTimeout(ctx, remoteWriteTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", target.String(), bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if user != nil {
+		password, _ := user.Password()
+		req.SetBasicAuth(user.Username(), password)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("remote write endpoint returned status: %s", resp.Status)
+	}
+	return nil
+}
+
+// toRemoteWriteSeries flattens gathered metric families to single sample series,
+// summaries and histograms are split the same way as in the text exposition format
+func toRemoteWriteSeries(families []*dto.MetricFamily, now time.Time) []remoteWriteSeries {
+	var series []remoteWriteSeries
+	for _, family := range families {
+		name := family.GetName()
+		for _, metric := range family.GetMetric() {
+			timestamp := now.UnixMilli()
+			if metric.TimestampMs != nil {
+				timestamp = metric.GetTimestampMs()
+			}
+			add := func(name string, value float64, extra ...remoteWriteLabel) {
+				series = append(series, remoteWriteSeries{labels: seriesLabels(name, metric, extra...), value: value, timestamp: timestamp})
+			}
+
+			switch {
+			case metric.Gauge != nil:
+				add(name, metric.GetGauge().GetValue())
+			case metric.Counter != nil:
+				add(name, metric.GetCounter().GetValue())
+			case metric.Untyped != nil:
+				add(name, metric.GetUntyped().GetValue())
+			case metric.Summary != nil:
+				for _, quantile := range metric.GetSummary().GetQuantile() {
+					add(name, quantile.GetValue(), remoteWriteLabel{"quantile", formatFloat(quantile.GetQuantile())})
+				}
+				add(name+"_sum", metric.GetSummary().GetSampleSum())
+				add(name+"_count", float64(metric.GetSummary().GetSampleCount()))
+			case metric.Histogram != nil:
+				for _, bucket := range metric.GetHistogram().GetBucket() {
+					add(name+"_bucket", float64(bucket.GetCumulativeCount()), remoteWriteLabel{"le", formatFloat(bucket.GetUpperBound())})
+				}
+				add(name+"_bucket", float64(metric.GetHistogram().GetSampleCount()), remoteWriteLabel{"le", "+Inf"})
+				add(name+"_sum", metric.GetHistogram().GetSampleSum())
+				add(name+"_count", float64(metric.GetHistogram().GetSampleCount()))
+			}
+		}
+	}
+	return series
+}
+
+// seriesLabels returns labels of the series sorted by name as required by remote write
+func seriesLabels(name string, metric *dto.Metric, extra ...remoteWriteLabel) []remoteWriteLabel {
+	labels := []remoteWriteLabel{{"__name__", name}}
+	for _, label := range metric.GetLabel() {
+		labels = append(labels, remoteWriteLabel{label.GetName(), label.GetValue()})
+	}
+	labels = append(labels, extra...)
+	slices.SortFunc(labels, func(a, b remoteWriteLabel) int {
+		return strings.Compare(a.name, b.name)
+	})
+	return labels
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// encodeWriteRequest encodes the series as prometheus.WriteRequest protobuf message
+func encodeWriteRequest(series []remoteWriteSeries) []byte {
+	var request []byte
+	for _, s := range series {
+		var timeSeries []byte
+		for _, label := range s.labels {
+			var encoded []byte
+			encoded = protowire.AppendTag(encoded, 1, protowire.BytesType)
+			encoded = protowire.AppendString(encoded, label.name)
+			encoded = protowire.AppendTag(encoded, 2, protowire.BytesType)
+			encoded = protowire.AppendString(encoded, label.value)
+
+			timeSeries = protowire.AppendTag(timeSeries, 1, protowire.BytesType)
+			timeSeries = protowire.AppendBytes(timeSeries, encoded)
+		}
+
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(s.timestamp))
+
+		timeSeries = protowire.AppendTag(timeSeries, 2, protowire.BytesType)
+		timeSeries = protowire.AppendBytes(timeSeries, sample)
+
+		request = protowire.AppendTag(request, 1, protowire.BytesType)
+		request = protowire.AppendBytes(request, timeSeries)
+	}
+	return request
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodeWriteRequest decodes remote write request to series values keyed by sorted labels
+func decodeWriteRequest(t *testing.T, request []byte) map[string]float64 {
+	t.Helper()
+	series := map[string]float64{}
+	for len(request) > 0 {
+		_, _, n := protowire.ConsumeTag(request)
+		timeSeries, m := protowire.ConsumeBytes(request[n:])
+		if m < 0 {
+			t.Fatal("invalid write request")
+		}
+		request = request[n+m:]
+
+		var (
+			labels []string
+			value  float64
+		)
+		for len(timeSeries) > 0 {
+			field, _, n := protowire.ConsumeTag(timeSeries)
+			message, m := protowire.ConsumeBytes(timeSeries[n:])
+			if m < 0 {
+				t.Fatal("invalid time series")
+			}
+			timeSeries = timeSeries[n+m:]
+
+			switch field {
+			case 1: // label
+				var pair []string
+				for len(message) > 0 {
+					_, _, n := protowire.ConsumeTag(message)
+					text, m := protowire.ConsumeString(message[n:])
+					pair = append(pair, text)
+					message = message[n+m:]
+				}
+				labels = append(labels, strings.Join(pair, "="))
+			case 2: // sample
+				_, _, n := protowire.ConsumeTag(message)
+				bits, _ := protowire.ConsumeFixed64(message[n:])
+				value = math.Float64frombits(bits)
+			}
+		}
+		series[strings.Join(labels, ",")] = value
+	}
+	return series
+}
+
+func TestPushRemoteWrite(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "prusa_temp_nozzle", Help: "test"}, []string{"printer_name", "tool"})
+	gauge.WithLabelValues("mk4", "0").Set(215.5)
+	registry.MustRegister(gauge)
+
+	var (
+		series          map[string]float64
+		headers         http.Header
+		user, password  string
+		basicAuthWasSet bool
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		user, password, basicAuthWasSet = r.BasicAuth()
+		body, _ := io.ReadAll(r.Body)
+		decoded, err := snappy.Decode(nil, body)
+		if err != nil {
+			t.Errorf("snappy.Decode() error: %v", err)
+			return
+		}
+		series = decodeWriteRequest(t, decoded)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	endpoint := strings.Replace(server.URL, "http://", "http://writer:secret@", 1) + "/api/v1/write"
+	if err := pushRemoteWrite(context.Background(), endpoint, registry); err != nil {
+		t.Fatalf("pushRemoteWrite() error: %v", err)
+	}
+
+	if headers.Get("Content-Encoding") != "snappy" || headers.Get("Content-Type") != "application/x-protobuf" {
+		t.Errorf("unexpected headers: %v", headers)
+	}
+	if !basicAuthWasSet || user != "writer" || password != "secret" {
+		t.Errorf("basic auth = %q:%q (set %t), expected writer:secret", user, password, basicAuthWasSet)
+	}
+
+	key := "__name__=prusa_temp_nozzle,printer_name=mk4,tool=0"
+	if value, ok := series[key]; !ok || value != 215.5 {
+		t.Errorf("series %s = %v (found %t), expected 215.5; got %v", key, value, ok, series)
+	}
+}
+
+func TestPushRemoteWriteError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	if err := pushRemoteWrite(context.Background(), server.URL, prometheus.NewRegistry()); err == nil {
+		t.Error("pushRemoteWrite() expected error for 400 response")
+	}
+}
@@ -1,55 +1,152 @@
 package config
 
 import (
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
 	"os"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v3"
 )
 
+var envVariable = regexp.MustCompile(`\$\{[A-Za-z_][A-Za-z0-9_]*\}`)
+
+// labelName matches valid Prometheus label names
+var labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// builtinLabels are label names of prusalink metrics, custom labels must not collide with them. Label names
+// reserved by summaries and histograms are included, e.g. scrape latency summary panics with quantile label.
+var builtinLabels = []string{
+	"api_version", "config_name", "device_name", "enabled", "endpoint", "error_reason", "fan", "file_type", "firmware",
+	"flag", "le", "origin", "printer_address", "printer_axis", "printer_filament", "printer_heated_element",
+	"printer_hostname", "printer_job_name", "printer_job_path", "printer_location", "printer_model",
+	"printer_name", "printer_state", "printer_storage", "prusalink_name", "quantile", "reason", "serial_number",
+	"server_version", "tag", "tool", "type", "version", "version_text",
+}
+
+// udpTags are tags the exporter adds to every udp metric, rename targets must not collide with them
+var udpTags = []string{"printer_mac", "printer_address"}
+
+// stdin is read when configuration path is "-", replaced in tests
+var stdin io.Reader = os.Stdin
+
+// configFetchTimeout limits fetching configuration over HTTP
+const configFetchTimeout = 30 * time.Second
+
+// LokiPushPath is the path of Loki push API
+const LokiPushPath = "/loki/api/v1/push"
+
 // Config struct for the configuration file prusa.yml
 type Config struct {
-	Exporter struct {
-		ScrapeTimeout int    `yaml:"scrape_timeout"`
-		LogLevel      string `yaml:"log_level"`
-		IPOverride    string
-		AllMetricsUDP bool
-		ExtraMetrics  []string
-		LokiPushURL   string
-	} `yaml:"exporter"`
+	Exporter  Exporter   `yaml:"exporter"`
 	Printers  []Printers `yaml:"printers"`
 	PrusaLink struct {
-		CommonLabels   []string `yaml:"common_labels"`
-		DisableMetrics []string `yaml:"disable_metrics"`
+		CommonLabels         []string `yaml:"common_labels"`
+		DisableMetrics       []string `yaml:"disable_metrics"`
+		LengthUnit           string   // legacy, meters or millimeters, set by prusalink.length-unit flag
+		Prefix               string   // prefix of metric names replacing prusa_, set by prusalink.prefix flag
+		StripAddressPort     bool     // printer_address label without port, set by prusalink.strip-address-port flag
+		MaxConcurrentScrapes int      // 0 means unlimited, set by prusalink.max-concurrent-scrapes flag
+		UtilizationWindow    int      `yaml:"utilization_window"` // seconds, window of prusa_utilization_ratio
+		BedInstability       struct {
+			Window    int     `yaml:"window"`    // seconds, window of prusa_bed_temp_instability
+			Threshold float64 `yaml:"threshold"` // celsius, prusa_bed_temp_unstable is 1 above it
+		} `yaml:"bed_instability"`
+		Backoff struct {
+			Initial int `yaml:"initial"` // seconds, delay of the next scrape after the first failure
+			Max     int `yaml:"max"`     // seconds, cap of the doubling delay
+		} `yaml:"backoff"`
 	} `yaml:"prusalink"`
+	UDP struct {
+		TagRenames map[string]string  `yaml:"tag_renames"` // tag key sent by printer -> label name
+		Materials  map[string]float64 `yaml:"materials"`   // filament type -> metric value, merged over defaults
+	} `yaml:"udp"`
+}
+
+// Exporter struct containing the exporter configuration
+type Exporter struct {
+	ScrapeTimeout      int    `yaml:"scrape_timeout"`
+	LogLevel           string `yaml:"log_level"`
+	DNSRefreshInterval int    `yaml:"dns_refresh_interval"` // seconds, how often are printer hostnames re-resolved
+	AuditLog           string `yaml:"audit_log"`            // file where scrape results are appended as JSON lines
+	AuditLogMaxSize    int    `yaml:"audit_log_max_size"`   // megabytes, audit log is rotated when exceeded
+	IPOverride         string
+	AllMetricsUDP      bool
+	ExtraMetrics       []string
+	LokiPushURL        string
+	LokiUsername       string `yaml:"loki_username"`
+	LokiPassword       string `yaml:"loki_password"`
+	LokiTenant         string `yaml:"loki_tenant"` // sent as X-Scope-OrgID header
+	LokiCompress       bool   `yaml:"loki_compress"`
+	LokiImageSize      string // small or large thumbnail of the job, set by loki.image-size flag
+	MaxConcurrentGcode int    // 0 means unlimited, set by udp.max-concurrent-gcode flag
+	UserAgent          string // User-Agent header of requests to printers, set by http.user-agent flag
+	ImageTimeout       int    // seconds, timeout of fetching job images, set by loki.image-timeout flag
 }
 
+// Authentication types of printers set by auth_type
+const (
+	AuthDigest = "digest"
+	AuthBasic  = "basic"
+	AuthAPIKey = "apikey"
+)
+
 // Printers struct containing the printer configuration
 type Printers struct {
-	Address           string `yaml:"address"`
-	Username          string `yaml:"username,omitempty"`
-	Password          string `yaml:"password,omitempty"`
-	Apikey            string `yaml:"apikey,omitempty"`
-	Name              string `yaml:"name,omitempty"`
-	Type              string `yaml:"type,omitempty"`
+	Address           string            `yaml:"address"`
+	Username          string            `yaml:"username,omitempty"`
+	Password          string            `yaml:"password,omitempty"`
+	Apikey            string            `yaml:"apikey,omitempty"`
+	AuthType          string            `yaml:"auth_type,omitempty"` // digest, basic or apikey, apikey if empty and apikey is set, digest otherwise
+	Enabled           *bool             `yaml:"enabled,omitempty"`   // disabled printers are not scraped, nil means enabled
+	Name              string            `yaml:"name,omitempty"`
+	Type              string            `yaml:"type,omitempty"`
+	Labels            map[string]string `yaml:"labels,omitempty"`
+	Tags              []string          `yaml:"tags,omitempty"`           // reported by prusa_printer_tag instead of labels of every metric
+	SkipEndpoints     []string          `yaml:"skip_endpoints,omitempty"` // optional endpoints not scraped - status, info, job_v1, stats, mesh, files, queue
+	Timeout           int               `yaml:"timeout,omitempty"`        // seconds, overrides scrape timeout of the exporter
+	LokiPushURL       string            `yaml:"loki_push_url,omitempty"`  // overrides Loki push URL of the exporter
 	Reachable         bool
 	UDPMetricsEnabled bool
+	UDPMetricsReason  string // result of enabling UDP metrics - ok, send_failed or start_failed
+}
+
+// IsEnabled returns false if the printer is disabled in the configuration
+func (p Printers) IsEnabled() bool {
+	return p.Enabled == nil || *p.Enabled
 }
 
-// LoadConfig function to load and parse the configuration file
+// LoadConfig function to load and parse the configuration file. Path "-" reads the configuration
+// from stdin, http(s) URL fetches it from the server.
 func LoadConfig(path string, prusaLinkScrapeTimeout int, udpIPOverride string, udpAllMetrics bool, udpExtraMetrics string, lokiPushURL string, lokiEnabled bool) (Config, error) {
 	var config Config
-	file, err := os.ReadFile(path)
+	file, err := readConfig(path)
 
 	if err != nil {
 		return config, err
 	}
 
-	if err := yaml.Unmarshal(file, &config); err != nil {
+	if err := yaml.Unmarshal([]byte(expandEnv(string(file))), &config); err != nil {
 		return config, err
 	}
+	if err := validatePrinterLabels(config.Printers); err != nil {
+		return config, err
+	}
+	if err := validatePrinterAuthTypes(config.Printers); err != nil {
+		return config, err
+	}
+	if err := validateTagRenames(config.UDP.TagRenames); err != nil {
+		return config, err
+	}
+
 	config.Exporter.ScrapeTimeout = prusaLinkScrapeTimeout
 	if udpIPOverride != "" {
 		config.Exporter.IPOverride = udpIPOverride
@@ -68,16 +165,154 @@ func LoadConfig(path string, prusaLinkScrapeTimeout int, udpIPOverride string, u
 	}
 
 	if lokiEnabled {
+		if lokiPushURL != "" {
+			if err := validateLokiPushURL(lokiPushURL); err != nil {
+				return config, err
+			}
+		}
 		config.Exporter.LokiPushURL = lokiPushURL
+		for _, printer := range config.Printers {
+			if printer.LokiPushURL == "" {
+				// global URL is required only for printers without their own
+				if lokiPushURL == "" && printer.IsEnabled() {
+					return config, fmt.Errorf("printer %s (%s): loki push URL must be set, either loki.push-url or loki_push_url of the printer", printer.Name, printer.Address)
+				}
+				continue
+			}
+			if err := validateLokiPushURL(printer.LokiPushURL); err != nil {
+				return config, fmt.Errorf("printer %s (%s): %w", printer.Name, printer.Address, err)
+			}
+		}
 		log.Info().Msg("Loki integration enabled")
 	} else {
 		config.Exporter.LokiPushURL = ""
+		for i := range config.Printers {
+			config.Printers[i].LokiPushURL = ""
+		}
 		log.Info().Msg("Loki integration disabled")
 	}
 
 	return config, err
 }
 
+// IsLocalFile returns true if the configuration path refers to a file, not to stdin or URL
+func IsLocalFile(path string) bool {
+	return path != "-" && !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://")
+}
+
+// readConfig returns content of the configuration from file, stdin or URL
+func readConfig(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(stdin)
+	}
+	if IsLocalFile(path) {
+		return os.ReadFile(path)
+	}
+
+	client := &http.Client{Timeout: configFetchTimeout}
+	resp, err := client.Get(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch configuration: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch configuration: server returned %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// validatePrinterLabels ensures all printers declare the same valid custom label keys not colliding with built-in
+// labels, Prometheus requires stable label names
+func validatePrinterLabels(printers []Printers) error {
+	if len(printers) == 0 {
+		return nil
+	}
+
+	expected := slices.Sorted(maps.Keys(printers[0].Labels))
+	for _, key := range expected {
+		if !labelName.MatchString(key) || strings.HasPrefix(key, "__") {
+			return fmt.Errorf("printer %s (%s) declares label %q which is not a valid Prometheus label name", printers[0].Name, printers[0].Address, key)
+		}
+		if slices.Contains(builtinLabels, key) {
+			return fmt.Errorf("printer %s (%s) declares label %q which collides with a built-in label", printers[0].Name, printers[0].Address, key)
+		}
+	}
+	for _, printer := range printers[1:] {
+		keys := slices.Sorted(maps.Keys(printer.Labels))
+		if !slices.Equal(keys, expected) {
+			return fmt.Errorf("printer %s (%s) declares labels %v, expected %v - all printers must use the same label keys", printer.Name, printer.Address, keys, expected)
+		}
+	}
+
+	return nil
+}
+
+// validateTagRenames ensures udp tags are renamed to valid label names, which do not collide with each other
+// or with tags added by the exporter that are kept
+func validateTagRenames(renames map[string]string) error {
+	targets := map[string]string{}
+	for _, tag := range slices.Sorted(maps.Keys(renames)) {
+		name := renames[tag]
+		if !labelName.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("udp tag %q is renamed to %q which is not a valid Prometheus label name", tag, name)
+		}
+		if other, ok := targets[name]; ok {
+			return fmt.Errorf("udp tags %q and %q are both renamed to %q", other, tag, name)
+		}
+		if _, renamed := renames[name]; slices.Contains(udpTags, name) && !renamed {
+			return fmt.Errorf("udp tag %q is renamed to %q which collides with a built-in label", tag, name)
+		}
+		targets[name] = tag
+	}
+	return nil
+}
+
+// validatePrinterAuthTypes ensures printers use known authentication types
+func validatePrinterAuthTypes(printers []Printers) error {
+	for _, printer := range printers {
+		switch printer.AuthType {
+		case "", AuthDigest, AuthBasic, AuthAPIKey:
+		default:
+			return fmt.Errorf("printer %s (%s) uses unknown auth_type %q, expected %s, %s or %s", printer.Name, printer.Address, printer.AuthType, AuthDigest, AuthBasic, AuthAPIKey)
+		}
+	}
+	return nil
+}
+
+// validateLokiPushURL ensures the Loki push URL is an absolute http(s) URL, unexpected path is only reported
+func validateLokiPushURL(lokiPushURL string) error {
+	parsed, err := url.Parse(lokiPushURL)
+	if err != nil {
+		return fmt.Errorf("invalid loki push URL %q: %w", lokiPushURL, err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("invalid loki push URL %q: scheme must be http or https", lokiPushURL)
+	}
+	if parsed.Host == "" {
+		return fmt.Errorf("invalid loki push URL %q: missing host", lokiPushURL)
+	}
+
+	if !strings.HasSuffix(parsed.Path, LokiPushPath) {
+		log.Warn().Msgf("Loki push URL %s does not end with %s, job images may not be pushed", lokiPushURL, LokiPushPath)
+	}
+	return nil
+}
+
+// expandEnv substitutes ${VAR} references with environment variables. Bare $VAR is left
+// untouched so passwords containing $ are not mangled. Unset variables expand to empty string.
+func expandEnv(content string) string {
+	return envVariable.ReplaceAllStringFunc(content, func(reference string) string {
+		return os.Expand(reference, func(name string) string {
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				log.Warn().Msgf("Environment variable %s referenced in configuration is not set", name)
+			}
+			return value
+		})
+	})
+}
+
 // GetLogLevel function to parse the log level for zerolog
 func GetLogLevel(level string) zerolog.Level {
 	switch level {
@@ -1,8 +1,11 @@
 package config
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/rs/zerolog"
@@ -205,6 +208,335 @@ printers:
 	})
 }
 
+func TestLoadConfigEnvExpansion(t *testing.T) {
+	t.Setenv("PRUSA_TEST_PASSWORD", "secret")
+
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "env_prusa.yml")
+
+	envConfig := `
+printers:
+  - address: "192.168.1.100:80"
+    username: "${PRUSA_TEST_UNSET_USERNAME}"
+    password: "${PRUSA_TEST_PASSWORD}"
+    name: "TestPrinter1"
+  - address: "192.168.1.101:80"
+    password: "pa$$word$PRUSA_TEST_PASSWORD"
+    name: "TestPrinter2"
+`
+
+	err := os.WriteFile(configPath, []byte(envConfig), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	cfg, err := LoadConfig(configPath, 10, "", false, "", "", false)
+	if err != nil {
+		t.Fatalf("LoadConfig() error: %v", err)
+	}
+
+	if cfg.Printers[0].Password != "secret" {
+		t.Errorf("Password = %s, expected secret", cfg.Printers[0].Password)
+	}
+	if cfg.Printers[0].Username != "" {
+		t.Errorf("Username = %s, expected empty string for unset variable", cfg.Printers[0].Username)
+	}
+	if cfg.Printers[1].Password != "pa$$word$PRUSA_TEST_PASSWORD" {
+		t.Errorf("Password = %s, expected literal $ to be preserved", cfg.Printers[1].Password)
+	}
+}
+
+func TestLoadConfigPrinterLabels(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	t.Run("SameKeys", func(t *testing.T) {
+		configPath := filepath.Join(tmpDir, "labels.yml")
+		labelsConfig := `
+printers:
+  - address: "192.168.1.100:80"
+    name: "TestPrinter1"
+    labels:
+      room: "garage"
+      owner: "alice"
+  - address: "192.168.1.101:80"
+    name: "TestPrinter2"
+    labels:
+      owner: "bob"
+      room: "office"
+`
+		if err := os.WriteFile(configPath, []byte(labelsConfig), 0644); err != nil {
+			t.Fatalf("Failed to create test config file: %v", err)
+		}
+
+		cfg, err := LoadConfig(configPath, 10, "", false, "", "", false)
+		if err != nil {
+			t.Fatalf("LoadConfig() error: %v", err)
+		}
+		if cfg.Printers[1].Labels["room"] != "office" {
+			t.Errorf("Labels[room] = %s, expected office", cfg.Printers[1].Labels["room"])
+		}
+	})
+
+	t.Run("MismatchedKeys", func(t *testing.T) {
+		configPath := filepath.Join(tmpDir, "labels_mismatch.yml")
+		labelsConfig := `
+printers:
+  - address: "192.168.1.100:80"
+    name: "TestPrinter1"
+    labels:
+      room: "garage"
+  - address: "192.168.1.101:80"
+    name: "TestPrinter2"
+    labels:
+      owner: "bob"
+`
+		if err := os.WriteFile(configPath, []byte(labelsConfig), 0644); err != nil {
+			t.Fatalf("Failed to create test config file: %v", err)
+		}
+
+		if _, err := LoadConfig(configPath, 10, "", false, "", "", false); err == nil {
+			t.Error("LoadConfig() expected error for mismatched label keys")
+		}
+	})
+
+	for name, key := range map[string]string{"InvalidName": "room-name", "Reserved": "__room", "BuiltinCollision": "printer_model", "SummaryQuantile": "quantile"} {
+		t.Run(name, func(t *testing.T) {
+			configPath := filepath.Join(tmpDir, "labels_"+name+".yml")
+			labelsConfig := `
+printers:
+  - address: "192.168.1.100:80"
+    name: "TestPrinter1"
+    labels:
+      ` + key + `: "garage"
+`
+			if err := os.WriteFile(configPath, []byte(labelsConfig), 0644); err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+
+			_, err := LoadConfig(configPath, 10, "", false, "", "", false)
+			if err == nil || !strings.Contains(err.Error(), key) {
+				t.Errorf("LoadConfig() error = %v, expected error naming label %q", err, key)
+			}
+		})
+	}
+}
+
+func TestLoadConfigTagRenames(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		renames string
+		wantErr bool
+	}{
+		{"Valid", "printer_mac: mac\n    printer_address: instance", false},
+		{"Swapped", "printer_mac: printer_address\n    printer_address: printer_mac", false},
+		{"InvalidName", "printer_mac: printer-mac", true},
+		{"Reserved", "printer_mac: __mac", true},
+		{"SameTarget", "printer_mac: printer\n    printer_address: printer", true},
+		{"BuiltinCollision", "printer_mac: printer_address", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(tmpDir, tt.name+".yml")
+			renamesConfig := `
+udp:
+  tag_renames:
+    ` + tt.renames + `
+`
+			if err := os.WriteFile(configPath, []byte(renamesConfig), 0644); err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+
+			_, err := LoadConfig(configPath, 10, "", false, "", "", false)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfigAuthType(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		auth    string
+		wantErr bool
+	}{
+		{"Empty", "", false},
+		{"Digest", "digest", false},
+		{"Basic", "basic", false},
+		{"APIKey", "apikey", false},
+		{"Unknown", "bearer", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(tmpDir, tt.name+".yml")
+			authConfig := `
+printers:
+  - address: "192.168.1.100:80"
+    name: "TestPrinter"
+    auth_type: "` + tt.auth + `"
+`
+			if err := os.WriteFile(configPath, []byte(authConfig), 0644); err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+
+			cfg, err := LoadConfig(configPath, 10, "", false, "", "", false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && cfg.Printers[0].AuthType != tt.auth {
+				t.Errorf("AuthType = %s, expected %s", cfg.Printers[0].AuthType, tt.auth)
+			}
+		})
+	}
+}
+
+func TestLoadConfigLokiPushURL(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "loki.yml")
+	if err := os.WriteFile(configPath, []byte("printers:\n  - address: \"192.168.1.100\"\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		lokiPushURL string
+		expectError bool
+	}{
+		{"Valid", "http://loki:3100/loki/api/v1/push", false},
+		{"UnexpectedPath", "https://loki.example.com/push", false},
+		{"Empty", "", true},
+		{"MissingScheme", "loki:3100/loki/api/v1/push", true},
+		{"MissingHost", "http:///loki/api/v1/push", true},
+		{"Malformed", "http://loki:port/loki/api/v1/push", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadConfig(configPath, 10, "", false, "", tt.lokiPushURL, true)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("LoadConfig() expected error for loki push URL %q", tt.lokiPushURL)
+				} else if !strings.Contains(err.Error(), "loki push URL") {
+					t.Errorf("LoadConfig() error = %v, expected it to mention loki push URL", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig() error: %v", err)
+			}
+			if cfg.Exporter.LokiPushURL != tt.lokiPushURL {
+				t.Errorf("LokiPushURL = %s, expected %s", cfg.Exporter.LokiPushURL, tt.lokiPushURL)
+			}
+		})
+	}
+}
+
+func TestLoadConfigLokiPushURLPerPrinter(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	tests := []struct {
+		name        string
+		printers    string
+		expectError bool
+	}{
+		{"AllPrintersOverride", `
+  - address: "192.168.1.100"
+    loki_push_url: "http://loki-a:3100/loki/api/v1/push"
+  - address: "192.168.1.101"
+    loki_push_url: "http://loki-b:3100/loki/api/v1/push"
+`, false},
+		{"DisabledPrinterWithoutURL", `
+  - address: "192.168.1.100"
+    loki_push_url: "http://loki-a:3100/loki/api/v1/push"
+  - address: "192.168.1.101"
+    enabled: false
+`, false},
+		{"PrinterWithoutURL", `
+  - address: "192.168.1.100"
+    loki_push_url: "http://loki-a:3100/loki/api/v1/push"
+  - address: "192.168.1.101"
+`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(tmpDir, tt.name+".yml")
+			if err := os.WriteFile(configPath, []byte("printers:"+tt.printers), 0644); err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+
+			// no global loki push URL
+			cfg, err := LoadConfig(configPath, 10, "", false, "", "", true)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("LoadConfig() error = %v, expectError %v", err, tt.expectError)
+			}
+			if err == nil && cfg.Printers[0].LokiPushURL != "http://loki-a:3100/loki/api/v1/push" {
+				t.Errorf("Printers[0].LokiPushURL = %s, expected per-printer URL", cfg.Printers[0].LokiPushURL)
+			}
+		})
+	}
+}
+
+func TestLoadConfigSources(t *testing.T) {
+	const remoteConfig = `
+printers:
+  - address: "192.168.1.100"
+    name: "Remote"
+`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/prusa.yml":
+			w.Write([]byte(remoteConfig))
+		case "/invalid.yml":
+			w.Write([]byte("printers:\n  - address: a\n    labels: {room: garage}\n  - address: b\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	originalStdin := stdin
+	defer func() { stdin = originalStdin }()
+
+	t.Run("Stdin", func(t *testing.T) {
+		stdin = strings.NewReader(remoteConfig)
+		cfg, err := LoadConfig("-", 10, "", false, "", "", false)
+		if err != nil {
+			t.Fatalf("LoadConfig() error: %v", err)
+		}
+		if len(cfg.Printers) != 1 || cfg.Printers[0].Name != "Remote" {
+			t.Errorf("LoadConfig() printers = %v, expected printer Remote", cfg.Printers)
+		}
+	})
+
+	t.Run("HTTP", func(t *testing.T) {
+		cfg, err := LoadConfig(server.URL+"/prusa.yml", 10, "", false, "", "", false)
+		if err != nil {
+			t.Fatalf("LoadConfig() error: %v", err)
+		}
+		if len(cfg.Printers) != 1 || cfg.Printers[0].Name != "Remote" {
+			t.Errorf("LoadConfig() printers = %v, expected printer Remote", cfg.Printers)
+		}
+	})
+
+	t.Run("HTTPNotFound", func(t *testing.T) {
+		if _, err := LoadConfig(server.URL+"/missing.yml", 10, "", false, "", "", false); err == nil {
+			t.Error("LoadConfig() expected error for 404 response")
+		}
+	})
+
+	t.Run("HTTPValidation", func(t *testing.T) {
+		if _, err := LoadConfig(server.URL+"/invalid.yml", 10, "", false, "", "", false); err == nil {
+			t.Error("LoadConfig() expected error for mismatched label keys")
+		}
+	})
+}
+
 func TestGetLogLevel(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -0,0 +1,98 @@
+package prusalink
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// auditRecord is the result of a single printer scrape written to the audit log
+type auditRecord struct {
+	Printer   string    `json:"printer"`
+	Name      string    `json:"name,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Up        bool      `json:"up"`
+	Duration  float64   `json:"duration_seconds"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// auditLog appends scrape results as JSON lines to a file. When the file would exceed maxSize bytes,
+// it is rotated to <path>.1 replacing the previous rotated file.
+type auditLog struct {
+	path    string
+	maxSize int64 // 0 means unlimited
+	file    *os.File
+	size    int64
+	mutex   sync.Mutex
+}
+
+// newAuditLog opens the audit log file for appending
+func newAuditLog(path string, maxSize int64) (*auditLog, error) {
+	a := &auditLog{path: path, maxSize: maxSize}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *auditLog) open() error {
+	file, err := os.OpenFile(a.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat audit log: %w", err)
+	}
+	a.file = file
+	a.size = info.Size()
+	return nil
+}
+
+// rotate moves the current file to <path>.1 and opens a new one. The file is renamed while open, so records
+// keep being written to the current file when the rotation fails.
+func (a *auditLog) rotate() error {
+	if err := os.Rename(a.path, a.path+".1"); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+	rotated := a.file
+	if err := a.open(); err != nil {
+		return err
+	}
+	if err := rotated.Close(); err != nil {
+		return fmt.Errorf("failed to close rotated audit log: %w", err)
+	}
+	return nil
+}
+
+// write appends the record to the audit log, nil audit log discards the record
+func (a *auditLog) write(record auditRecord) error {
+	if a == nil {
+		return nil
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %w", err)
+	}
+	line = append(line, '\n')
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	// failed rotation is retried with the next record, the record is not lost
+	var rotateErr error
+	if a.maxSize > 0 && a.size > 0 && a.size+int64(len(line)) > a.maxSize {
+		rotateErr = a.rotate()
+	}
+
+	n, err := a.file.Write(line)
+	a.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return rotateErr
+}
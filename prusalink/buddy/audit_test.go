@@ -0,0 +1,134 @@
+package prusalink
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pstrobl96/prusa_exporter/config"
+)
+
+// readAuditLog returns records written to the audit log file
+func readAuditLog(t *testing.T, path string) []auditRecord {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open audit log: %v", err)
+	}
+	defer file.Close()
+
+	var records []auditRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("audit log line %q is not valid JSON: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestCollectorAuditLog(t *testing.T) {
+	server := newMockPrinter(t, defaultPrinterResponses())
+
+	// nothing listens on the address of closed server
+	closed := httptest.NewServer(nil)
+	closed.Close()
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	cfg := testConfig(
+		config.Printers{Address: printerAddress(server), Apikey: "test_api_key", Name: "online", Type: "MK4"},
+		config.Printers{Address: strings.TrimPrefix(closed.URL, "http://"), Apikey: "test_api_key", Name: "offline", Type: "MK4"},
+	)
+	cfg.Exporter.AuditLog = path
+
+	start := time.Now()
+	gatherMetrics(t, NewCollector(cfg))
+
+	records := readAuditLog(t, path)
+	if len(records) != 2 {
+		t.Fatalf("audit log contains %d records, expected 2", len(records))
+	}
+
+	for _, record := range records {
+		if record.Timestamp.Before(start.Add(-time.Second)) || record.Duration < 0 {
+			t.Errorf("record %+v has invalid timestamp or duration", record)
+		}
+
+		switch record.Name {
+		case "online":
+			if !record.Up || record.Error != "" || record.Printer != printerAddress(server) {
+				t.Errorf("record of online printer = %+v, expected up without error", record)
+			}
+		case "offline":
+			if record.Up || !strings.HasPrefix(record.Error, "job endpoint: ") {
+				t.Errorf("record of offline printer = %+v, expected down with job endpoint error", record)
+			}
+		default:
+			t.Errorf("unexpected record %+v", record)
+		}
+	}
+}
+
+func TestAuditLogRotation(t *testing.T) {
+	record := auditRecord{Printer: "192.168.1.100", Timestamp: time.Now(), Up: true, Duration: 0.1}
+	line, _ := json.Marshal(record)
+
+	// two and half lines fit into the file
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	audit, err := newAuditLog(path, int64(len(line)+1)*5/2)
+	if err != nil {
+		t.Fatalf("newAuditLog() error: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := audit.write(record); err != nil {
+			t.Fatalf("write() error: %v", err)
+		}
+	}
+
+	if records := readAuditLog(t, path+".1"); len(records) != 2 {
+		t.Errorf("rotated audit log contains %d records, expected 2", len(records))
+	}
+	if records := readAuditLog(t, path); len(records) != 1 {
+		t.Errorf("audit log contains %d records after rotation, expected 1", len(records))
+	}
+}
+
+func TestAuditLogRotationFailure(t *testing.T) {
+	record := auditRecord{Printer: "192.168.1.100", Timestamp: time.Now(), Up: true, Duration: 0.1}
+	line, _ := json.Marshal(record)
+
+	// rotated path is a non-empty directory, so the file can not be renamed to it
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	if err := os.MkdirAll(filepath.Join(path+".1", "keep"), 0755); err != nil {
+		t.Fatalf("MkdirAll() error: %v", err)
+	}
+	audit, err := newAuditLog(path, int64(len(line)+1)*3/2)
+	if err != nil {
+		t.Fatalf("newAuditLog() error: %v", err)
+	}
+
+	if err := audit.write(record); err != nil {
+		t.Fatalf("write() error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := audit.write(record); err == nil {
+			t.Errorf("write() expected rotation error")
+		}
+	}
+
+	// records are kept in the current file instead of being lost
+	if records := readAuditLog(t, path); len(records) != 3 {
+		t.Errorf("audit log contains %d records after failed rotation, expected 3", len(records))
+	}
+}
@@ -0,0 +1,77 @@
+package prusalink
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultBackoffInitial = 10 * time.Second
+	defaultBackoffMax     = 5 * time.Minute
+)
+
+// printerBackoff is the state of a printer that failed to be scraped
+type printerBackoff struct {
+	failures int
+	delay    time.Duration
+	until    time.Time
+}
+
+// backoffTracker delays scrapes of unreachable printers, the delay doubles with every consecutive failure
+// up to the maximum and is reset by a successful scrape
+type backoffTracker struct {
+	initial  time.Duration
+	max      time.Duration
+	printers map[string]printerBackoff // keyed by printer address
+	mutex    sync.Mutex
+}
+
+func newBackoffTracker(initial, max time.Duration) *backoffTracker {
+	if initial <= 0 {
+		initial = defaultBackoffInitial
+	}
+	if max <= 0 {
+		max = defaultBackoffMax
+	}
+	if max < initial {
+		max = initial
+	}
+	return &backoffTracker{initial: initial, max: max, printers: map[string]printerBackoff{}}
+}
+
+// skip returns whether the printer should not be scraped at the given time
+func (b *backoffTracker) skip(address string, now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	state, ok := b.printers[address]
+	return ok && now.Before(state.until)
+}
+
+// update records result of the scrape finished at the given time and returns the current backoff
+func (b *backoffTracker) update(address string, up bool, now time.Time) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if up {
+		delete(b.printers, address)
+		return 0
+	}
+
+	state := b.printers[address]
+	state.failures++
+	if state.delay == 0 {
+		state.delay = b.initial
+	} else {
+		state.delay = min(state.delay*2, b.max)
+	}
+	state.until = now.Add(state.delay)
+	b.printers[address] = state
+	return state.delay
+}
+
+// backoff returns the current backoff of the printer, 0 if the last scrape succeeded
+func (b *backoffTracker) backoff(address string) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.printers[address].delay
+}
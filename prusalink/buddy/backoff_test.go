@@ -0,0 +1,43 @@
+package prusalink
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tracker := newBackoffTracker(10*time.Second, 30*time.Second)
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if tracker.skip("192.168.1.100", start) {
+		t.Error("skip() = true for printer never scraped")
+	}
+
+	for i, expected := range []time.Duration{10 * time.Second, 20 * time.Second, 30 * time.Second, 30 * time.Second} {
+		if backoff := tracker.update("192.168.1.100", false, start); backoff != expected {
+			t.Errorf("update() after %d failures = %v, expected %v", i+1, backoff, expected)
+		}
+	}
+	if backoff := tracker.backoff("192.168.1.100"); backoff != 30*time.Second {
+		t.Errorf("backoff() = %v, expected 30s", backoff)
+	}
+	if !tracker.skip("192.168.1.100", start.Add(29*time.Second)) {
+		t.Error("skip() = false within backoff")
+	}
+	if tracker.skip("192.168.1.100", start.Add(30*time.Second)) {
+		t.Error("skip() = true after backoff expired")
+	}
+	if tracker.skip("192.168.1.101", start) {
+		t.Error("skip() = true for other printer")
+	}
+
+	if backoff := tracker.update("192.168.1.100", true, start.Add(30*time.Second)); backoff != 0 {
+		t.Errorf("update() after success = %v, expected 0", backoff)
+	}
+	if tracker.skip("192.168.1.100", start.Add(30*time.Second)) {
+		t.Error("skip() = true after successful scrape")
+	}
+	if backoff := tracker.update("192.168.1.100", false, start.Add(time.Minute)); backoff != 10*time.Second {
+		t.Errorf("update() after reset = %v, expected 10s", backoff)
+	}
+}
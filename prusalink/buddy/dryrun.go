@@ -0,0 +1,45 @@
+package prusalink
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/pstrobl96/prusa_exporter/config"
+)
+
+// DryRun writes the UDP metrics gcode and the label set of every configured printer to w
+// without contacting the printers. Neither the global configuration nor any file, e.g. audit log, is touched.
+func DryRun(w io.Writer, cfg config.Config) error {
+	// only the label state is needed, NewCollector would set global configuration and open the audit log
+	c := &Collector{
+		configuration: cfg,
+		commonLabels:  commonLabelNames(cfg),
+		customLabels:  customLabelKeys(cfg.Printers),
+		sharedHosts:   sharedHosts(cfg.Printers),
+	}
+	labels := slices.Concat(c.commonLabels, c.customLabels)
+
+	for _, printer := range cfg.Printers {
+		gcode, err := gcodeInitFor(cfg)
+		if err != nil {
+			return fmt.Errorf("error creating gcode init for %s: %w", printer.Address, err)
+		}
+
+		if printer.Type == "" {
+			printer.Type = "<detected at runtime>"
+		}
+
+		values := c.GetLabels(printer, Job{})
+		pairs := make([]string, len(labels))
+		for i, label := range labels {
+			pairs[i] = label + "=" + values[i]
+		}
+
+		fmt.Fprintf(w, "# printer %s (%s)\n", printer.Name, printer.Address)
+		fmt.Fprintf(w, "# labels: %s\n", strings.Join(pairs, ", "))
+		fmt.Fprintf(w, "%s\n\n", gcode)
+	}
+	return nil
+}
@@ -1,15 +1,16 @@
 package prusalink
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/icholy/digest"
 	"github.com/pstrobl96/prusa_exporter/config"
 	"github.com/rs/zerolog/log"
 )
@@ -78,6 +79,12 @@ var (
 		"buddy_revision",
 		"buddy_bom",
 	}
+
+	// time and error of the last attempt to enable UDP metrics and number of consecutive failed attempts per printer address
+	udpEnableAttempts = map[string]time.Time{}
+	udpEnableErrors   = map[string]string{}
+	udpEnableFailures = map[string]int{}
+	udpEnableMutex    sync.Mutex
 )
 
 // getLocalIP finds and returns the first ethernet or WiFi IP address, avoiding Docker interfaces.
@@ -170,17 +177,24 @@ func getLocalIP() (string, error) {
 }
 
 func gcodeInit() (init string, err error) {
+	return gcodeInitFor(GetConfiguration())
+}
+
+// gcodeInitFor returns the UDP metrics gcode for the configuration, it does not need the global configuration set
+func gcodeInitFor(cfg config.Config) (init string, err error) {
 	var builder strings.Builder
 
-	ip, err := getLocalIP()
-	if err != nil {
-		return "", fmt.Errorf("failed to get local IP address: %v", err)
+	ip := cfg.Exporter.IPOverride
+	if ip == "" {
+		ip, err = getLocalIP()
+		if err != nil {
+			return "", fmt.Errorf("failed to get local IP address: %v", err)
+		}
 	}
 
 	// Write the initial lines
 	builder.WriteString(fmt.Sprintf("M330 SYSLOG\nM334 %s 8514\nM340 %s 13514", ip, ip))
 
-	cfg := GetConfiguration()
 	if cfg.Exporter.AllMetricsUDP {
 		for _, metric := range allMetricsList {
 			builder.WriteString(fmt.Sprintf("\nM331 %s", metric))
@@ -194,11 +208,11 @@ func gcodeInit() (init string, err error) {
 
 	if len(cfg.Exporter.ExtraMetrics) > 0 {
 		log.Info().Msgf("Adding extra UDP metrics: %v", cfg.Exporter.ExtraMetrics)
-		listOfMetrics = append(listOfMetrics, cfg.Exporter.ExtraMetrics...)
 	}
 
-	// Loop through the list of metrics and append each line
-	for _, metric := range listOfMetrics {
+	// Loop through the list of metrics and append each line, gcode is generated for every printer so
+	// the default list must stay untouched
+	for _, metric := range slices.Concat(listOfMetrics, cfg.Exporter.ExtraMetrics) {
 		builder.WriteString(fmt.Sprintf("\nM331 %s", metric))
 	}
 
@@ -217,15 +231,12 @@ func sendGcode(filename string, printer config.Printers) ([]byte, error) {
 
 	payload := strings.NewReader(gcode)
 
-	url := fmt.Sprintf("http://%s/api/v1/files/usb//%s", printer.Address, filename)
+	url := printerURL(printer.Address, "/api/v1/files/usb//"+filename)
 
 	cfg := GetConfiguration()
 	client := &http.Client{
-		Transport: &digest.Transport{
-			Username: printer.Username,
-			Password: printer.Password,
-		},
-		Timeout: time.Duration(cfg.Exporter.ScrapeTimeout) * time.Second,
+		Transport: authTransport(printer),
+		Timeout:   printerTimeout(printer, time.Duration(cfg.Exporter.ScrapeTimeout)*time.Second),
 	}
 
 	// Create a new PUT request
@@ -237,6 +248,8 @@ func sendGcode(filename string, printer config.Printers) ([]byte, error) {
 	// Set a Content-Type header if needed
 	req.Header.Set("Content-Type", "text/x.gcode")
 	req.Header.Set("Overwrite", "?1")
+	authorizeRequest(req, printer)
+	setUserAgent(req)
 
 	// Send the request
 	res, err := client.Do(req)
@@ -256,15 +269,12 @@ func sendGcode(filename string, printer config.Printers) ([]byte, error) {
 
 func deleteGcode(filename string, printer config.Printers) ([]byte, error) {
 
-	url := fmt.Sprintf("http://%s/api/v1/files/usb//%s", printer.Address, filename)
+	url := printerURL(printer.Address, "/api/v1/files/usb//"+filename)
 
 	cfg := GetConfiguration()
 	client := &http.Client{
-		Transport: &digest.Transport{
-			Username: printer.Username,
-			Password: printer.Password,
-		},
-		Timeout: time.Duration(cfg.Exporter.ScrapeTimeout) * time.Second,
+		Transport: authTransport(printer),
+		Timeout:   printerTimeout(printer, time.Duration(cfg.Exporter.ScrapeTimeout)*time.Second),
 	}
 
 	// Create a new DELETE request. The third argument is nil as DELETE requests do not have a body.
@@ -272,6 +282,8 @@ func deleteGcode(filename string, printer config.Printers) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error creating DELETE request: %w", err)
 	}
+	authorizeRequest(req, printer)
+	setUserAgent(req)
 
 	// Send the request.
 	res, err := client.Do(req)
@@ -291,7 +303,7 @@ func deleteGcode(filename string, printer config.Printers) ([]byte, error) {
 }
 
 func startGcode(filename string, printer config.Printers) ([]byte, error) {
-	url := fmt.Sprintf("http://%s/api/v1/files/usb//%s", printer.Address, filename)
+	url := printerURL(printer.Address, "/api/v1/files/usb//"+filename)
 	var (
 		res    *http.Response
 		result []byte
@@ -300,13 +312,18 @@ func startGcode(filename string, printer config.Printers) ([]byte, error) {
 
 	cfg := GetConfiguration()
 	client := &http.Client{
-		Transport: &digest.Transport{
-			Username: printer.Username,
-			Password: printer.Password,
-		},
-		Timeout: time.Duration(cfg.Exporter.ScrapeTimeout) * time.Second,
+		Transport: authTransport(printer),
+		Timeout:   printerTimeout(printer, time.Duration(cfg.Exporter.ScrapeTimeout)*time.Second),
 	}
-	res, err = client.Post(url, "application/json", nil)
+	req, err := http.NewRequest(http.MethodPost, url, nil)
+	if err != nil {
+		return result, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	authorizeRequest(req, printer)
+	setUserAgent(req)
+
+	res, err = client.Do(req)
 
 	if err != nil {
 		return result, err
@@ -325,37 +342,148 @@ func startGcode(filename string, printer config.Printers) ([]byte, error) {
 	return result, nil
 }
 
-// EnableUDPmetrics enables UDP metrics on all printers concurrently
+// Results of enabling UDP metrics reported in error_reason label
+const (
+	UDPReasonOK          = "ok"
+	UDPReasonSendFailed  = "send_failed"
+	UDPReasonStartFailed = "start_failed"
+	UDPReasonNotSent     = "not_sent" // gcode was not sent at all, e.g. gcode sending is disabled
+)
+
+// EnableUDPmetrics enables UDP metrics on all printers concurrently, at most Exporter.MaxConcurrentGcode at once
 func EnableUDPmetrics(printers []config.Printers) {
 	var wg sync.WaitGroup
 
+	// limits number of printers receiving gcode concurrently, nil means unlimited
+	var slots chan struct{}
+	if limit := GetConfiguration().Exporter.MaxConcurrentGcode; limit > 0 {
+		slots = make(chan struct{}, limit)
+	}
+
 	for i, s := range printers {
+		if !s.IsEnabled() {
+			continue
+		}
 		wg.Add(1)
 		go func(i int, s config.Printers) {
 			defer wg.Done()
-			log.Debug().Msg("Enabling UDP metrics at " + s.Address)
+			if slots != nil {
+				slots <- struct{}{}
+				defer func() { <-slots }()
+			}
+			enablePrinterUDPmetrics(i, s)
+		}(i, s)
+	}
+	wg.Wait()
+}
 
-			send, err := sendGcode("enable_udp_metrics.gcode", s)
+// enablePrinterUDPmetrics sends and starts the UDP metrics gcode at the printer with the given configuration index
+func enablePrinterUDPmetrics(i int, s config.Printers) {
+	log.Debug().Msg("Enabling UDP metrics at " + s.Address)
 
-			if err != nil {
-				log.Error().Msg("Failed to send gcode to " + s.Address + ": " + err.Error())
-				UpdatePrinterUDPStatus(i, false)
-				return
-			}
-			log.Debug().Msg("Gcode sent to " + s.Address + ": " + string(send))
+	udpEnableMutex.Lock()
+	udpEnableAttempts[s.Address] = time.Now()
+	udpEnableMutex.Unlock()
 
-			start, err := startGcode("enable_udp_metrics.gcode", s)
+	send, err := sendGcode("enable_udp_metrics.gcode", s)
 
-			if err != nil {
-				log.Error().Msg("Failed to start gcode at " + s.Address + ": " + err.Error())
-				UpdatePrinterUDPStatus(i, false)
-				return
-			}
-			log.Debug().Msg("Gcode started at " + s.Address + ": " + string(start))
+	if err != nil {
+		log.Error().Msg("Failed to send gcode to " + s.Address + ": " + err.Error())
+		setUDPEnableError(s.Address, err)
+		UpdatePrinterUDPStatus(i, false, UDPReasonSendFailed)
+		return
+	}
+	log.Debug().Msg("Gcode sent to " + s.Address + ": " + string(send))
 
-			UpdatePrinterUDPStatus(i, true)
-			log.Info().Msgf("UDP metrics gcode for printer %s (%s) sent and started", s.Name, s.Address)
-		}(i, s)
+	start, err := startGcode("enable_udp_metrics.gcode", s)
+
+	if err != nil {
+		log.Error().Msg("Failed to start gcode at " + s.Address + ": " + err.Error())
+		setUDPEnableError(s.Address, err)
+		UpdatePrinterUDPStatus(i, false, UDPReasonStartFailed)
+		return
+	}
+	log.Debug().Msg("Gcode started at " + s.Address + ": " + string(start))
+
+	setUDPEnableError(s.Address, nil)
+	UpdatePrinterUDPStatus(i, true, UDPReasonOK)
+	log.Info().Msgf("UDP metrics gcode for printer %s (%s) sent and started", s.Name, s.Address)
+}
+
+// setUDPEnableError remembers error of the last attempt to enable UDP metrics and counts consecutive failures,
+// nil clears both
+func setUDPEnableError(address string, err error) {
+	udpEnableMutex.Lock()
+	defer udpEnableMutex.Unlock()
+	if err == nil {
+		delete(udpEnableErrors, address)
+		delete(udpEnableFailures, address)
+		return
+	}
+	udpEnableErrors[address] = err.Error()
+	udpEnableFailures[address]++
+}
+
+// printerIP returns IP address of the printer, port is stripped and hostnames are resolved
+func printerIP(address string) (string, error) {
+	ip, _, err := resolveHost(context.Background(), printerHost(address))
+	return ip, err
+}
+
+// WatchUDPMetrics periodically re-enables UDP metrics at printers that did not push any metrics for longer
+// than threshold, e.g. because they rebooted and forgot the syslog configuration. lastPush returns time
+// of the last push from the printer IP address.
+func WatchUDPMetrics(threshold time.Duration, lastPush func(ip string) (time.Time, bool)) {
+	ticker := time.NewTicker(threshold / 2)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		reenableStaleUDPmetrics(threshold, lastPush, now)
+	}
+}
+
+// udpReenableMaxBackoff limits how long re-enabling of UDP metrics is postponed after consecutive failures
+const udpReenableMaxBackoff = time.Hour
+
+// reenableBackoff returns how long to wait since the last attempt before re-enabling UDP metrics again,
+// it doubles with every consecutive failure after the first one
+func reenableBackoff(threshold time.Duration, failures int) time.Duration {
+	backoff := threshold
+	for n := 1; n < failures && backoff < udpReenableMaxBackoff; n++ {
+		backoff *= 2
+	}
+	return min(backoff, max(threshold, udpReenableMaxBackoff))
+}
+
+// reenableStaleUDPmetrics re-enables UDP metrics at printers where enabling was attempted, successfully or not,
+// but no metrics were pushed since threshold ago. Printers that failed, e.g. were powered off, are retried with backoff.
+func reenableStaleUDPmetrics(threshold time.Duration, lastPush func(ip string) (time.Time, bool), now time.Time) {
+	for i, s := range GetConfiguration().Printers {
+		udpEnableMutex.Lock()
+		attempt, attempted := udpEnableAttempts[s.Address]
+		failures := udpEnableFailures[s.Address]
+		udpEnableMutex.Unlock()
+
+		if !attempted || !s.IsEnabled() { // gcode was never sent to the printer
+			continue
+		}
+
+		ip, err := printerIP(s.Address)
+		if err != nil {
+			log.Debug().Msg("Failed to resolve " + s.Address + " - " + err.Error())
+			continue
+		}
+
+		last, _ := lastPush(ip)
+		if attempt.After(last) {
+			last = attempt // give the printer time to start pushing after the last attempt
+		}
+
+		if now.Sub(last) <= reenableBackoff(threshold, failures) {
+			continue
+		}
+
+		log.Warn().Msgf("No UDP metrics from printer %s (%s) since %s, enabling UDP metrics again", s.Name, s.Address, last.Format(time.RFC3339))
+		enablePrinterUDPmetrics(i, s)
 	}
-	wg.Wait()
 }
@@ -5,10 +5,13 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/pstrobl96/prusa_exporter/config"
 )
@@ -612,3 +615,265 @@ func BenchmarkGetLocalIP(b *testing.B) {
 	// Restore original configuration
 	configuration = originalConfig
 }
+
+func TestEnableUDPmetricsErrorReason(t *testing.T) {
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	// gcode is uploaded but printer refuses to start it
+	startFailing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer startFailing.Close()
+
+	// nothing listens on the address of closed server, so sending the gcode fails
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	printers := []config.Printers{
+		{Address: strings.TrimPrefix(closed.URL, "http://"), Name: "Unreachable", Type: "MK4"},
+		{Address: strings.TrimPrefix(startFailing.URL, "http://"), Name: "Busy", Type: "MK4"},
+	}
+
+	cfg := testConfig(printers...)
+	cfg.Exporter.IPOverride = "10.0.0.1"
+	SetConfiguration(cfg)
+
+	EnableUDPmetrics(printers)
+
+	families := gatherMetrics(t, NewCollector(GetConfiguration()))
+
+	expected := map[string]string{"Unreachable": UDPReasonSendFailed, "Busy": UDPReasonStartFailed}
+	for _, metric := range families[MetricPrinterUDPMetricsGcodeSent].GetMetric() {
+		name := labelValue(metric, "printer_name")
+		if metric.GetGauge().GetValue() != 0 {
+			t.Errorf("%s of %s = %v, expected 0", MetricPrinterUDPMetricsGcodeSent, name, metric.GetGauge().GetValue())
+		}
+		if reason := labelValue(metric, "error_reason"); reason != expected[name] {
+			t.Errorf("error_reason of %s = %q, expected %q", name, reason, expected[name])
+		}
+		delete(expected, name)
+	}
+	if len(expected) != 0 {
+		t.Errorf("missing %s for printers %v", MetricPrinterUDPMetricsGcodeSent, expected)
+	}
+}
+
+func TestEnableUDPmetricsMaxConcurrentGcode(t *testing.T) {
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	const limit = 2
+	var active, maxActive atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := active.Add(1)
+		defer active.Add(-1)
+		for {
+			observed := maxActive.Load()
+			if current <= observed || maxActive.CompareAndSwap(observed, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var printers []config.Printers
+	for i := 0; i < 6; i++ {
+		printers = append(printers, config.Printers{Address: strings.TrimPrefix(server.URL, "http://"), Name: fmt.Sprintf("Printer%d", i), Type: "MK4"})
+	}
+
+	cfg := testConfig(printers...)
+	cfg.Exporter.IPOverride = "10.0.0.1"
+	cfg.Exporter.MaxConcurrentGcode = limit
+	SetConfiguration(cfg)
+
+	EnableUDPmetrics(printers)
+
+	for _, printer := range GetConfiguration().Printers {
+		if !printer.UDPMetricsEnabled {
+			t.Errorf("UDP metrics not enabled at %s", printer.Name)
+		}
+	}
+	if maxActive.Load() > limit {
+		t.Errorf("%d requests sent concurrently, expected at most %d", maxActive.Load(), limit)
+	}
+}
+
+func TestReenableStaleUDPmetrics(t *testing.T) {
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	var requestCount int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requestCount, 1)
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	address := strings.TrimPrefix(server.URL, "http://")
+	cfg := testConfig(
+		config.Printers{Address: address, Name: "Rebooted", UDPMetricsEnabled: true, UDPMetricsReason: UDPReasonOK},
+		// gcode was never sent to the printer, e.g. gcode sending is disabled, it is not enabled by the watcher
+		config.Printers{Address: "192.0.2.1", Name: "NotSent", UDPMetricsReason: UDPReasonNotSent},
+	)
+	cfg.Exporter.IPOverride = "10.0.0.1"
+	SetConfiguration(cfg)
+
+	now := time.Now()
+	udpEnableMutex.Lock()
+	udpEnableAttempts[address] = now.Add(-time.Hour) // enabled at startup
+	udpEnableMutex.Unlock()
+	var lastPush time.Time
+	lastPushes := func(ip string) (time.Time, bool) {
+		if ip != "127.0.0.1" {
+			t.Errorf("lastPush() called with %s, expected 127.0.0.1", ip)
+		}
+		return lastPush, true
+	}
+
+	// printer pushes metrics regularly
+	lastPush = now.Add(-time.Minute)
+	reenableStaleUDPmetrics(5*time.Minute, lastPushes, now)
+	if count := atomic.LoadInt32(&requestCount); count != 0 {
+		t.Fatalf("made %d requests to printer with fresh UDP metrics, expected 0", count)
+	}
+
+	// printer rebooted and stopped pushing metrics
+	lastPush = now.Add(-10 * time.Minute)
+	reenableStaleUDPmetrics(5*time.Minute, lastPushes, now)
+	// DELETE, PUT and POST of enabling gcode
+	if count := atomic.LoadInt32(&requestCount); count != 3 {
+		t.Errorf("made %d requests to printer with stale UDP metrics, expected 3", count)
+	}
+	if printer := GetConfiguration().Printers[0]; !printer.UDPMetricsEnabled || printer.UDPMetricsReason != UDPReasonOK {
+		t.Errorf("UDPMetricsEnabled = %t with reason %q after re-enable, expected true with %q", printer.UDPMetricsEnabled, printer.UDPMetricsReason, UDPReasonOK)
+	}
+
+	// printer gets time to start pushing after the re-enable
+	reenableStaleUDPmetrics(5*time.Minute, lastPushes, time.Now().Add(time.Minute))
+	if count := atomic.LoadInt32(&requestCount); count != 3 {
+		t.Errorf("made %d requests right after re-enable, expected 3", count)
+	}
+}
+
+func TestReenableStaleUDPmetricsRetry(t *testing.T) {
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	var requestCount int32
+	var poweredOff atomic.Bool
+	poweredOff.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requestCount, 1)
+		if poweredOff.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	printer := config.Printers{Address: strings.TrimPrefix(server.URL, "http://"), Name: "PowerCycled"}
+	cfg := testConfig(printer)
+	cfg.Exporter.IPOverride = "10.0.0.1"
+	SetConfiguration(cfg)
+
+	neverPushed := func(string) (time.Time, bool) { return time.Time{}, false }
+	threshold := 5 * time.Minute
+
+	// printer is powered off at startup, enabling fails
+	enablePrinterUDPmetrics(0, printer)
+	if GetConfiguration().Printers[0].UDPMetricsEnabled {
+		t.Fatalf("UDPMetricsEnabled = true with printer powered off")
+	}
+
+	// first re-enable fails as well
+	reenableStaleUDPmetrics(threshold, neverPushed, time.Now().Add(threshold+time.Minute))
+	failedRequests := atomic.LoadInt32(&requestCount)
+	if failedRequests < 2 {
+		t.Fatalf("made %d requests, expected failed startup attempt and re-enable", failedRequests)
+	}
+
+	// retries are backed off after consecutive failures
+	poweredOff.Store(false)
+	reenableStaleUDPmetrics(threshold, neverPushed, time.Now().Add(threshold+time.Minute))
+	if count := atomic.LoadInt32(&requestCount); count != failedRequests {
+		t.Errorf("made %d requests before backoff passed, expected %d", count, failedRequests)
+	}
+
+	// next tick after the backoff succeeds
+	reenableStaleUDPmetrics(threshold, neverPushed, time.Now().Add(2*threshold+time.Minute))
+	if printer := GetConfiguration().Printers[0]; !printer.UDPMetricsEnabled || printer.UDPMetricsReason != UDPReasonOK {
+		t.Errorf("UDPMetricsEnabled = %t with reason %q after printer powered on, expected true with %q", printer.UDPMetricsEnabled, printer.UDPMetricsReason, UDPReasonOK)
+	}
+}
+
+func TestReenableBackoff(t *testing.T) {
+	threshold := 5 * time.Minute
+	for failures, expected := range map[int]time.Duration{0: threshold, 1: threshold, 2: 2 * threshold, 3: 4 * threshold, 10: udpReenableMaxBackoff} {
+		if backoff := reenableBackoff(threshold, failures); backoff != expected {
+			t.Errorf("reenableBackoff(%s, %d) = %s, expected %s", threshold, failures, backoff, expected)
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	cfg := testConfig(
+		config.Printers{Address: "192.168.1.100", Name: "Garage", Type: "MK4", Labels: map[string]string{"room": "garage"}},
+		config.Printers{Address: "192.168.1.101", Name: "Office", Labels: map[string]string{"room": "office"}},
+	)
+	cfg.Exporter.IPOverride = "10.0.0.1"
+	cfg.Exporter.ExtraMetrics = []string{"crash"}
+	cfg.Exporter.AuditLog = filepath.Join(t.TempDir(), "audit.log")
+	SetConfiguration(config.Config{})
+
+	var output strings.Builder
+	if err := DryRun(&output, cfg); err != nil {
+		t.Fatalf("DryRun() error: %v", err)
+	}
+
+	// dry run must not have side effects
+	if _, err := os.Stat(cfg.Exporter.AuditLog); !os.IsNotExist(err) {
+		t.Errorf("DryRun() created audit log %s", cfg.Exporter.AuditLog)
+	}
+	if len(GetConfiguration().Printers) != 0 {
+		t.Errorf("DryRun() changed global configuration")
+	}
+
+	for _, expected := range []string{
+		"# printer Garage (192.168.1.100)",
+		"# labels: printer_address=192.168.1.100, printer_model=MK4, printer_name=Garage, printer_job_name=, printer_job_path=, room=garage",
+		"printer_model=<detected at runtime>, printer_name=Office",
+		"M334 10.0.0.1 8514",
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("DryRun() output does not contain %q:\n%s", expected, output.String())
+		}
+	}
+
+	// extra metrics are added once per printer, not accumulated across printers
+	if count := strings.Count(output.String(), "M331 crash"); count != 2 {
+		t.Errorf("DryRun() output contains M331 crash %d times, expected 2", count)
+	}
+}
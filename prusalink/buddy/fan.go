@@ -0,0 +1,56 @@
+package prusalink
+
+const (
+	// fanStoppedRPM is the speed below which the fan is considered stopped
+	fanStoppedRPM = 100
+	// fanFailureScrapes is the number of consecutive scrapes with stopped fan before it is reported as failed
+	fanFailureScrapes = 3
+	// hotendFanTemp is the nozzle temperature above which the firmware always runs the hotend fan
+	hotendFanTemp = 50
+)
+
+// fan is the actual and commanded speed of the printer fan
+type fan struct {
+	name      string
+	actual    float64
+	target    *float64 // nil when firmware does not report commanded speed
+	monitored bool     // false when it is not known whether the fan should spin
+	commanded bool
+}
+
+// getFans returns actual and commanded speed of hotend and print fan. PrusaLink does not report commanded
+// fan speeds yet, target_fan_hotend and target_fan_print are used once firmware reports them. Until then
+// hotend fan is commanded by nozzle temperature, as the firmware runs it whenever the nozzle is hot,
+// and print fan, driven by the gcode, is not monitored.
+func getFans(status Status) []fan {
+	hotend := fan{name: "hotend", actual: status.Printer.FanHotend, target: status.Printer.TargetFanHotend, monitored: true}
+	if hotend.target != nil {
+		hotend.commanded = *hotend.target > 0
+	} else {
+		hotend.commanded = status.Printer.TempNozzle >= hotendFanTemp
+	}
+
+	printFan := fan{name: "print", actual: status.Printer.FanPrint, target: status.Printer.TargetFanPrint}
+	if printFan.target != nil {
+		printFan.monitored = true
+		printFan.commanded = *printFan.target > 0
+	}
+
+	return []fan{hotend, printFan}
+}
+
+// updateFanStall counts consecutive scrapes with the fan commanded to spin but stopped and returns
+// whether the fan is considered failed. A single scrape with running or idle fan resets the count.
+func (c *Collector) updateFanStall(address string, f fan) bool {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+
+	key := address + "/" + f.name
+	if !f.monitored || !f.commanded || f.actual >= fanStoppedRPM {
+		delete(c.fanStalls, key)
+		return false
+	}
+
+	c.fanStalls[key]++
+	return c.fanStalls[key] >= fanFailureScrapes
+}
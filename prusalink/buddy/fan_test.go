@@ -0,0 +1,109 @@
+package prusalink
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pstrobl96/prusa_exporter/config"
+)
+
+func TestCollectorFanFailure(t *testing.T) {
+	const (
+		stalled = `{"printer":{"state":"PRINTING","fan_hotend":3000,"fan_print":0,"target_fan_hotend":3000,"target_fan_print":5000}}`
+		running = `{"printer":{"state":"PRINTING","fan_hotend":3000,"fan_print":4900,"target_fan_hotend":3000,"target_fan_print":5000}}`
+	)
+
+	var statusBody atomic.Value
+	statusBody.Store(stalled)
+
+	responses := defaultPrinterResponses()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.URL.Path]
+		if r.URL.Path == "/api/v1/status" {
+			body = statusBody.Load().(string)
+		} else if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	collector := NewCollector(testConfig(config.Printers{Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4"}))
+
+	fanFailures := func() map[string]float64 {
+		failures := map[string]float64{}
+		for _, metric := range gatherMetrics(t, collector)[MetricPrinterFanFailure].GetMetric() {
+			failures[labelValue(metric, "fan")] = metric.GetGauge().GetValue()
+		}
+		return failures
+	}
+
+	// transient stall is not reported
+	for scrape := 1; scrape < fanFailureScrapes; scrape++ {
+		if failures := fanFailures(); failures["print"] != 0 || failures["hotend"] != 0 {
+			t.Fatalf("scrape %d: fan failures = %v, expected none", scrape, failures)
+		}
+	}
+
+	if failures := fanFailures(); failures["print"] != 1 || failures["hotend"] != 0 {
+		t.Errorf("fan failures = %v after %d stalled scrapes, expected print fan failure", failures, fanFailureScrapes)
+	}
+
+	statusBody.Store(running)
+	if failures := fanFailures(); failures["print"] != 0 {
+		t.Errorf("fan failures = %v after fan recovered, expected none", failures)
+	}
+
+	// print fan is not monitored when firmware does not report commanded speed
+	statusBody.Store(`{"printer":{"state":"PRINTING","temp_nozzle":25,"fan_hotend":0,"fan_print":0}}`)
+	if failures := fanFailures(); len(failures) != 1 || failures["hotend"] != 0 {
+		t.Errorf("fan failures = %v without commanded fan speed, expected only hotend fan without failure", failures)
+	}
+
+	// hotend fan is commanded by nozzle temperature when firmware does not report commanded speed
+	statusBody.Store(`{"printer":{"state":"PRINTING","temp_nozzle":215,"fan_hotend":0,"fan_print":0}}`)
+	for scrape := 1; scrape < fanFailureScrapes; scrape++ {
+		fanFailures()
+	}
+	if failures := fanFailures(); failures["hotend"] != 1 {
+		t.Errorf("fan failures = %v with hot nozzle and stopped hotend fan, expected hotend fan failure", failures)
+	}
+}
+
+func TestCollectorFanTarget(t *testing.T) {
+	responses := defaultPrinterResponses()
+	responses["/api/v1/status"] = `{"printer":{"state":"PRINTING","fan_hotend":2900,"fan_print":1200,"target_fan_hotend":3000,"target_fan_print":5000}}`
+	server := newMockPrinter(t, responses)
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	collector := NewCollector(testConfig(config.Printers{Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4"}))
+
+	fanSpeeds := func(name string) map[string]float64 {
+		speeds := map[string]float64{}
+		for _, metric := range gatherMetrics(t, collector)[name].GetMetric() {
+			speeds[labelValue(metric, "fan")] = metric.GetGauge().GetValue()
+		}
+		return speeds
+	}
+
+	if actual := fanSpeeds(MetricPrinterFanSpeedRpm); actual["hotend"] != 2900 || actual["print"] != 1200 {
+		t.Errorf("%s = %v, expected hotend 2900 and print 1200", MetricPrinterFanSpeedRpm, actual)
+	}
+	if target := fanSpeeds(MetricPrinterFanTargetRpm); len(target) != 2 || target["hotend"] != 3000 || target["print"] != 5000 {
+		t.Errorf("%s = %v, expected hotend 3000 and print 5000", MetricPrinterFanTargetRpm, target)
+	}
+
+	// targets are not reported when firmware does not report commanded speed
+	responses["/api/v1/status"] = `{"printer":{"state":"PRINTING","fan_hotend":2900,"fan_print":1200}}`
+	if target := fanSpeeds(MetricPrinterFanTargetRpm); len(target) != 0 {
+		t.Errorf("%s = %v without commanded fan speed, expected no metric", MetricPrinterFanTargetRpm, target)
+	}
+}
@@ -0,0 +1,48 @@
+package prusalink
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// scrapeTimeoutHeader is set by Prometheus to the scrape timeout in seconds
+const scrapeTimeoutHeader = "X-Prometheus-Scrape-Timeout-Seconds"
+
+// contextCollector collects the collector with the context of a single scrape request
+type contextCollector struct {
+	collector *Collector
+	ctx       context.Context
+}
+
+// Describe implements prometheus.Collector
+func (c contextCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.collector.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (c contextCollector) Collect(ch chan<- prometheus.Metric) {
+	c.collector.CollectContext(c.ctx, ch)
+}
+
+// Handler returns metrics handler serving the collector along with metrics of gatherer. Requests to printers
+// are aborted when the scrape request is cancelled or when the scrape timeout sent by Prometheus expires.
+func (c *Collector) Handler(gatherer prometheus.Gatherer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if seconds, err := strconv.ParseFloat(r.Header.Get(scrapeTimeoutHeader), 64); err == nil && seconds > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, time.Duration(seconds*float64(time.Second)))
+			defer cancel()
+		}
+
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(contextCollector{collector: c, ctx: ctx})
+		// prometheus.Desc has no unit and promhttp does not write # UNIT, units are declared by metric name suffixes only
+		promhttp.HandlerFor(prometheus.Gatherers{gatherer, registry}, promhttp.HandlerOpts{EnableOpenMetrics: true}).ServeHTTP(w, r)
+	})
+}
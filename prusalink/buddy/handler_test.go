@@ -0,0 +1,48 @@
+package prusalink
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pstrobl96/prusa_exporter/config"
+)
+
+func TestCollectorHandlerScrapeTimeout(t *testing.T) {
+	release := make(chan struct{})
+	slowPrinter := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer slowPrinter.Close()
+	defer close(release)
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	cfg := testConfig(config.Printers{Address: printerAddress(slowPrinter), Apikey: "test_api_key", Type: "MK4"})
+	cfg.Exporter.ScrapeTimeout = 10
+	handler := NewCollector(cfg).Handler(prometheus.NewRegistry())
+
+	req := httptest.NewRequest("GET", "/metrics/prusalink", nil)
+	req.Header.Set(scrapeTimeoutHeader, "0.2")
+	recorder := httptest.NewRecorder()
+
+	start := time.Now()
+	handler.ServeHTTP(recorder, req)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("scrape took %s, expected requests to the printer aborted after scrape timeout", elapsed)
+	}
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("handler status = %d, expected 200", recorder.Code)
+	}
+	if !strings.Contains(recorder.Body.String(), MetricPrinterUp+"{") {
+		t.Errorf("response does not contain %s:\n%s", MetricPrinterUp, recorder.Body.String())
+	}
+}
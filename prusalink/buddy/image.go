@@ -2,14 +2,39 @@ package prusalink
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
+
+	"github.com/pstrobl96/prusa_exporter/config"
+	"github.com/rs/zerolog/log"
+)
+
+// Sizes of job thumbnails pushed to Loki
+const (
+	ImageSizeSmall = "small"
+	ImageSizeLarge = "large"
+)
+
+const (
+	lokiPushAttempts = 3
+	// lokiPushTimeout bounds all attempts of a single push, so persistent outage does not pile up goroutines
+	lokiPushTimeout = 30 * time.Second
+	// lokiQueueSize is the number of job images waiting for the push, further images are dropped
+	lokiQueueSize = 16
 )
 
+// lokiRetryDelay is the delay before the first retry, doubled with each following retry
+var lokiRetryDelay = 500 * time.Millisecond
+
 // PushImageToLoki pushes a base64-encoded job image to Grafana Loki as a log entry.
-func PushImageToLoki(lokiURL, printerAddress, printerModel, printerName, printerJobName, printerJobPath, image string) error {
+// Network errors and 5xx responses are retried with exponential backoff until ctx is done.
+func PushImageToLoki(ctx context.Context, lokiURL, printerAddress, printerModel, printerName, printerJobName, printerJobPath, image string) error {
 	// Prepare the log line with base64 image
 	logLine := map[string]interface{}{
 		"streams": []map[string]interface{}{
@@ -37,22 +62,110 @@ func PushImageToLoki(lokiURL, printerAddress, printerModel, printerName, printer
 		return fmt.Errorf("failed to marshal log line: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", lokiURL, bytes.NewBuffer(payload))
+	compress := GetConfiguration().Exporter.LokiCompress
+	if compress {
+		if payload, err = gzipPayload(payload); err != nil {
+			return fmt.Errorf("failed to compress log line: %w", err)
+		}
+	}
+
+	delay := lokiRetryDelay
+	for attempt := 1; ; attempt++ {
+		retry, err := sendToLoki(ctx, lokiURL, payload, compress)
+		if err == nil || !retry || attempt == lokiPushAttempts {
+			return err
+		}
+
+		log.Debug().Msgf("Loki push attempt %d failed, retrying in %s - %s", attempt, delay, err.Error())
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("giving up pushing to Loki: %w", err)
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// CheckLokiReady requests the readiness endpoint of Loki the push URL belongs to
+func CheckLokiReady(ctx context.Context, lokiURL string) error {
+	readyURL := strings.TrimSuffix(lokiURL, config.LokiPushPath) + "/ready"
+	req, err := http.NewRequestWithContext(ctx, "GET", readyURL, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach Loki: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("loki is not ready: %s", resp.Status)
+	}
+	return nil
+}
+
+// LokiPushURLs returns distinct push URLs job images of enabled printers are pushed to, per-printer URL
+// takes precedence over the URL of the exporter
+func LokiPushURLs(cfg config.Config) []string {
+	var urls []string
+	for _, printer := range cfg.Printers {
+		url := printer.LokiPushURL
+		if url == "" {
+			url = cfg.Exporter.LokiPushURL
+		}
+		if url != "" && printer.IsEnabled() && !slices.Contains(urls, url) {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+// gzipPayload returns gzip compressed payload
+func gzipPayload(payload []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// sendToLoki sends the payload to Loki once and returns whether failed request should be retried
+func sendToLoki(ctx context.Context, lokiURL string, payload []byte, compressed bool) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", lokiURL, bytes.NewBuffer(payload))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
 	req.Header.Set("Content-Type", "application/json")
+	if compressed {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	cfg := GetConfiguration()
+	if cfg.Exporter.LokiUsername != "" || cfg.Exporter.LokiPassword != "" {
+		req.SetBasicAuth(cfg.Exporter.LokiUsername, cfg.Exporter.LokiPassword)
+	}
+	if cfg.Exporter.LokiTenant != "" {
+		req.Header.Set("X-Scope-OrgID", cfg.Exporter.LokiTenant)
+	}
 
 	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send request to Loki: %w", err)
+		return ctx.Err() == nil, fmt.Errorf("failed to send request to Loki: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 300 {
-		return fmt.Errorf("loki returned status: %s", resp.Status)
+		return resp.StatusCode >= 500, fmt.Errorf("loki returned status: %s", resp.Status)
 	}
 
-	return nil
+	return false, nil
 }
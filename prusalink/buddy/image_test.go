@@ -0,0 +1,501 @@
+package prusalink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/pstrobl96/prusa_exporter/config"
+)
+
+func TestPushImageToLokiAuth(t *testing.T) {
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header.Clone()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	t.Run("Anonymous", func(t *testing.T) {
+		SetConfiguration(testConfig())
+
+		if err := PushImageToLoki(context.Background(), server.URL, "192.168.1.100", "MK4", "printer", "job", "/usb/job.bgcode", "aW1hZ2U="); err != nil {
+			t.Fatalf("PushImageToLoki() error: %v", err)
+		}
+		if headers.Get("Authorization") != "" || headers.Get("X-Scope-OrgID") != "" {
+			t.Errorf("anonymous push sent Authorization %q and X-Scope-OrgID %q", headers.Get("Authorization"), headers.Get("X-Scope-OrgID"))
+		}
+	})
+
+	t.Run("BasicAuthAndTenant", func(t *testing.T) {
+		cfg := testConfig()
+		cfg.Exporter.LokiUsername = "user"
+		cfg.Exporter.LokiPassword = "pass"
+		cfg.Exporter.LokiTenant = "tenant1"
+		SetConfiguration(cfg)
+
+		if err := PushImageToLoki(context.Background(), server.URL, "192.168.1.100", "MK4", "printer", "job", "/usb/job.bgcode", "aW1hZ2U="); err != nil {
+			t.Fatalf("PushImageToLoki() error: %v", err)
+		}
+		if headers.Get("Authorization") != "Basic dXNlcjpwYXNz" {
+			t.Errorf("Authorization = %q, expected basic auth of user:pass", headers.Get("Authorization"))
+		}
+		if headers.Get("X-Scope-OrgID") != "tenant1" {
+			t.Errorf("X-Scope-OrgID = %q, expected tenant1", headers.Get("X-Scope-OrgID"))
+		}
+	})
+}
+
+func TestCollectorLokiPushCounters(t *testing.T) {
+	responses := []int{http.StatusNoContent, http.StatusBadRequest}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(responses[0])
+		responses = responses[1:]
+	}))
+	defer server.Close()
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	cfg := testConfig()
+	cfg.Exporter.LokiPushURL = server.URL
+	collector := NewCollector(cfg)
+
+	printer := config.Printers{Address: "192.168.1.100", Type: "MK4", Name: "printer"}
+	collector.pushJobImage(printer, Job{}, "aW1hZ2U=")
+	collector.pushJobImage(printer, Job{}, "aW1hZ2U=")
+
+	if value := testutil.ToFloat64(collector.lokiPushes); value != 1 {
+		t.Errorf("prusa_loki_pushes_total = %v, expected 1", value)
+	}
+	if value := testutil.ToFloat64(collector.lokiPushFailures); value != 1 {
+		t.Errorf("prusa_loki_push_failures_total = %v, expected 1", value)
+	}
+}
+
+func TestCollectorLokiPushURLOverride(t *testing.T) {
+	var globalPushes, printerPushes atomic.Int32
+	global := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		globalPushes.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer global.Close()
+	override := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		printerPushes.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer override.Close()
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	cfg := testConfig()
+	cfg.Exporter.LokiPushURL = global.URL
+	collector := NewCollector(cfg)
+
+	collector.pushJobImage(config.Printers{Address: "192.168.1.100", Type: "MK4", LokiPushURL: override.URL}, Job{}, "aW1hZ2U=")
+	if printerPushes.Load() != 1 || globalPushes.Load() != 0 {
+		t.Errorf("printer with override pushed %d times to its URL and %d times to global URL, expected 1 and 0", printerPushes.Load(), globalPushes.Load())
+	}
+
+	collector.pushJobImage(config.Printers{Address: "192.168.1.101", Type: "MK4"}, Job{}, "aW1hZ2U=")
+	if globalPushes.Load() != 1 {
+		t.Errorf("printer without override pushed %d times to global URL, expected 1", globalPushes.Load())
+	}
+}
+
+func TestCollectorLokiPushQueue(t *testing.T) {
+	release := make(chan struct{})
+	var lokiRequests atomic.Int32
+	loki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lokiRequests.Add(1)
+		<-release // Loki is stuck
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer loki.Close()
+	defer close(release)
+
+	var thumbnail bytes.Buffer
+	png.Encode(&thumbnail, image.NewGray(image.Rect(0, 0, 1, 1)))
+
+	responses := defaultPrinterResponses()
+	responses["/api/job"] = `{"state":"Printing","job":{"file":{"name":"first.bgcode","path":"/usb/first.bgcode"}}}`
+	responses["/api/printer"] = `{"state":{"text":"Printing","flags":{"printing":true}}}`
+	printer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/thumb/l/") {
+			w.Write(thumbnail.Bytes())
+			return
+		}
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer printer.Close()
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	cfg := testConfig(config.Printers{Address: printerAddress(printer), Apikey: "test_api_key", Type: "MK4"})
+	cfg.Exporter.LokiPushURL = loki.URL
+	collector := NewCollector(cfg)
+
+	start := time.Now()
+	gatherMetrics(t, collector)
+	for lokiRequests.Load() == 0 && time.Since(start) < 5*time.Second {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if lokiRequests.Load() == 0 {
+		t.Fatal("job image was not pushed to Loki")
+	}
+
+	// the worker is blocked by Loki, following scrapes are not delayed
+	responses["/api/job"] = `{"state":"Printing","job":{"file":{"name":"second.bgcode","path":"/usb/second.bgcode"}}}`
+	start = time.Now()
+	gatherMetrics(t, collector)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("scrape with blocked Loki took %v, expected it not to wait for the push", elapsed)
+	}
+
+	// queued pushes above the queue size are dropped
+	for range lokiQueueSize {
+		collector.queueJobImage(cfg.Printers[0], Job{})
+	}
+	if value := testutil.ToFloat64(collector.lokiPushDrops); value != 1 {
+		t.Errorf("prusa_loki_pushes_dropped_total = %v, expected 1", value)
+	}
+}
+
+func TestGetJobImageSize(t *testing.T) {
+	var thumbnail bytes.Buffer
+	png.Encode(&thumbnail, image.NewGray(image.Rect(0, 0, 1, 1)))
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+	SetConfiguration(testConfig())
+
+	tests := []struct {
+		name      string
+		size      string
+		available []string
+		expected  []string
+	}{
+		{"Large", ImageSizeLarge, []string{"/thumb/s/usb/job.bgcode", "/thumb/l/usb/job.bgcode"}, []string{"/thumb/l/usb/job.bgcode"}},
+		{"Small", ImageSizeSmall, []string{"/thumb/s/usb/job.bgcode", "/thumb/l/usb/job.bgcode"}, []string{"/thumb/s/usb/job.bgcode"}},
+		{"Large fallback", ImageSizeLarge, []string{"/thumb/s/usb/job.bgcode"}, []string{"/thumb/l/usb/job.bgcode", "/thumb/s/usb/job.bgcode"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requested []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requested = append(requested, r.URL.Path)
+				if !slices.Contains(tt.available, r.URL.Path) {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Write(thumbnail.Bytes())
+			}))
+			defer server.Close()
+
+			printer := config.Printers{Address: printerAddress(server), Apikey: "test_api_key"}
+			encoded, err := GetJobImage(context.Background(), printer, "/usb/job.bgcode", tt.size)
+			if err != nil || encoded == "" {
+				t.Fatalf("GetJobImage() = %q, %v, expected image", encoded, err)
+			}
+			if !slices.Equal(requested, tt.expected) {
+				t.Errorf("GetJobImage() requested %v, expected %v", requested, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetJobImageTimeout(t *testing.T) {
+	var thumbnail bytes.Buffer
+	png.Encode(&thumbnail, image.NewGray(image.Rect(0, 0, 1, 1)))
+
+	mock := newMockPrinter(t, defaultPrinterResponses())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/thumb/") {
+			time.Sleep(1500 * time.Millisecond)
+			w.Write(thumbnail.Bytes())
+			return
+		}
+		mock.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	// other requests time out after 1 second, image has more time
+	printer := config.Printers{Address: printerAddress(server), Apikey: "test_api_key", Timeout: 1}
+	cfg := testConfig(printer)
+	cfg.Exporter.ImageTimeout = 5
+	SetConfiguration(cfg)
+
+	imageErr := make(chan error, 1)
+	go func() {
+		_, err := GetJobImage(context.Background(), printer, "/usb/job.bgcode", ImageSizeLarge)
+		imageErr <- err
+	}()
+
+	start := time.Now()
+	if _, err := GetStatus(context.Background(), printer); err != nil {
+		t.Errorf("GetStatus() error while job image is fetched: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("GetStatus() took %s while job image is fetched", elapsed)
+	}
+	if err := <-imageErr; err != nil {
+		t.Errorf("GetJobImage() error: %v, expected image fetched within its own timeout", err)
+	}
+}
+
+func TestJobImageTimeout(t *testing.T) {
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	tests := []struct {
+		name           string
+		imageTimeout   int
+		printerTimeout int
+		expected       time.Duration
+	}{
+		{"image timeout", 60, 0, 60 * time.Second},
+		{"shorter printer override", 60, 10, 60 * time.Second},
+		{"longer printer override", 60, 120, 120 * time.Second},
+		{"no image timeout", 0, 0, 5 * time.Second},
+		{"no image timeout with printer override", 0, 10, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			printer := config.Printers{Address: "192.168.1.100", Timeout: tt.printerTimeout}
+			cfg := testConfig(printer)
+			cfg.Exporter.ImageTimeout = tt.imageTimeout
+			SetConfiguration(cfg)
+
+			if timeout := jobImageTimeout(printer); timeout != tt.expected {
+				t.Errorf("jobImageTimeout() = %s, expected %s", timeout, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPushImageToLokiRetry(t *testing.T) {
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+	SetConfiguration(testConfig())
+
+	originalDelay := lokiRetryDelay
+	defer func() { lokiRetryDelay = originalDelay }()
+	lokiRetryDelay = time.Millisecond
+
+	tests := []struct {
+		name             string
+		responses        []int
+		expectError      bool
+		expectedAttempts int32
+	}{
+		{"Fails twice then succeeds", []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusNoContent}, false, 3},
+		{"Persistent outage", []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusNoContent}, true, 3},
+		{"Client error is not retried", []int{http.StatusBadRequest, http.StatusNoContent}, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.responses[attempts.Add(1)-1])
+			}))
+			defer server.Close()
+
+			err := PushImageToLoki(context.Background(), server.URL, "192.168.1.100", "MK4", "printer", "job", "/usb/job.bgcode", "aW1hZ2U=")
+			if (err != nil) != tt.expectError {
+				t.Errorf("PushImageToLoki() error = %v, expected error %t", err, tt.expectError)
+			}
+			if attempts.Load() != tt.expectedAttempts {
+				t.Errorf("PushImageToLoki() made %d attempts, expected %d", attempts.Load(), tt.expectedAttempts)
+			}
+		})
+	}
+
+	t.Run("Context deadline", func(t *testing.T) {
+		lokiRetryDelay = time.Hour
+		defer func() { lokiRetryDelay = time.Millisecond }()
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		if err := PushImageToLoki(ctx, server.URL, "192.168.1.100", "MK4", "printer", "job", "/usb/job.bgcode", "aW1hZ2U="); err == nil {
+			t.Error("PushImageToLoki() expected error after context deadline")
+		}
+		if time.Since(start) > time.Second {
+			t.Errorf("PushImageToLoki() did not respect context deadline, took %s", time.Since(start))
+		}
+	})
+}
+
+func TestCollectorUpdatePrinterState(t *testing.T) {
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	collector := NewCollector(testConfig())
+
+	var first, second Job
+	first.Job.File.Path = "/usb/first.bgcode"
+	second.Job.File.Path = "/usb/second.bgcode"
+
+	// idle, first job printing for three scrapes with a pause, finished, idle, then the second job
+	sequence := []struct {
+		state float64
+		job   Job
+	}{
+		{1, Job{}},
+		{4, first}, {4, first}, {3, first}, {4, first},
+		{12, first}, {12, first},
+		{1, Job{}},
+		{4, second}, {4, second},
+	}
+
+	pushes := 0
+	for _, step := range sequence {
+		if collector.updatePrinterState("192.168.1.100", step.state, step.job) {
+			pushes++
+		}
+	}
+
+	// start and finish of the first job, start of the second job
+	if pushes != 3 {
+		t.Errorf("updatePrinterState() requested %d pushes, expected 3", pushes)
+	}
+
+	// the same file printed again is a new job
+	collector.updatePrinterState("192.168.1.100", 1, Job{})
+	if !collector.updatePrinterState("192.168.1.100", 4, second) {
+		t.Error("updatePrinterState() did not request push for reprinted job")
+	}
+}
+
+func TestPushImageToLokiCompress(t *testing.T) {
+	var (
+		headers http.Header
+		body    []byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	cfg := testConfig()
+	cfg.Exporter.LokiCompress = true
+	SetConfiguration(cfg)
+
+	if err := PushImageToLoki(context.Background(), server.URL, "192.168.1.100", "MK4", "printer", "job", "/usb/job.bgcode", "aW1hZ2U="); err != nil {
+		t.Fatalf("PushImageToLoki() error: %v", err)
+	}
+
+	if headers.Get("Content-Encoding") != "gzip" {
+		t.Errorf("Content-Encoding = %q, expected gzip", headers.Get("Content-Encoding"))
+	}
+	if headers.Get("Content-Type") != "application/json" {
+		t.Errorf("Content-Type = %q, expected application/json", headers.Get("Content-Type"))
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error: %v", err)
+	}
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed to decompress body: %v", err)
+	}
+
+	var push struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][]string        `json:"values"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(decompressed, &push); err != nil {
+		t.Fatalf("json.Unmarshal() error: %v", err)
+	}
+	if len(push.Streams) != 1 || push.Streams[0].Stream["printer_job_path"] != "/usb/job.bgcode" || push.Streams[0].Values[0][1] != "aW1hZ2U=" {
+		t.Errorf("decompressed body = %s, expected push of the job image", decompressed)
+	}
+}
+
+func TestCheckLokiReady(t *testing.T) {
+	var ready atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ready" {
+			t.Errorf("requested %s, expected /ready", r.URL.Path)
+		}
+		if !ready.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ready"))
+	}))
+	defer server.Close()
+
+	pushURL := server.URL + config.LokiPushPath
+	if err := CheckLokiReady(context.Background(), pushURL); err == nil {
+		t.Error("CheckLokiReady() expected error while Loki is not ready")
+	}
+
+	ready.Store(true)
+	if err := CheckLokiReady(context.Background(), pushURL); err != nil {
+		t.Errorf("CheckLokiReady() error: %v", err)
+	}
+}
+
+func TestLokiPushURLs(t *testing.T) {
+	disabled := false
+	cfg := testConfig(
+		config.Printers{Address: "192.168.1.100"},
+		config.Printers{Address: "192.168.1.101", LokiPushURL: "http://loki-b:3100/loki/api/v1/push"},
+		config.Printers{Address: "192.168.1.102", LokiPushURL: "http://loki-b:3100/loki/api/v1/push"},
+		config.Printers{Address: "192.168.1.103", LokiPushURL: "http://loki-c:3100/loki/api/v1/push", Enabled: &disabled},
+	)
+
+	expected := []string{"http://loki-b:3100/loki/api/v1/push"}
+	if urls := LokiPushURLs(cfg); !slices.Equal(urls, expected) {
+		t.Errorf("LokiPushURLs() = %v without global URL, expected %v", urls, expected)
+	}
+
+	cfg.Exporter.LokiPushURL = "http://loki:3100/loki/api/v1/push"
+	expected = []string{"http://loki:3100/loki/api/v1/push", "http://loki-b:3100/loki/api/v1/push"}
+	if urls := LokiPushURLs(cfg); !slices.Equal(urls, expected) {
+		t.Errorf("LokiPushURLs() = %v, expected %v", urls, expected)
+	}
+}
@@ -0,0 +1,77 @@
+package prusalink
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBedInstabilityWindow    = 5 * time.Minute
+	defaultBedInstabilityThreshold = 2.0 // celsius
+)
+
+// temperatureSample is a deviation of the temperature from its target at the time of the scrape
+type temperatureSample struct {
+	time      time.Time
+	deviation float64
+}
+
+// instabilityTracker remembers temperature deviations from target of printers over a sliding window
+type instabilityTracker struct {
+	window    time.Duration
+	threshold float64
+	samples   map[string][]temperatureSample // keyed by printer address
+	mutex     sync.Mutex
+}
+
+func newInstabilityTracker(window time.Duration, threshold float64) *instabilityTracker {
+	if window <= 0 {
+		window = defaultBedInstabilityWindow
+	}
+	if threshold <= 0 {
+		threshold = defaultBedInstabilityThreshold
+	}
+	return &instabilityTracker{window: window, threshold: threshold, samples: map[string][]temperatureSample{}}
+}
+
+// observe records the temperature while printing, history is dropped when the printer stops printing
+// or the target is not set, so heating up before the print does not count as instability
+func (i *instabilityTracker) observe(address string, now time.Time, printing bool, actual, target float64) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if !printing || target <= 0 {
+		delete(i.samples, address)
+		return
+	}
+
+	samples := append(i.samples[address], temperatureSample{time: now, deviation: actual - target})
+	windowStart := now.Add(-i.window)
+	for len(samples) > 0 && samples[0].time.Before(windowStart) {
+		samples = samples[1:]
+	}
+	i.samples[address] = samples
+}
+
+// instability returns root mean square deviation of the temperature from its target within the window
+func (i *instabilityTracker) instability(address string) float64 {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	samples := i.samples[address]
+	if len(samples) == 0 {
+		return 0
+	}
+
+	var sum float64
+	for _, sample := range samples {
+		sum += sample.deviation * sample.deviation
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+// unstable returns true if the instability exceeds the threshold
+func (i *instabilityTracker) unstable(address string) bool {
+	return i.instability(address) > i.threshold
+}
@@ -0,0 +1,40 @@
+package prusalink
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBedInstability(t *testing.T) {
+	tracker := newInstabilityTracker(time.Minute, 2)
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// stable bed within half a degree of the target
+	for i, actual := range []float64{60.5, 59.5, 60.5, 59.5} {
+		tracker.observe("192.168.1.100", start.Add(time.Duration(i)*10*time.Second), true, actual, 60)
+	}
+	if value := tracker.instability("192.168.1.100"); value != 0.5 {
+		t.Errorf("instability() of stable bed = %v, expected 0.5", value)
+	}
+	if tracker.unstable("192.168.1.100") {
+		t.Error("unstable() = true for stable bed")
+	}
+
+	// failing heater oscillating by 4 degrees pushes stable samples out of the window
+	for i, actual := range []float64{56, 64, 56, 64, 56, 64, 56} {
+		tracker.observe("192.168.1.100", start.Add(time.Minute+time.Duration(i)*10*time.Second), true, actual, 60)
+	}
+	if value := tracker.instability("192.168.1.100"); math.Abs(value-4) > 1e-9 {
+		t.Errorf("instability() of unstable bed = %v, expected 4", value)
+	}
+	if !tracker.unstable("192.168.1.100") {
+		t.Error("unstable() = false for unstable bed")
+	}
+
+	// history is dropped when the print ends
+	tracker.observe("192.168.1.100", start.Add(3*time.Minute), false, 30, 0)
+	if value := tracker.instability("192.168.1.100"); value != 0 {
+		t.Errorf("instability() after print = %v, expected 0", value)
+	}
+}
@@ -0,0 +1,66 @@
+package prusalink
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// maintenance windows per printer address, printers in maintenance are not scraped
+	maintenance      = map[string]time.Time{}
+	maintenanceMutex sync.RWMutex
+)
+
+// SetMaintenance marks the printer as in maintenance for the given duration
+func SetMaintenance(address string, duration time.Duration) {
+	maintenanceMutex.Lock()
+	defer maintenanceMutex.Unlock()
+	maintenance[address] = time.Now().Add(duration)
+}
+
+// ClearMaintenance ends the maintenance window of the printer
+func ClearMaintenance(address string) {
+	maintenanceMutex.Lock()
+	defer maintenanceMutex.Unlock()
+	delete(maintenance, address)
+}
+
+// InMaintenance returns true if the printer is in an active maintenance window
+func InMaintenance(address string) bool {
+	maintenanceMutex.RLock()
+	defer maintenanceMutex.RUnlock()
+	until, ok := maintenance[address]
+	return ok && time.Now().Before(until)
+}
+
+// MaintenanceHandler starts maintenance of the printer with POST /maintenance?address=<address>&duration=<duration>
+// and ends it with DELETE /maintenance?address=<address>
+func MaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("address")
+	if address == "" {
+		http.Error(w, "missing address parameter", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		duration, err := time.ParseDuration(r.URL.Query().Get("duration"))
+		if err != nil || duration <= 0 {
+			http.Error(w, "invalid duration parameter, expected e.g. 30m", http.StatusBadRequest)
+			return
+		}
+		SetMaintenance(address, duration)
+		log.Info().Msgf("Printer %s in maintenance for %s", address, duration)
+	case http.MethodDelete:
+		ClearMaintenance(address)
+		log.Info().Msgf("Maintenance of printer %s ended", address)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
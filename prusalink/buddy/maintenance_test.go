@@ -0,0 +1,80 @@
+package prusalink
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pstrobl96/prusa_exporter/config"
+)
+
+func TestCollectorMaintenance(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	printer := config.Printers{Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4"}
+	collector := NewCollector(testConfig(printer))
+
+	SetMaintenance(printer.Address, time.Minute)
+	defer ClearMaintenance(printer.Address)
+
+	families := gatherMetrics(t, collector)
+
+	if requests.Load() != 0 {
+		t.Errorf("printer in maintenance was requested %d times, expected 0", requests.Load())
+	}
+	if _, ok := families[MetricPrinterUp]; ok {
+		t.Errorf("%s should not be reported during maintenance", MetricPrinterUp)
+	}
+	if value := families[MetricPrinterMaintenance].GetMetric()[0].GetGauge().GetValue(); value != 1 {
+		t.Errorf("%s = %v, expected 1", MetricPrinterMaintenance, value)
+	}
+
+	ClearMaintenance(printer.Address)
+	families = gatherMetrics(t, collector)
+
+	if value := families[MetricPrinterMaintenance].GetMetric()[0].GetGauge().GetValue(); value != 0 {
+		t.Errorf("%s = %v after maintenance ended, expected 0", MetricPrinterMaintenance, value)
+	}
+	if value := families[MetricPrinterUp].GetMetric()[0].GetGauge().GetValue(); value != 0 {
+		t.Errorf("%s = %v for failing printer, expected 0", MetricPrinterUp, value)
+	}
+}
+
+func TestMaintenanceHandler(t *testing.T) {
+	defer ClearMaintenance("192.168.1.100")
+
+	tests := []struct {
+		method        string
+		query         string
+		expectedCode  int
+		inMaintenance bool
+	}{
+		{http.MethodPost, "address=192.168.1.100&duration=30m", http.StatusNoContent, true},
+		{http.MethodPost, "address=192.168.1.100&duration=soon", http.StatusBadRequest, true},
+		{http.MethodPost, "duration=30m", http.StatusBadRequest, true},
+		{http.MethodDelete, "address=192.168.1.100", http.StatusNoContent, false},
+		{http.MethodGet, "address=192.168.1.100", http.StatusMethodNotAllowed, false},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		MaintenanceHandler(rr, httptest.NewRequest(tt.method, "/maintenance?"+tt.query, nil))
+
+		if rr.Code != tt.expectedCode {
+			t.Errorf("%s %s returned %d, expected %d", tt.method, tt.query, rr.Code, tt.expectedCode)
+		}
+		if InMaintenance("192.168.1.100") != tt.inMaintenance {
+			t.Errorf("%s %s: InMaintenance() = %t, expected %t", tt.method, tt.query, !tt.inMaintenance, tt.inMaintenance)
+		}
+	}
+}
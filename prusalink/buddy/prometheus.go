@@ -1,8 +1,16 @@
 package prusalink
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/pstrobl96/prusa_exporter/config"
@@ -16,6 +24,65 @@ type Collector struct {
 
 	configuration config.Config
 	commonLabels  []string
+	customLabels  []string
+	lengthDivisor float64 // converts lengths reported by the printer in millimeters to the configured unit
+	// nozzle size and axis keep millimeters reported before the length unit was configurable, unless the unit is set
+	nozzleAxisDivisor float64
+
+	// time endpoints returned 404 per printer address, these are not scraped until unsupportedEndpointRetryInterval passes
+	unsupportedEndpoints map[string]map[string]time.Time
+	unsupportedMutex     sync.Mutex
+
+	// limits number of printers scraped concurrently, nil means unlimited
+	scrapeSlots chan struct{}
+
+	// persistent across scrapes, unlike const metrics
+	scrapeLatency    *prometheus.SummaryVec
+	lokiPushes       prometheus.Counter
+	lokiPushFailures prometheus.Counter
+	lokiPushDrops    prometheus.Counter
+	collections      prometheus.Counter
+	scrapes          prometheus.Counter
+	scrapeErrors     *prometheus.CounterVec
+
+	// printer types detected for printers without configured type, keyed by printer address
+	detectedTypes map[string]string
+	detectedMutex sync.Mutex
+
+	// firmware versions last reported by printers and API versions the status is read from, keyed by printer address
+	firmwareVersions map[string]string
+	apiVersions      map[string]string
+	apiChecked       map[string]time.Time // time v1 API was last requested
+	firmwareMutex    sync.Mutex
+
+	// printer states from the previous scrape, paths of jobs with image pushed at print start,
+	// times of the last observed print completion and start of current jobs, keyed by printer address
+	previousStates map[string]float64
+	pushedJobs     map[string]string
+	lastCompleted  map[string]time.Time
+	jobStarts      map[string]jobStart
+	lastSuccess    map[string]time.Time
+	summaries      map[string]printerSummary
+	stateMutex     sync.Mutex
+
+	utilization *utilizationTracker
+
+	bedInstability *instabilityTracker
+
+	backoff *backoffTracker
+
+	// job images waiting to be pushed to Loki, consumed by a single worker started with the first push
+	lokiQueue  chan lokiPush
+	lokiWorker sync.Once
+
+	// number of consecutive scrapes with commanded but stopped fan, keyed by printer address and fan
+	fanStalls map[string]int
+
+	// nil when audit log is not configured
+	audit *auditLog
+
+	// hosts of several printers differing only by port, their printer_address label keeps the port
+	sharedHosts map[string]bool
 }
 
 // MetricName is a type for metric names
@@ -26,8 +93,20 @@ const (
 	MetricPrinterTemp MetricName = "prusa_temperature_celsius"
 	// MetricPrinterTempTarget represents the printer target temperature metric name
 	MetricPrinterTempTarget = "prusa_temperature_target_celsius"
+	// MetricPrinterTempDeviation represents the temperature deviation from target metric name
+	MetricPrinterTempDeviation = "prusa_temperature_deviation_celsius"
+	// MetricPrinterHeaterPWM represents the heater PWM ratio metric name
+	MetricPrinterHeaterPWM = "prusa_heater_pwm_ratio"
 	// MetricPrinterPrintTimeRemaining represents the remaining print time metric name
 	MetricPrinterPrintTimeRemaining = "prusa_printing_time_remaining_seconds"
+	// MetricPrinterEstimatedCompletion represents the estimated print completion timestamp metric name
+	MetricPrinterEstimatedCompletion = "prusa_print_estimated_completion_timestamp"
+	// MetricPrinterPrintStart represents the print start timestamp metric name
+	MetricPrinterPrintStart = "prusa_print_start_timestamp"
+	// MetricPrinterFilePosition represents the print file position metric name
+	MetricPrinterFilePosition = "prusa_print_file_position_bytes"
+	// MetricPrinterFileSize represents the print file size metric name
+	MetricPrinterFileSize = "prusa_print_file_size_bytes"
 	// MetricPrinterPrintProgressRatio represents the print progress ratio metric name
 	MetricPrinterPrintProgressRatio = "prusa_printing_progress_ratio"
 	// MetricPrinterFiles represents the files count metric name
@@ -46,20 +125,139 @@ const (
 	MetricPrinterAxis = "prusa_axis"
 	// MetricPrinterFlow represents the print flow ratio metric name
 	MetricPrinterFlow = "prusa_print_flow_ratio"
+	// MetricPrinterFlowPercent represents the print flow percent metric name
+	MetricPrinterFlowPercent = "prusa_print_flow_percent"
 	// MetricPrinterInfo represents the printer info metric name
 	MetricPrinterInfo = "prusa_info"
 	// MetricPrinterMMU represents the MMU metric name
 	MetricPrinterMMU = "prusa_mmu"
+	// MetricPrinterFilamentSensor represents the filament sensor metric name
+	MetricPrinterFilamentSensor = "prusa_filament_sensor"
+	// MetricPrinterAcceleration represents the print acceleration metric name
+	MetricPrinterAcceleration = "prusa_print_acceleration_mm_s2"
+	// MetricPrinterJerk represents the print jerk metric name
+	MetricPrinterJerk = "prusa_print_jerk_mm_s"
+	// MetricPrinterDoorSensor represents the door sensor metric name
+	MetricPrinterDoorSensor = "prusa_door_sensor"
 	// MetricPrinterFanSpeedRpm represents the fan speed RPM metric name
 	MetricPrinterFanSpeedRpm = "prusa_fan_speed_rpm"
 	// MetricPrinterPrintSpeedRatio represents the print speed ratio metric name
 	MetricPrinterPrintSpeedRatio = "prusa_print_speed_ratio"
+	// MetricPrinterPrintSpeedPercent represents the print speed percent metric name
+	MetricPrinterPrintSpeedPercent = "prusa_print_speed_percent"
 	// MetricPrinterCurrentJob represents the current job metric name
 	MetricPrinterCurrentJob = "prusa_job"
+	// MetricPrinterStateFlag represents the printer state flag metric name
+	MetricPrinterStateFlag = "prusa_state_flag"
+	// MetricPrinterUserInteraction represents the user interaction required metric name
+	MetricPrinterUserInteraction = "prusa_user_interaction_required"
+	// MetricPrinterJobTargetNozzle represents the job intended nozzle temperature metric name
+	MetricPrinterJobTargetNozzle = "prusa_job_target_nozzle_celsius"
+	// MetricPrinterJobTargetBed represents the job intended bed temperature metric name
+	MetricPrinterJobTargetBed = "prusa_job_target_bed_celsius"
+	// MetricPrinterNameMismatch represents the printer name mismatch metric name
+	MetricPrinterNameMismatch = "prusa_name_mismatch"
+	// MetricPrinterLastPrintCompleted represents the last print completion timestamp metric name
+	MetricPrinterLastPrintCompleted = "prusa_last_print_completed_timestamp_seconds"
+	// MetricPrinterUtilization represents the printer utilization ratio metric name
+	MetricPrinterUtilization = "prusa_utilization_ratio"
+	// MetricPrinterBedTempInstability represents the bed temperature instability metric name
+	MetricPrinterBedTempInstability = "prusa_bed_temp_instability"
+	// MetricPrinterBedTempUnstable represents the bed temperature unstable metric name
+	MetricPrinterBedTempUnstable = "prusa_bed_temp_unstable"
+	// MetricPrinterResponseBytes represents the scrape response bytes metric name
+	MetricPrinterResponseBytes = "prusa_scrape_response_bytes_total"
+	// MetricPrinterFanFailure represents the fan failure metric name
+	MetricPrinterFanFailure = "prusa_fan_failure"
+	// MetricPrinterFanTargetRpm represents the commanded fan speed RPM metric name
+	MetricPrinterFanTargetRpm = "prusa_fan_target_rpm"
+	// MetricPrinterLifetimePrints represents the lifetime print count metric name
+	MetricPrinterLifetimePrints = "prusa_lifetime_prints_total"
+	// MetricPrinterLifetimePrintTime represents the lifetime print time metric name
+	MetricPrinterLifetimePrintTime = "prusa_lifetime_print_time_seconds_total"
+	// MetricPrinterLifetimeFilament represents the lifetime filament used metric name
+	MetricPrinterLifetimeFilament = "prusa_lifetime_filament_used_meters_total"
+	// MetricPrinterQueueLength represents the print queue length metric name
+	MetricPrinterQueueLength = "prusa_print_queue_length"
+	// MetricPrinterBedMeshRange represents the bed mesh range metric name
+	MetricPrinterBedMeshRange = "prusa_bed_mesh_range_meters"
+	// MetricPrinterFirmware represents the firmware info metric name
+	MetricPrinterFirmware = "prusa_firmware_info"
+	// MetricPrinterAPIVersion represents the supported API version metric name
+	MetricPrinterAPIVersion = "prusa_api_version_supported"
+	// MetricPrinterCurrentLayer represents the current layer metric name
+	MetricPrinterCurrentLayer = "prusa_print_current_layer"
+	// MetricPrinterTotalLayers represents the total layers metric name
+	MetricPrinterTotalLayers = "prusa_print_total_layers"
+	// MetricPrinterMaintenance represents the printer maintenance metric name
+	MetricPrinterMaintenance = "prusa_maintenance"
 	// MetricPrinterUDPMetricsGcodeSent represents the UDP metrics gcode sent metric name
 	MetricPrinterUDPMetricsGcodeSent = "prusa_udp_metrics_gcode_sent"
+	// MetricPrinterHTTPStatus represents the scrape HTTP status metric name
+	MetricPrinterHTTPStatus = "prusa_scrape_http_status"
+	// MetricActivePrints represents the fleet active prints per origin metric name
+	MetricActivePrints = "prusa_active_prints"
+	// MetricFirmwareVersionCount represents the fleet firmware version count metric name
+	MetricFirmwareVersionCount = "prusa_firmware_version_count"
+	// MetricPrinterHeartbeat represents the printer heartbeat metric name
+	MetricPrinterHeartbeat = "prusa_heartbeat"
+	// MetricPrinterLastScrapeSuccess represents the last successful scrape timestamp metric name
+	MetricPrinterLastScrapeSuccess = "prusa_last_scrape_success_timestamp"
+	// MetricPrinterTag represents the printer tag info metric name
+	MetricPrinterTag = "prusa_printer_tag"
+	// MetricPrinterScrapeBackoff represents the scrape backoff metric name
+	MetricPrinterScrapeBackoff = "prusa_scrape_backoff_seconds"
 )
 
+// upReasonDisabled is the reason label of prusa_up for printers disabled in configuration
+const upReasonDisabled = "disabled"
+
+// scrapedEndpoints are endpoints reported in prusa_scrape_http_status
+var scrapedEndpoints = []struct {
+	name string
+	path string
+}{
+	{"version", "/api/version"},
+	{"job", "/api/job"},
+	{"printer", "/api/printer"},
+	{"status", "/api/v1/status"},
+	{"info", "/api/v1/info"},
+	{"stats", "/api/v1/stats"},
+	{"mesh", "/api/v1/mesh"},
+	{"queue", "/api/v1/queue"},
+	{"files", "/api/files?recursive=true"},
+	{"job_v1", "/api/v1/job"},
+}
+
+const (
+	// LengthUnitLegacy reports nozzle size and axis in millimeters under their original names, other length
+	// based metrics in meters
+	LengthUnitLegacy = "legacy"
+	// LengthUnitMeters reports length based metrics in meters
+	LengthUnitMeters = "meters"
+	// LengthUnitMillimeters reports length based metrics in millimeters
+	LengthUnitMillimeters = "millimeters"
+)
+
+// DefaultMetricPrefix is the prefix of metric names, replaced by the configured prefix at registration
+const DefaultMetricPrefix = "prusa_"
+
+// prefixedName returns metric name with the default prefix replaced by the given one
+func prefixedName(name string, prefix string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + strings.TrimPrefix(name, DefaultMetricPrefix)
+}
+
+// millimeterMetricNames are names of length based metrics when reported in millimeters
+var millimeterMetricNames = map[MetricName]string{
+	MetricPrinterNozzleSize:       "prusa_nozzle_size_millimeters",
+	MetricPrinterAxis:             "prusa_axis_millimeters",
+	MetricPrinterBedMeshRange:     "prusa_bed_mesh_range_millimeters",
+	MetricPrinterLifetimeFilament: "prusa_lifetime_filament_used_millimeters_total",
+}
+
 type metricDesc struct {
 	Name        MetricName
 	Description string
@@ -69,25 +267,64 @@ type metricDesc struct {
 var metrics = []metricDesc{
 	{MetricPrinterTemp, "Current temp of printer in Celsius", []string{"printer_heated_element"}},
 	{MetricPrinterTempTarget, "Target temp of printer in Celsius", []string{"printer_heated_element"}},
+	{MetricPrinterTempDeviation, "Difference of actual temperature from target in Celsius, negative when below target. Reported only while target is set.", []string{"printer_heated_element"}},
+	{MetricPrinterHeaterPWM, "Power output of the heater as PWM duty cycle ratio (0.0 - 1.0). Reported only if firmware exposes it.", []string{"printer_heated_element"}},
 	{MetricPrinterPrintTimeRemaining, "Returns time that remains for completion of current print", nil},
+	{MetricPrinterEstimatedCompletion, "Estimated unix timestamp of completion of current print. Returns 0 if not printing.", nil},
+	{MetricPrinterPrintStart, "Unix timestamp when current print started, kept while paused. Returns 0 if not printing.", nil},
+	{MetricPrinterFilePosition, "Position in the file of current print in bytes, smoother progress than time based one for large files. Returns 0 if not printing.", nil},
+	{MetricPrinterFileSize, "Size of the file of current print in bytes. Returns 0 if not printing.", nil},
 	{MetricPrinterPrintProgressRatio, "Returns information about completion of current print in ratio (0.0-1.0)", nil},
-	{MetricPrinterFiles, "Number of files in storage", []string{"printer_storage"}},
+	{MetricPrinterFiles, "Number of files in storage by file type - gcode, other, or all for total of the storage.", []string{"printer_storage", "file_type"}},
 	{MetricPrinterMaterial, "Returns information about loaded filament. Returns 0 if there is no loaded filament", []string{"printer_filament"}},
 	{MetricPrinterPrintTime, "Returns information about current print time.", nil},
-	{MetricPrinterNozzleSize, "Returns information about selected nozzle size.", nil},
-	{MetricPrinterStatus, "Returns information status of printer.", []string{"printer_state"}},
+	{MetricPrinterNozzleSize, "Returns information about selected nozzle size per tool.", []string{"tool"}},
+	{MetricPrinterStatus, "Returns information status of printer. 0 unknown, 1 operational, 2 prepared, 3 paused, 4 printing, 5 cancelling, 6 pausing, 7 error, 8 sd ready, 9 closed on error, 10 ready, 11 busy, 12 finished, 13 attention.", []string{"printer_state"}},
+	{MetricPrinterStateFlag, "Returns 1 if the printer state flag is set, 0 otherwise.", []string{"flag"}},
+	{MetricPrinterUserInteraction, "Returns 1 if the printer waits for user interaction, e.g. filament change (M600), 0 otherwise.", nil},
 	{MetricPrinterAxis, "Returns information about position of axis.", []string{"printer_axis"}},
 	{MetricPrinterFlow, "Returns information about of filament flow in ratio (0.0 - 1.0).", nil},
+	{MetricPrinterFlowPercent, "Returns information about of filament flow in percent as set in the printer.", nil},
 	{MetricPrinterInfo, "Returns information about printer.", []string{"api_version", "server_version", "version_text", "prusalink_name", "printer_location", "serial_number", "printer_hostname"}},
 	{MetricPrinterMMU, "Returns information if MMU is enabled.", nil},
+	{MetricPrinterFilamentSensor, "Returns 1 if the filament sensor detects filament, 0 otherwise. Not reported by printers without the sensor.", nil},
+	{MetricPrinterAcceleration, "Returns current print acceleration in mm/s^2. Not reported by firmware without it.", nil},
+	{MetricPrinterJerk, "Returns current print jerk in mm/s. Not reported by firmware without it.", nil},
+	{MetricPrinterDoorSensor, "Returns 1 if the door sensor reports open door, 0 otherwise. Not reported by printers without the sensor.", nil},
+	{MetricPrinterCurrentLayer, "Returns the layer currently printed. Returns 0 if not printing.", nil},
+	{MetricPrinterTotalLayers, "Returns the total number of layers of current print. Returns 0 if not printing.", nil},
+	{MetricPrinterJobTargetNozzle, "Nozzle temperature intended by the G-code metadata of current job. Returns 0 if there is no job.", nil},
+	{MetricPrinterJobTargetBed, "Bed temperature intended by the G-code metadata of current job. Returns 0 if there is no job.", nil},
+	{MetricPrinterNameMismatch, "Returns 1 if name of the printer in configuration differs from name set in the printer.", []string{"config_name", "device_name"}},
+	{MetricPrinterLastPrintCompleted, "Unix timestamp of the last print completion observed by the exporter.", nil},
+	{MetricPrinterUtilization, "Ratio of time spent printing to time observed by the exporter within the utilization window (0.0-1.0).", nil},
+	{MetricPrinterBedTempInstability, "Root mean square deviation of bed temperature from its target in celsius within the instability window while printing.", nil},
+	{MetricPrinterBedTempUnstable, "Returns 1 if bed temperature instability exceeds the configured threshold, which may indicate failing bed heater or MOSFET.", nil},
+	{MetricPrinterResponseBytes, "Total bytes of responses read from the printer, including job images.", nil},
+	{MetricPrinterFanFailure, "Returns 1 if the fan is commanded to spin but stays stopped for several scrapes. Hotend fan is commanded by nozzle temperature, print fan is reported only if firmware reports commanded fan speed.", []string{"fan"}},
+	{MetricPrinterFanTargetRpm, "Commanded speed of the fan in rpm. Reported only if firmware reports commanded fan speed, which current PrusaLink does not.", []string{"fan"}},
+	{MetricPrinterLifetimePrints, "Number of prints over the lifetime of the printer. Reported only if firmware exposes statistics.", nil},
+	{MetricPrinterLifetimePrintTime, "Time spent printing over the lifetime of the printer in seconds. Reported only if firmware exposes statistics.", nil},
+	{MetricPrinterLifetimeFilament, "Filament used over the lifetime of the printer in configured length unit. Reported only if firmware exposes statistics.", nil},
+	{MetricPrinterQueueLength, "Number of jobs waiting in the print queue. Reported only if firmware exposes the queue.", nil},
+	{MetricPrinterBedMeshRange, "Difference between the highest and the lowest point of the bed mesh from the last mesh bed leveling in configured length unit. Reported only if firmware exposes the mesh.", nil},
+	{MetricPrinterFirmware, "Returns firmware version of the printer as a label.", []string{"firmware"}},
+	{MetricPrinterAPIVersion, "Returns API version the printer status is read from as a label - v1, or legacy for firmware without v1 API.", []string{"version"}},
 	{MetricPrinterFanSpeedRpm, "Returns information about speed of hotend fan in rpm.", []string{"fan"}},
 	{MetricPrinterPrintSpeedRatio, "Current setting of printer speed in values from 0.0 - 1.0", nil},
+	{MetricPrinterPrintSpeedPercent, "Current setting of printer speed in percent as set in the printer.", nil},
 }
 
 // Unlike `metrics`, these ignore common labels.
 var specialMetrics = []metricDesc{
-	{MetricPrinterUp, "Return information about online printers. If printer is registered as offline then returned value is 0.", []string{"printer_address", "printer_model", "printer_name"}},
-	{MetricPrinterUDPMetricsGcodeSent, "Return information if the UDP metrics gcode was sent successfully.", []string{"printer_address", "printer_model", "printer_name"}},
+	{MetricPrinterUp, "Return information about online printers. If printer is registered as offline then returned value is 0. Label reason is disabled for printers disabled in configuration, these are not scraped.", []string{"printer_address", "printer_model", "printer_name", "reason"}},
+	{MetricPrinterUDPMetricsGcodeSent, "Return information if the UDP metrics gcode was sent successfully. Label error_reason contains the failure category.", []string{"printer_address", "printer_model", "printer_name", "error_reason"}},
+	{MetricPrinterHeartbeat, "Unix timestamp of the scrape, reported for every configured printer even if it is unreachable or disabled.", []string{"printer_address", "printer_model", "printer_name", "enabled"}},
+	{MetricPrinterLastScrapeSuccess, "Unix timestamp of the last successful scrape of the printer, kept while the printer is down.", []string{"printer_address", "printer_model", "printer_name"}},
+	{MetricPrinterTag, "Returns 1 for every tag of the printer from configuration, used to select groups of printers.", []string{"printer_address", "printer_model", "printer_name", "tag"}},
+	{MetricPrinterScrapeBackoff, "Seconds the printer is not scraped after consecutive failed scrapes, 0 if the last scrape succeeded.", []string{"printer_address", "printer_model", "printer_name"}},
+	{MetricPrinterHTTPStatus, "HTTP status code of the last request to the printer endpoint, -1 for connection errors.", []string{"printer_address", "printer_model", "printer_name", "endpoint"}},
+	{MetricPrinterMaintenance, "Return 1 if printer is in maintenance window. Printer is not scraped and prusa_up is not reported during maintenance.", []string{"printer_address", "printer_model", "printer_name"}},
 
 	{MetricPrinterCurrentJob, "Returns information about the current print job.", []string{"printer_address", "printer_model", "printer_name", "printer_job_name", "printer_job_path"}},
 }
@@ -100,27 +337,122 @@ func (c *Collector) metricEnabled(m MetricName) bool {
 // NewCollector returns a new Collector for printer metrics
 func NewCollector(config config.Config) *Collector {
 	SetConfiguration(config)
-	commonLabels := config.PrusaLink.CommonLabels
-	if len(commonLabels) == 0 {
-		commonLabels = []string{"printer_address", "printer_model", "printer_name", "printer_job_name", "printer_job_path"}
-	}
+	commonLabels := commonLabelNames(config)
+	customLabels := customLabelKeys(config.Printers)
+	prefix := config.PrusaLink.Prefix
 	c := &Collector{
-		configuration:  config,
-		commonLabels:   commonLabels,
-		metricDesc:     map[MetricName]*prometheus.Desc{},
-		metricDisabled: map[MetricName]bool{},
+		configuration:     config,
+		commonLabels:      commonLabels,
+		customLabels:      customLabels,
+		lengthDivisor:     1000,
+		nozzleAxisDivisor: 1,
+		metricDesc:        map[MetricName]*prometheus.Desc{},
+		metricDisabled:    map[MetricName]bool{},
+
+		unsupportedEndpoints: map[string]map[string]time.Time{},
+		detectedTypes:        map[string]string{},
+		firmwareVersions:     map[string]string{},
+		apiVersions:          map[string]string{},
+		apiChecked:           map[string]time.Time{},
+		previousStates:       map[string]float64{},
+		pushedJobs:           map[string]string{},
+		lastCompleted:        map[string]time.Time{},
+		jobStarts:            map[string]jobStart{},
+		lastSuccess:          map[string]time.Time{},
+		summaries:            map[string]printerSummary{},
+		fanStalls:            map[string]int{},
+		sharedHosts:          sharedHosts(config.Printers),
+		utilization:          newUtilizationTracker(time.Duration(config.PrusaLink.UtilizationWindow) * time.Second),
+		bedInstability:       newInstabilityTracker(time.Duration(config.PrusaLink.BedInstability.Window)*time.Second, config.PrusaLink.BedInstability.Threshold),
+		backoff:              newBackoffTracker(time.Duration(config.PrusaLink.Backoff.Initial)*time.Second, time.Duration(config.PrusaLink.Backoff.Max)*time.Second),
+
+		scrapeLatency: prometheus.NewSummaryVec(
+			prometheus.SummaryOpts{
+				Name:       prefixedName("prusa_scrape_latency_seconds", prefix),
+				Help:       "Latency of scraping the printer accumulated across scrapes.",
+				Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+			},
+			slices.Concat([]string{"printer_address", "printer_model", "printer_name"}, customLabels),
+		),
+		lokiPushes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prefixedName("prusa_loki_pushes_total", prefix),
+			Help: "Number of job images successfully pushed to Loki.",
+		}),
+		lokiPushFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prefixedName("prusa_loki_push_failures_total", prefix),
+			Help: "Number of job images that failed to be pushed to Loki.",
+		}),
+		lokiPushDrops: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prefixedName("prusa_loki_pushes_dropped_total", prefix),
+			Help: "Number of job images not pushed to Loki because the push queue was full.",
+		}),
+		lokiQueue: make(chan lokiPush, lokiQueueSize),
+		collections: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prefixedName("prusa_collections_total", prefix),
+			Help: "Number of collections performed by the exporter, one per Prometheus scrape.",
+		}),
+		scrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prefixedName("prusa_exporter_scrapes_total", prefix),
+			Help: "Number of printer scrapes performed by the exporter, printers in maintenance, disabled or backed off are not counted.",
+		}),
+		scrapeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prefixedName("prusa_exporter_scrape_errors_total", prefix),
+			Help: "Number of failed requests to printer endpoints across all printers, unsupported endpoints are not counted. Type is decode for responses that are not valid JSON, request otherwise.",
+		}, []string{"endpoint", "type"}),
+	}
+
+	if config.PrusaLink.MaxConcurrentScrapes > 0 {
+		c.scrapeSlots = make(chan struct{}, config.PrusaLink.MaxConcurrentScrapes)
+	}
+
+	millimeters := config.PrusaLink.LengthUnit == LengthUnitMillimeters
+	if millimeters {
+		c.lengthDivisor = 1
+	}
+	if config.PrusaLink.LengthUnit == LengthUnitMeters {
+		c.nozzleAxisDivisor = 1000
+	}
+	if config.PrusaLink.StripAddressPort {
+		for host := range c.sharedHosts {
+			log.Warn().Msg("Several printers at " + host + " differ only by port, printer_address label keeps the port for them")
+		}
 	}
 
 	for _, m := range metrics {
-		c.metricDesc[m.Name] = prometheus.NewDesc(string(m.Name), m.Description, append(commonLabels, m.Labels...), nil)
+		name := string(m.Name)
+		if millimeterName, ok := millimeterMetricNames[m.Name]; ok && millimeters {
+			name = millimeterName
+		}
+		labels := slices.Concat(commonLabels, customLabels, m.Labels)
+		c.metricDesc[m.Name] = prometheus.NewDesc(prefixedName(name, prefix), m.Description, labels, nil)
 	}
 	for _, m := range specialMetrics {
-		c.metricDesc[m.Name] = prometheus.NewDesc(string(m.Name), m.Description, m.Labels, nil)
+		labels := slices.Concat(m.Labels, customLabels)
+		c.metricDesc[m.Name] = prometheus.NewDesc(prefixedName(string(m.Name), prefix), m.Description, labels, nil)
 	}
 
+	// fleet level metric, printer labels do not apply
+	c.metricDesc[MetricActivePrints] = prometheus.NewDesc(prefixedName(MetricActivePrints, prefix),
+		"Number of printers actively printing from the origin of the job file (e.g. usb).", []string{"origin"}, nil)
+	c.metricDesc[MetricFirmwareVersionCount] = prometheus.NewDesc(prefixedName(MetricFirmwareVersionCount, prefix),
+		"Number of printers per firmware version, unreachable printers are counted with the last reported version.", []string{"version"}, nil)
+
+	// disabled metrics can be listed with the configured prefix as well
 	for _, m := range config.PrusaLink.DisableMetrics {
+		if prefix != "" && strings.HasPrefix(m, prefix) {
+			m = DefaultMetricPrefix + strings.TrimPrefix(m, prefix)
+		}
 		c.metricDisabled[MetricName(m)] = true
 	}
+
+	if config.Exporter.AuditLog != "" {
+		audit, err := newAuditLog(config.Exporter.AuditLog, int64(config.Exporter.AuditLogMaxSize)*1024*1024)
+		if err != nil {
+			log.Error().Msg("Audit log disabled - " + err.Error())
+		} else {
+			c.audit = audit
+		}
+	}
 	return c
 }
 
@@ -131,80 +463,287 @@ func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 	for _, m := range metrics {
 		ch <- c.metricDesc[m.Name]
 	}
+	ch <- c.metricDesc[MetricActivePrints]
+	ch <- c.metricDesc[MetricFirmwareVersionCount]
+	c.scrapeLatency.Describe(ch)
+	c.lokiPushes.Describe(ch)
+	c.lokiPushFailures.Describe(ch)
+	c.lokiPushDrops.Describe(ch)
+	c.collections.Describe(ch)
+	c.scrapes.Describe(ch)
+	c.scrapeErrors.Describe(ch)
 }
 
 // Collect implements prometheus.Collector
 func (c *Collector) Collect(ch chan<- prometheus.Metric) {
-	var wg sync.WaitGroup
+	c.CollectContext(context.Background(), ch)
+}
+
+// CollectContext collects metrics like Collect, requests to printers are aborted when ctx is done
+func (c *Collector) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	c.collections.Inc()
+
+	var (
+		wg           sync.WaitGroup
+		activePrints = map[string]int{} // keyed by job origin
+		activeMutex  sync.Mutex
+	)
 	for _, s := range c.configuration.Printers {
 		wg.Add(1)
 		go func(s config.Printers) {
 			defer wg.Done()
 
+			if !s.IsEnabled() {
+				log.Debug().Msg("Printer " + s.Address + " is disabled, skipping scrape")
+				c.collectHeartbeat(ch, s)
+				ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterUp], prometheus.GaugeValue,
+					0, c.GetSpecialLabels(s, c.addressLabel(s.Address), s.Type, s.Name, upReasonDisabled)...)
+				return
+			}
+
+			if c.scrapeSlots != nil {
+				select {
+				case c.scrapeSlots <- struct{}{}:
+					defer func() { <-c.scrapeSlots }()
+				case <-ctx.Done():
+					log.Debug().Msg("Scrape abandoned before printer " + s.Address + " was scraped")
+					return
+				}
+			}
+
+			maintenance := InMaintenance(s.Address)
+			if s.Type == "" {
+				if maintenance {
+					s.Type = c.cachedPrinterType(s.Address)
+				} else {
+					s.Type = c.detectPrinterType(ctx, s)
+				}
+			}
+
+			c.collectHeartbeat(ch, s)
+
+			if c.metricEnabled(MetricPrinterTag) {
+				for _, tag := range slices.Compact(slices.Sorted(slices.Values(s.Tags))) {
+					ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterTag], prometheus.GaugeValue,
+						1, c.GetSpecialLabels(s, c.addressLabel(s.Address), s.Type, s.Name, tag)...)
+				}
+			}
+
+			if maintenance {
+				log.Debug().Msg("Printer " + s.Address + " is in maintenance, skipping scrape")
+				ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterMaintenance], prometheus.GaugeValue,
+					1, c.GetSpecialLabels(s, c.addressLabel(s.Address), s.Type, s.Name)...)
+				return
+			}
+
+			ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterMaintenance], prometheus.GaugeValue,
+				0, c.GetSpecialLabels(s, c.addressLabel(s.Address), s.Type, s.Name)...)
+
+			if c.backoff.skip(s.Address, time.Now()) {
+				log.Debug().Msg("Printer " + s.Address + " is backed off after failed scrapes, skipping scrape")
+				ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterUp], prometheus.GaugeValue,
+					0, c.GetSpecialLabels(s, c.addressLabel(s.Address), s.Type, s.Name, "")...)
+				c.collectBackoff(ch, s, c.backoff.backoff(s.Address))
+				if lastSuccess, ok := c.updateLastSuccess(s.Address, false, time.Now()); ok && c.metricEnabled(MetricPrinterLastScrapeSuccess) {
+					ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterLastScrapeSuccess], prometheus.GaugeValue,
+						float64(lastSuccess.Unix()), c.GetSpecialLabels(s, c.addressLabel(s.Address), s.Type, s.Name)...)
+				}
+				return
+			}
+
+			c.scrapes.Inc()
+			start := time.Now()
+			var (
+				up        bool
+				scrapeErr error
+				summary   = printerSummary{Address: s.Address, Name: s.Name}
+			)
+			defer func() {
+				summary.Up = up
+				c.updateSummary(summary)
+				c.collectBackoff(ch, s, c.backoff.update(s.Address, up, time.Now()))
+
+				duration := time.Since(start).Seconds()
+				c.scrapeLatency.WithLabelValues(c.GetSpecialLabels(s, c.addressLabel(s.Address), s.Type, s.Name)...).Observe(duration)
+
+				record := auditRecord{Printer: s.Address, Name: s.Name, Timestamp: start, Up: up, Duration: duration}
+				if scrapeErr != nil {
+					record.Error = scrapeErr.Error()
+				}
+				if err := c.audit.write(record); err != nil {
+					log.Error().Msg("Error writing audit log - " + err.Error())
+				}
+
+				if lastSuccess, ok := c.updateLastSuccess(s.Address, up, start); ok && c.metricEnabled(MetricPrinterLastScrapeSuccess) {
+					ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterLastScrapeSuccess], prometheus.GaugeValue,
+						float64(lastSuccess.Unix()), c.GetSpecialLabels(s, c.addressLabel(s.Address), s.Type, s.Name)...)
+				}
+
+				if c.metricEnabled(MetricPrinterHTTPStatus) {
+					for _, endpoint := range scrapedEndpoints {
+						if statusCode, ok := getHTTPStatus(s.Address, endpoint.path); ok {
+							ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterHTTPStatus], prometheus.GaugeValue,
+								float64(statusCode), c.GetSpecialLabels(s, c.addressLabel(s.Address), s.Type, s.Name, endpoint.name)...)
+						}
+					}
+				}
+			}()
+
 			log.Debug().Msg("Printer scraping at " + s.Address)
 			printerUp := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterUp], prometheus.GaugeValue,
-				0, s.Address, s.Type, s.Name)
+				0, c.GetSpecialLabels(s, c.addressLabel(s.Address), s.Type, s.Name, "")...)
 
 			udpEnabled := BoolToFloat(s.UDPMetricsEnabled)
+			udpReason := s.UDPMetricsReason
+			if udpReason == "" {
+				udpReason = UDPReasonNotSent
+			}
 
 			printerUDPEnabled := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterUDPMetricsGcodeSent], prometheus.GaugeValue,
-				udpEnabled, s.Address, s.Type, s.Name)
+				udpEnabled, c.GetSpecialLabels(s, c.addressLabel(s.Address), s.Type, s.Name, udpReason)...)
 			ch <- printerUDPEnabled
 
-			job, err := GetJob(s)
+			job, err := GetJob(ctx, s)
 			if err != nil {
 				log.Error().Msg("Error while scraping job endpoint at " + s.Address + " - " + err.Error())
+				scrapeErr = fmt.Errorf("job endpoint: %w", err)
+				c.scrapeErrors.WithLabelValues("job", scrapeErrorType(err)).Inc()
 				ch <- printerUp
 				return
 			}
 
-			printer, err := GetPrinter(s)
+			// job metrics are sent even if following endpoints fail
+			c.collectJob(ch, s, job)
+			summary.Job = job.Job.File.Name
+			summary.Progress = job.Progress.Completion
+
+			printer, err := GetPrinter(ctx, s)
 			if err != nil {
 				log.Error().Msg("Error while scraping printer endpoint at " + s.Address + " - " + err.Error())
+				scrapeErr = fmt.Errorf("printer endpoint: %w", err)
+				c.scrapeErrors.WithLabelValues("printer", scrapeErrorType(err)).Inc()
 				ch <- printerUp
 				return
 			}
+			summary.State = printer.State.Text
 
-			version, err := GetVersion(s)
+			version, err := GetVersion(ctx, s)
 			if err != nil {
 				log.Error().Msg("Error while scraping version endpoint at " + s.Address + " - " + err.Error())
+				scrapeErr = fmt.Errorf("version endpoint: %w", err)
+				c.scrapeErrors.WithLabelValues("version", scrapeErrorType(err)).Inc()
 				ch <- printerUp
 				return
 			}
 
-			status, err := GetStatus(s)
+			c.firmwareMutex.Lock()
+			c.firmwareVersions[s.Address] = firmwareVersion(version)
+			c.firmwareMutex.Unlock()
 
-			if err != nil {
-				log.Error().Msg("Error while scraping status endpoint at " + s.Address + " - " + err.Error())
+			var status Status
+			if c.endpointSupported(s, "status") {
+				status = c.getStatus(ctx, s, printer)
 			}
 
-			info, err := GetInfo(s)
-
-			if err != nil {
-				log.Error().Msg("Error while scraping info endpoint at " + s.Address + " - " + err.Error())
+			var info Info
+			if c.endpointSupported(s, "info") {
+				info, err = GetInfo(ctx, s)
+				c.handleOptionalEndpointError(s, "info", err)
 			}
 
-			if getStateFlag(printer) == 4 { // ensure that printer is printing
-				go func() {
-					image, err := GetJobImage(s, job.Job.File.Path)
+			if c.endpointSupported(s, "stats") {
+				stats, err := GetStats(ctx, s)
+				c.handleOptionalEndpointError(s, "stats", err)
+				if err == nil {
+					c.collectStats(ch, s, job, stats)
+				}
+			}
 
-					if c.configuration.Exporter.LokiPushURL == "" {
-						log.Debug().Msg("Loki push URL not set, skipping pushing image to Loki")
-						return
+			if c.endpointSupported(s, "files") && c.metricEnabled(MetricPrinterFiles) {
+				files, err := GetFiles(ctx, s)
+				c.handleOptionalEndpointError(s, "files", err)
+				if err == nil {
+					for storage, counts := range countFiles(files) {
+						var total float64
+						for _, fileType := range []string{"gcode", "other"} {
+							total += counts[fileType]
+							ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterFiles], prometheus.GaugeValue,
+								counts[fileType], c.GetLabels(s, job, storage, fileType)...)
+						}
+						ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterFiles], prometheus.GaugeValue,
+							total, c.GetLabels(s, job, storage, "all")...)
 					}
+				}
+			}
 
-					if err != nil {
-						log.Error().Msg("Error getting job image from " + s.Address + " - " + err.Error())
-						return
-					}
+			if c.endpointSupported(s, "queue") && c.metricEnabled(MetricPrinterQueueLength) {
+				queue, err := GetQueue(ctx, s)
+				c.handleOptionalEndpointError(s, "queue", err)
+				if err == nil {
+					ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterQueueLength], prometheus.GaugeValue,
+						float64(len(queue.Jobs)), c.GetLabels(s, job)...)
+				}
+			}
 
-					if image == "" {
-						log.Debug().Msg("No job image available from " + s.Address)
-						return
-					}
+			if c.endpointSupported(s, "mesh") && c.metricEnabled(MetricPrinterBedMeshRange) {
+				mesh, err := GetMesh(ctx, s)
+				c.handleOptionalEndpointError(s, "mesh", err)
+				if meshRange, ok := meshRange(mesh); err == nil && ok {
+					ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterBedMeshRange], prometheus.GaugeValue,
+						meshRange/c.lengthDivisor, c.GetLabels(s, job)...)
+				}
+			}
+
+			now := time.Now()
+			c.utilization.observe(s.Address, now, getStateFlag(printer) == 4)
+
+			if printer.State.Flags.Printing {
+				activeMutex.Lock()
+				activePrints[jobOrigin(job)]++
+				activeMutex.Unlock()
+			}
+
+			if c.metricEnabled(MetricPrinterUtilization) {
+				ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterUtilization], prometheus.GaugeValue,
+					c.utilization.ratio(s.Address, now), c.GetLabels(s, job)...)
+			}
+
+			c.bedInstability.observe(s.Address, now, printer.State.Flags.Printing,
+				printer.Temperature.Bed.Actual, printer.Temperature.Bed.Target)
+
+			if c.metricEnabled(MetricPrinterBedTempInstability) {
+				ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterBedTempInstability], prometheus.GaugeValue,
+					c.bedInstability.instability(s.Address), c.GetLabels(s, job)...)
+			}
+
+			if c.metricEnabled(MetricPrinterBedTempUnstable) {
+				ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterBedTempUnstable], prometheus.GaugeValue,
+					BoolToFloat(c.bedInstability.unstable(s.Address)), c.GetLabels(s, job)...)
+			}
+
+			if c.metricEnabled(MetricPrinterResponseBytes) {
+				ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterResponseBytes], prometheus.CounterValue,
+					getResponseBytes(s.Address), c.GetLabels(s, job)...)
+			}
+
+			if c.updatePrinterState(s.Address, getStateFlag(printer), job) {
+				c.queueJobImage(s, job) // pushed by the worker, slow Loki does not delay the scrape
+			}
 
-					PushImageToLoki(c.configuration.Exporter.LokiPushURL, s.Address, s.Type, s.Name, job.Job.File.Name, job.Job.File.Path, image)
-				}()
+			var jobV1 JobV1
+			if job.Job.File.Name != "" && c.endpointSupported(s, "job_v1") {
+				jobV1, err = GetJobV1(ctx, s)
+				c.handleOptionalEndpointError(s, "job_v1", err)
+			}
+
+			if c.metricEnabled(MetricPrinterJobTargetNozzle) {
+				ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterJobTargetNozzle], prometheus.GaugeValue,
+					jobV1.File.Meta.Temperature, c.GetLabels(s, job)...)
+			}
+
+			if c.metricEnabled(MetricPrinterJobTargetBed) {
+				ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterJobTargetBed], prometheus.GaugeValue,
+					jobV1.File.Meta.BedTemperature, c.GetLabels(s, job)...)
 			}
 
 			if c.metricEnabled(MetricPrinterInfo) {
@@ -216,16 +755,24 @@ func (c *Collector) Collect(ch chan<- prometheus.Metric) {
 				ch <- printerInfo
 			}
 
-			if c.metricEnabled(MetricPrinterCurrentJob) {
-				value := float64(1)
-				if job.Job.File.Name == "" {
-					value = 0
-				}
-				jobInfo := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterCurrentJob], prometheus.GaugeValue,
-					value,
-					s.Address, s.Type, s.Name, job.Job.File.Name, job.Job.File.Path)
+			if c.metricEnabled(MetricPrinterFirmware) {
+				ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterFirmware], prometheus.GaugeValue,
+					1, c.GetLabels(s, job, firmwareVersion(version))...)
+			}
+
+			if apiVersion := c.apiVersion(s.Address); apiVersion != "" && c.metricEnabled(MetricPrinterAPIVersion) {
+				ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterAPIVersion], prometheus.GaugeValue,
+					1, c.GetLabels(s, job, apiVersion)...)
+			}
 
-				ch <- jobInfo
+			if completed, ok := c.lastPrintCompleted(s.Address); ok && c.metricEnabled(MetricPrinterLastPrintCompleted) {
+				ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterLastPrintCompleted], prometheus.GaugeValue,
+					float64(completed.Unix()), c.GetLabels(s, job)...)
+			}
+
+			if c.metricEnabled(MetricPrinterNameMismatch) && s.Name != "" && info.Name != "" && s.Name != info.Name {
+				ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterNameMismatch], prometheus.GaugeValue,
+					1, c.GetLabels(s, job, s.Name, info.Name)...)
 			}
 
 			if c.metricEnabled(MetricPrinterFanSpeedRpm) {
@@ -240,11 +787,25 @@ func (c *Collector) Collect(ch chan<- prometheus.Metric) {
 				ch <- printerFanPrint
 			}
 
+			for _, fan := range getFans(status) {
+				failed := c.updateFanStall(s.Address, fan)
+				if fan.monitored && c.metricEnabled(MetricPrinterFanFailure) {
+					ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterFanFailure], prometheus.GaugeValue,
+						BoolToFloat(failed), c.GetLabels(s, job, fan.name)...)
+				}
+				if fan.target != nil && c.metricEnabled(MetricPrinterFanTargetRpm) {
+					ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterFanTargetRpm], prometheus.GaugeValue,
+						*fan.target, c.GetLabels(s, job, fan.name)...)
+				}
+			}
+
 			if c.metricEnabled(MetricPrinterNozzleSize) {
-				printerNozzleSize := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterNozzleSize], prometheus.GaugeValue,
-					info.NozzleDiameter, c.GetLabels(s, job)...)
+				for tool, diameter := range getNozzleDiameters(info) {
+					printerNozzleSize := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterNozzleSize], prometheus.GaugeValue,
+						diameter/c.nozzleAxisDivisor, c.GetLabels(s, job, "tool"+strconv.Itoa(tool))...)
 
-				ch <- printerNozzleSize
+					ch <- printerNozzleSize
+				}
 			}
 
 			if c.metricEnabled(MetricPrinterPrintSpeedRatio) {
@@ -256,37 +817,64 @@ func (c *Collector) Collect(ch chan<- prometheus.Metric) {
 				ch <- printSpeed
 			}
 
-			if c.metricEnabled(MetricPrinterPrintTime) {
-				printTime := prometheus.MustNewConstMetric(
-					c.metricDesc[MetricPrinterPrintTime], prometheus.GaugeValue,
-					job.Progress.PrintTime,
+			if c.metricEnabled(MetricPrinterPrintSpeedPercent) {
+				printSpeedPercent := prometheus.MustNewConstMetric(
+					c.metricDesc[MetricPrinterPrintSpeedPercent], prometheus.GaugeValue,
+					printer.Telemetry.PrintSpeed,
 					c.GetLabels(s, job)...)
 
-				ch <- printTime
+				ch <- printSpeedPercent
 			}
 
-			if c.metricEnabled(MetricPrinterPrintTimeRemaining) {
-				printTimeRemaining := prometheus.MustNewConstMetric(
-					c.metricDesc[MetricPrinterPrintTimeRemaining], prometheus.GaugeValue,
-					job.Progress.PrintTimeLeft,
-					c.GetLabels(s, job)...)
+			if c.metricEnabled(MetricPrinterEstimatedCompletion) {
+				var completion float64
+				if printer.State.Flags.Printing {
+					completion = float64(now.Unix()) + job.Progress.PrintTimeLeft
+				}
+				ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterEstimatedCompletion], prometheus.GaugeValue,
+					completion, c.GetLabels(s, job)...)
+			}
 
-				ch <- printTimeRemaining
+			active := printer.State.Flags.Printing || printer.State.Flags.Paused
+			if c.metricEnabled(MetricPrinterPrintStart) {
+				ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterPrintStart], prometheus.GaugeValue,
+					c.printStart(s.Address, job.Job.File.Path, active, job.Progress.PrintTime, now), c.GetLabels(s, job)...)
 			}
 
-			if c.metricEnabled(MetricPrinterPrintProgressRatio) {
-				printProgress := prometheus.MustNewConstMetric(
-					c.metricDesc[MetricPrinterPrintProgressRatio], prometheus.GaugeValue,
-					job.Progress.Completion,
-					c.GetLabels(s, job)...)
+			filePosition, fileSize := 0.0, 0.0
+			if active {
+				filePosition, fileSize = job.Progress.Filepos, job.Job.File.Size
+			}
+
+			if c.metricEnabled(MetricPrinterFilePosition) {
+				ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterFilePosition], prometheus.GaugeValue,
+					filePosition, c.GetLabels(s, job)...)
+			}
+
+			if c.metricEnabled(MetricPrinterFileSize) {
+				ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterFileSize], prometheus.GaugeValue,
+					fileSize, c.GetLabels(s, job)...)
+			}
+
+			currentLayer, totalLayers := 0.0, 0.0
+			if printer.State.Flags.Printing {
+				currentLayer, totalLayers = status.Printer.CurrentLayer, status.Printer.TotalLayers
+			}
 
-				ch <- printProgress
+			if c.metricEnabled(MetricPrinterCurrentLayer) {
+				ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterCurrentLayer], prometheus.GaugeValue,
+					currentLayer, c.GetLabels(s, job)...)
+			}
+
+			if c.metricEnabled(MetricPrinterTotalLayers) {
+				ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterTotalLayers], prometheus.GaugeValue,
+					totalLayers, c.GetLabels(s, job)...)
 			}
 
 			if c.metricEnabled(MetricPrinterMaterial) {
 				material := prometheus.MustNewConstMetric(
 					c.metricDesc[MetricPrinterMaterial], prometheus.GaugeValue,
-					BoolToFloat(!(strings.Contains(printer.Telemetry.Material, "-"))),
+					BoolToFloat(materialLoaded(printer.Telemetry.Material)),
 					c.GetLabels(s, job, printer.Telemetry.Material)...)
 
 				ch <- material
@@ -295,21 +883,21 @@ func (c *Collector) Collect(ch chan<- prometheus.Metric) {
 			if c.metricEnabled(MetricPrinterAxis) {
 				printerAxisX := prometheus.MustNewConstMetric(
 					c.metricDesc[MetricPrinterAxis], prometheus.GaugeValue,
-					printer.Telemetry.AxisX,
+					printer.Telemetry.AxisX/c.nozzleAxisDivisor,
 					c.GetLabels(s, job, "x")...)
 
 				ch <- printerAxisX
 
 				printerAxisY := prometheus.MustNewConstMetric(
 					c.metricDesc[MetricPrinterAxis], prometheus.GaugeValue,
-					printer.Telemetry.AxisY,
+					printer.Telemetry.AxisY/c.nozzleAxisDivisor,
 					c.GetLabels(s, job, "y")...)
 
 				ch <- printerAxisY
 
 				printerAxisZ := prometheus.MustNewConstMetric(
 					c.metricDesc[MetricPrinterAxis], prometheus.GaugeValue,
-					printer.Telemetry.AxisZ,
+					printer.Telemetry.AxisZ/c.nozzleAxisDivisor,
 					c.GetLabels(s, job, "z")...)
 
 				ch <- printerAxisZ
@@ -322,34 +910,69 @@ func (c *Collector) Collect(ch chan<- prometheus.Metric) {
 				ch <- printerFlow
 			}
 
+			if c.metricEnabled(MetricPrinterFlowPercent) {
+				printerFlowPercent := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterFlowPercent], prometheus.GaugeValue,
+					status.Printer.Flow, c.GetLabels(s, job)...)
+
+				ch <- printerFlowPercent
+			}
+
 			if c.metricEnabled(MetricPrinterMMU) {
 				printerMMU := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterMMU], prometheus.GaugeValue,
 					BoolToFloat(info.Mmu), c.GetLabels(s, job)...)
 				ch <- printerMMU
 			}
 
-			if c.metricEnabled(MetricPrinterTemp) {
-				printerBedTemp := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterTemp], prometheus.GaugeValue,
-					printer.Temperature.Bed.Actual, c.GetLabels(s, job, "bed")...)
+			if status.Printer.FilamentSensor != nil && c.metricEnabled(MetricPrinterFilamentSensor) {
+				ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterFilamentSensor], prometheus.GaugeValue,
+					BoolToFloat(*status.Printer.FilamentSensor), c.GetLabels(s, job)...)
+			}
 
-				ch <- printerBedTemp
+			if status.Printer.DoorSensor != nil && c.metricEnabled(MetricPrinterDoorSensor) {
+				ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterDoorSensor], prometheus.GaugeValue,
+					BoolToFloat(*status.Printer.DoorSensor), c.GetLabels(s, job)...)
+			}
 
-				printerToolTemp := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterTemp], prometheus.GaugeValue,
-					printer.Temperature.Tool0.Actual, c.GetLabels(s, job, "tool0")...)
+			if status.Printer.Acceleration != nil && c.metricEnabled(MetricPrinterAcceleration) {
+				ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterAcceleration], prometheus.GaugeValue,
+					*status.Printer.Acceleration, c.GetLabels(s, job)...)
+			}
 
-				ch <- printerToolTemp
+			if status.Printer.Jerk != nil && c.metricEnabled(MetricPrinterJerk) {
+				ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterJerk], prometheus.GaugeValue,
+					*status.Printer.Jerk, c.GetLabels(s, job)...)
 			}
 
-			if c.metricEnabled(MetricPrinterTempTarget) {
-				printerBedTempTarget := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterTempTarget], prometheus.GaugeValue,
-					printer.Temperature.Bed.Target, c.GetLabels(s, job, "bed")...)
+			if c.metricEnabled(MetricPrinterTemp) {
+				for _, temp := range getTemperatures(printer, status, s.Type) {
+					ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterTemp], prometheus.GaugeValue,
+						temp.value, c.GetLabels(s, job, temp.element)...)
+				}
+			}
 
-				ch <- printerBedTempTarget
+			if c.metricEnabled(MetricPrinterTempTarget) {
+				for _, temp := range getTargetTemperatures(printer, s.Type) {
+					ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterTempTarget], prometheus.GaugeValue,
+						temp.value, c.GetLabels(s, job, temp.element)...)
+				}
+			}
 
-				printerToolTempTarget := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterTempTarget], prometheus.GaugeValue,
-					printer.Temperature.Tool0.Target, c.GetLabels(s, job, "tool0")...)
+			if c.metricEnabled(MetricPrinterTempDeviation) {
+				for _, deviation := range getTemperatureDeviations(printer, status, s.Type) {
+					ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterTempDeviation], prometheus.GaugeValue,
+						deviation.value, c.GetLabels(s, job, deviation.element)...)
+				}
+			}
 
-				ch <- printerToolTempTarget
+			if c.metricEnabled(MetricPrinterHeaterPWM) {
+				if pwm := status.Printer.HeaterNozzlePWM; pwm != nil {
+					ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterHeaterPWM], prometheus.GaugeValue,
+						*pwm/100, c.GetLabels(s, job, "nozzle")...)
+				}
+				if pwm := status.Printer.HeaterBedPWM; pwm != nil {
+					ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterHeaterPWM], prometheus.GaugeValue,
+						*pwm/100, c.GetLabels(s, job, "bed")...)
+				}
 			}
 
 			if c.metricEnabled(MetricPrinterStatus) {
@@ -361,25 +984,405 @@ func (c *Collector) Collect(ch chan<- prometheus.Metric) {
 				ch <- printerStatus
 			}
 
+			if c.metricEnabled(MetricPrinterStateFlag) {
+				for _, flag := range getStateFlags(printer) {
+					ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterStateFlag], prometheus.GaugeValue,
+						BoolToFloat(flag.value), c.GetLabels(s, job, flag.name)...)
+				}
+			}
+
+			if c.metricEnabled(MetricPrinterUserInteraction) {
+				ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterUserInteraction], prometheus.GaugeValue,
+					BoolToFloat(userInteractionRequired(printer, status)), c.GetLabels(s, job)...)
+			}
+
 			printerUp = prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterUp], prometheus.GaugeValue,
-				1, s.Address, s.Type, s.Name)
+				1, c.GetSpecialLabels(s, c.addressLabel(s.Address), s.Type, s.Name, "")...)
 
 			ch <- printerUp
+			up = true
 
 			log.Debug().Msg("Scraping done at " + s.Address)
 		}(s)
 	}
 	wg.Wait()
+
+	if c.metricEnabled(MetricActivePrints) {
+		for origin, count := range activePrints {
+			ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricActivePrints], prometheus.GaugeValue,
+				float64(count), origin)
+		}
+	}
+
+	if c.metricEnabled(MetricFirmwareVersionCount) {
+		for version, count := range c.firmwareVersionCounts() {
+			ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricFirmwareVersionCount], prometheus.GaugeValue,
+				float64(count), version)
+		}
+	}
+
+	c.scrapeLatency.Collect(ch)
+	c.lokiPushes.Collect(ch)
+	c.lokiPushFailures.Collect(ch)
+	c.lokiPushDrops.Collect(ch)
+	c.collections.Collect(ch)
+	c.scrapes.Collect(ch)
+	c.scrapeErrors.Collect(ch)
+}
+
+// firmwareVersionCounts returns number of configured printers per last reported firmware version,
+// printers that never reported their version are not counted
+func (c *Collector) firmwareVersionCounts() map[string]int {
+	c.firmwareMutex.Lock()
+	defer c.firmwareMutex.Unlock()
+
+	counts := map[string]int{}
+	for _, printer := range c.configuration.Printers {
+		if version, ok := c.firmwareVersions[printer.Address]; ok {
+			counts[version]++
+		}
+	}
+	return counts
+}
+
+// lokiPush is the job image waiting to be fetched from the printer and pushed to Loki
+type lokiPush struct {
+	printer config.Printers
+	job     Job
+}
+
+// queueJobImage queues the job image for the Loki push worker, the push is dropped if the queue is full
+func (c *Collector) queueJobImage(printer config.Printers, job Job) {
+	if c.lokiPushURL(printer) == "" {
+		log.Debug().Msg("Loki push URL not set, skipping pushing image to Loki")
+		return
+	}
+
+	c.lokiWorker.Do(func() { go c.runLokiWorker() })
+	select {
+	case c.lokiQueue <- lokiPush{printer: printer, job: job}:
+	default:
+		c.lokiPushDrops.Inc()
+		log.Warn().Msg("Loki push queue is full, dropping job image of " + printer.Address)
+	}
+}
+
+// runLokiWorker fetches queued job images from printers and pushes them to Loki one by one
+func (c *Collector) runLokiWorker() {
+	for push := range c.lokiQueue {
+		image, err := GetJobImage(context.Background(), push.printer, push.job.Job.File.Path, c.configuration.Exporter.LokiImageSize)
+		if err != nil {
+			log.Error().Msg("Error getting job image from " + push.printer.Address + " - " + err.Error())
+			continue
+		}
+
+		if image == "" {
+			log.Debug().Msg("No job image available from " + push.printer.Address)
+			continue
+		}
+
+		c.pushJobImage(push.printer, push.job, image)
+	}
+}
+
+// pushJobImage pushes the job image to Loki and counts successful and failed pushes
+func (c *Collector) pushJobImage(printer config.Printers, job Job, image string) {
+	ctx, cancel := context.WithTimeout(context.Background(), lokiPushTimeout)
+	defer cancel()
+
+	err := PushImageToLoki(ctx, c.lokiPushURL(printer), printer.Address, printer.Type, printer.Name, job.Job.File.Name, job.Job.File.Path, image)
+	if err != nil {
+		c.lokiPushFailures.Inc()
+		log.Error().Msg("Error pushing job image of " + printer.Address + " to Loki - " + err.Error())
+		return
+	}
+	c.lokiPushes.Inc()
+}
+
+// collectHeartbeat sends heartbeat of the printer along with whether it is enabled
+func (c *Collector) collectHeartbeat(ch chan<- prometheus.Metric, printer config.Printers) {
+	if !c.metricEnabled(MetricPrinterHeartbeat) {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterHeartbeat], prometheus.GaugeValue, float64(time.Now().Unix()),
+		c.GetSpecialLabels(printer, c.addressLabel(printer.Address), printer.Type, printer.Name, strconv.FormatBool(printer.IsEnabled()))...)
+}
+
+// lokiPushURL returns Loki push URL of the printer, falling back to the URL of the exporter
+func (c *Collector) lokiPushURL(printer config.Printers) string {
+	if printer.LokiPushURL != "" {
+		return printer.LokiPushURL
+	}
+	return c.configuration.Exporter.LokiPushURL
+}
+
+// updatePrinterState remembers the printer state and returns whether the job image should be pushed. The image
+// is pushed once when the job starts printing and once on the printing to finished transition.
+func (c *Collector) updatePrinterState(address string, state float64, job Job) bool {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+
+	previous := c.previousStates[address]
+	c.previousStates[address] = state
+
+	switch state {
+	case 4: // printing
+		if c.pushedJobs[address] == job.Job.File.Path {
+			return false
+		}
+		c.pushedJobs[address] = job.Job.File.Path
+		return true
+	case 3, 6: // paused or pausing, job is still in progress
+		return false
+	}
+
+	delete(c.pushedJobs, address)
+	if state == 12 && previous == 4 { // finished
+		c.lastCompleted[address] = time.Now()
+		return true
+	}
+	return false
+}
+
+// updateLastSuccess remembers time of the scrape if it succeeded and returns time of the last successful scrape,
+// false if the printer was never scraped successfully
+func (c *Collector) updateLastSuccess(address string, up bool, scraped time.Time) (time.Time, bool) {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+	if up {
+		c.lastSuccess[address] = scraped
+	}
+	lastSuccess, ok := c.lastSuccess[address]
+	return lastSuccess, ok
+}
+
+// lastPrintCompleted returns time of the last printing to finished transition observed for the printer
+func (c *Collector) lastPrintCompleted(address string) (time.Time, bool) {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+	completed, ok := c.lastCompleted[address]
+	return completed, ok
+}
+
+// jobStart is the start time of the job computed when it was first seen
+type jobStart struct {
+	path  string
+	start float64
+}
+
+// printStart returns unix timestamp when the current job started. The start is computed once per job from
+// its print time and kept while the job is paused, so it does not drift when print time stalls or keeps
+// advancing during the pause. Returns 0 when the printer is not printing.
+func (c *Collector) printStart(address string, path string, active bool, printTime float64, now time.Time) float64 {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+
+	if !active {
+		delete(c.jobStarts, address)
+		return 0
+	}
+
+	if started, ok := c.jobStarts[address]; ok && started.path == path {
+		return started.start
+	}
+
+	start := float64(now.Unix()) - printTime
+	c.jobStarts[address] = jobStart{path: path, start: start}
+	return start
+}
+
+// detectPrinterType returns the printer type detected from the version endpoint. Detected type is
+// cached, so the printer is queried only until the detection succeeds.
+func (c *Collector) detectPrinterType(ctx context.Context, printer config.Printers) string {
+	if printerType := c.cachedPrinterType(printer.Address); printerType != "" {
+		return printerType
+	}
+
+	printerType, err := GetPrinterType(ctx, printer)
+	if err != nil {
+		log.Debug().Msg("Failed to detect printer type of " + printer.Address + " - " + err.Error())
+		return ""
+	}
+
+	log.Info().Msg("Detected printer type " + printerType + " for " + printer.Address)
+
+	c.detectedMutex.Lock()
+	c.detectedTypes[printer.Address] = printerType
+	c.detectedMutex.Unlock()
+
+	return printerType
+}
+
+// apiVersionRecheckInterval is how long status of printers without v1 API is converted from the legacy
+// endpoint before v1 API is requested again, e.g. after 404 of restarting webserver or firmware upgrade
+const apiVersionRecheckInterval = 10 * time.Minute
+
+// getStatus returns status of the printer from v1 API. Printers without v1 API are detected by 404 and their
+// status is converted from the legacy printer endpoint, v1 API is requested again after the recheck interval.
+func (c *Collector) getStatus(ctx context.Context, s config.Printers, printer Printer) Status {
+	now := time.Now()
+	c.firmwareMutex.Lock()
+	legacy := c.apiVersions[s.Address] == APIVersionLegacy && now.Sub(c.apiChecked[s.Address]) < apiVersionRecheckInterval
+	c.firmwareMutex.Unlock()
+	if legacy {
+		return legacyStatus(printer)
+	}
+
+	status, apiVersion, err := GetStatusWithFallback(ctx, s, printer)
+	c.handleOptionalEndpointError(s, "status", err)
+	if err != nil {
+		return Status{}
+	}
+
+	if previous := c.apiVersion(s.Address); previous != apiVersion {
+		log.Info().Msg("Printer " + s.Address + " status is read from " + apiVersion + " API")
+	}
+	c.firmwareMutex.Lock()
+	c.apiVersions[s.Address] = apiVersion
+	c.apiChecked[s.Address] = now
+	c.firmwareMutex.Unlock()
+
+	return status
+}
+
+// apiVersion returns API version the printer status was last read from, empty if not known yet
+func (c *Collector) apiVersion(address string) string {
+	c.firmwareMutex.Lock()
+	defer c.firmwareMutex.Unlock()
+	return c.apiVersions[address]
+}
+
+// cachedPrinterType returns previously detected printer type without querying the printer
+func (c *Collector) cachedPrinterType(address string) string {
+	c.detectedMutex.Lock()
+	defer c.detectedMutex.Unlock()
+	return c.detectedTypes[address]
+}
+
+// collectJob sends metrics that depend only on the job endpoint
+func (c *Collector) collectJob(ch chan<- prometheus.Metric, printer config.Printers, job Job) {
+	if c.metricEnabled(MetricPrinterCurrentJob) {
+		value := float64(1)
+		if job.Job.File.Name == "" {
+			value = 0
+		}
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterCurrentJob], prometheus.GaugeValue,
+			value, c.GetSpecialLabels(printer, c.addressLabel(printer.Address), printer.Type, printer.Name, job.Job.File.Name, job.Job.File.Path)...)
+	}
+
+	if c.metricEnabled(MetricPrinterPrintTime) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterPrintTime], prometheus.GaugeValue,
+			job.Progress.PrintTime, c.GetLabels(printer, job)...)
+	}
+
+	if c.metricEnabled(MetricPrinterPrintTimeRemaining) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterPrintTimeRemaining], prometheus.GaugeValue,
+			job.Progress.PrintTimeLeft, c.GetLabels(printer, job)...)
+	}
+
+	if c.metricEnabled(MetricPrinterPrintProgressRatio) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterPrintProgressRatio], prometheus.GaugeValue,
+			job.Progress.Completion, c.GetLabels(printer, job)...)
+	}
+}
+
+// collectBackoff sends the current scrape backoff of the printer
+func (c *Collector) collectBackoff(ch chan<- prometheus.Metric, printer config.Printers, backoff time.Duration) {
+	if c.metricEnabled(MetricPrinterScrapeBackoff) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterScrapeBackoff], prometheus.GaugeValue,
+			backoff.Seconds(), c.GetSpecialLabels(printer, c.addressLabel(printer.Address), printer.Type, printer.Name)...)
+	}
+}
+
+// collectStats sends lifetime statistics of the printer
+func (c *Collector) collectStats(ch chan<- prometheus.Metric, printer config.Printers, job Job, stats Stats) {
+	if c.metricEnabled(MetricPrinterLifetimePrints) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterLifetimePrints], prometheus.CounterValue,
+			stats.TotalPrints, c.GetLabels(printer, job)...)
+	}
+
+	if c.metricEnabled(MetricPrinterLifetimePrintTime) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterLifetimePrintTime], prometheus.CounterValue,
+			stats.TotalPrintTime, c.GetLabels(printer, job)...)
+	}
+
+	if c.metricEnabled(MetricPrinterLifetimeFilament) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterLifetimeFilament], prometheus.CounterValue,
+			stats.FilamentUsed/c.lengthDivisor, c.GetLabels(printer, job)...)
+	}
+}
+
+// unsupportedEndpointRetryInterval is how long an endpoint that returned 404 is skipped, firmware update may add it
+const unsupportedEndpointRetryInterval = 10 * time.Minute
+
+// endpointSupported returns false if the endpoint is skipped in config or returned 404 for the printer recently
+func (c *Collector) endpointSupported(printer config.Printers, endpoint string) bool {
+	if slices.Contains(printer.SkipEndpoints, endpoint) {
+		return false
+	}
+
+	c.unsupportedMutex.Lock()
+	defer c.unsupportedMutex.Unlock()
+	notFound, ok := c.unsupportedEndpoints[printer.Address][endpoint]
+	return !ok || time.Since(notFound) >= unsupportedEndpointRetryInterval
+}
+
+// handleOptionalEndpointError logs the error of an endpoint not every firmware supports.
+// Endpoints returning 404 are remembered per printer and skipped in following scrapes until the retry interval passes.
+func (c *Collector) handleOptionalEndpointError(printer config.Printers, endpoint string, err error) {
+	if err == nil {
+		return
+	}
+
+	if !isNotFound(err) {
+		log.Error().Msg("Error while scraping " + endpoint + " endpoint at " + printer.Address + " - " + err.Error())
+		c.scrapeErrors.WithLabelValues(endpoint, scrapeErrorType(err)).Inc()
+		return
+	}
+
+	log.Warn().Msg("Endpoint " + endpoint + " is not supported by " + printer.Address + ", skipping it for " + unsupportedEndpointRetryInterval.String())
+
+	c.unsupportedMutex.Lock()
+	defer c.unsupportedMutex.Unlock()
+	if c.unsupportedEndpoints[printer.Address] == nil {
+		c.unsupportedEndpoints[printer.Address] = map[string]time.Time{}
+	}
+	c.unsupportedEndpoints[printer.Address][endpoint] = time.Now()
+}
+
+// scrapeErrorType returns type label of prusa_exporter_scrape_errors_total for the error
+func scrapeErrorType(err error) string {
+	var decodeErr *DecodeError
+	if errors.As(err, &decodeErr) {
+		return "decode"
+	}
+	return "request"
+}
+
+// commonLabelNames returns names of labels added to every printer metric
+func commonLabelNames(config config.Config) []string {
+	if len(config.PrusaLink.CommonLabels) == 0 {
+		return []string{"printer_address", "printer_model", "printer_name", "printer_job_name", "printer_job_path"}
+	}
+	return config.PrusaLink.CommonLabels
+}
+
+// customLabelKeys returns sorted custom label keys, config validation ensures all printers share the same keys
+func customLabelKeys(printers []config.Printers) []string {
+	if len(printers) == 0 {
+		return nil
+	}
+	return slices.Sorted(maps.Keys(printers[0].Labels))
 }
 
 // GetLabels is used to get the labels for the given printer and job
 func (c *Collector) GetLabels(printer config.Printers, job Job, labelValues ...string) []string {
-	commonValues := make([]string, len(c.commonLabels), len(c.commonLabels)+len(labelValues))
+	commonValues := make([]string, len(c.commonLabels), len(c.commonLabels)+len(c.customLabels)+len(labelValues))
 
 	for i, l := range c.commonLabels {
 		switch l {
 		case "printer_address":
-			commonValues[i] = printer.Address
+			commonValues[i] = c.addressLabel(printer.Address)
 		case "printer_model":
 			commonValues[i] = printer.Type
 		case "printer_name":
@@ -393,5 +1396,49 @@ func (c *Collector) GetLabels(printer config.Printers, job Job, labelValues ...s
 			commonValues[i] = job.Job.File.Path
 		}
 	}
+	for _, l := range c.customLabels {
+		commonValues = append(commonValues, printer.Labels[l])
+	}
 	return append(commonValues, labelValues...)
 }
+
+// addressLabel returns value of printer_address label, the port is stripped if configured so labels match
+// UDP metrics. Requests to the printer always use the configured address.
+func (c *Collector) addressLabel(address string) string {
+	if !c.configuration.PrusaLink.StripAddressPort {
+		return address
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil || c.sharedHosts[host] {
+		return address // no port or the label would collide with another printer
+	}
+	return host
+}
+
+// sharedHosts returns hosts with several printers listening at different ports
+func sharedHosts(printers []config.Printers) map[string]bool {
+	addresses := map[string]string{}
+	shared := map[string]bool{}
+	for _, printer := range printers {
+		host, _, err := net.SplitHostPort(printer.Address)
+		if err != nil {
+			host = printer.Address
+		}
+		if other, ok := addresses[host]; ok && other != printer.Address {
+			shared[host] = true
+			continue
+		}
+		addresses[host] = printer.Address
+	}
+	return shared
+}
+
+// GetSpecialLabels is used to get the labels for metrics ignoring common labels, custom printer labels are appended to the given values
+func (c *Collector) GetSpecialLabels(printer config.Printers, labelValues ...string) []string {
+	values := make([]string, 0, len(labelValues)+len(c.customLabels))
+	values = append(values, labelValues...)
+	for _, l := range c.customLabels {
+		values = append(values, printer.Labels[l])
+	}
+	return values
+}
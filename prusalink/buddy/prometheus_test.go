@@ -0,0 +1,1750 @@
+package prusalink
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/pstrobl96/prusa_exporter/config"
+)
+
+// newMockPrinter returns a server answering PrusaLink endpoints with the given JSON bodies, unknown paths return 404
+func newMockPrinter(t *testing.T, responses map[string]string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// defaultPrinterResponses returns minimal responses for endpoints required by Collect
+func defaultPrinterResponses() map[string]string {
+	return map[string]string{
+		"/api/job":       `{"state":"Operational","job":{"file":{"name":"","path":""}}}`,
+		"/api/printer":   `{"state":{"text":"Operational","flags":{"operational":true}}}`,
+		"/api/version":   `{"api":"2.0.0","server":"2.1.2","text":"PrusaLink","hostname":"PrusaMK4"}`,
+		"/api/v1/status": `{"printer":{"state":"IDLE"}}`,
+		"/api/v1/info":   `{"name":"TestPrinter","nozzle_diameter":0.4}`,
+	}
+}
+
+// printerAddress returns address of the mock server usable in config.Printers
+func printerAddress(server *httptest.Server) string {
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+// gatherMetrics collects the collector and returns gathered metric families by name
+func gatherMetrics(t *testing.T, collector prometheus.Collector) map[string]*dto.MetricFamily {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("registry.Gather() error: %v", err)
+	}
+
+	result := map[string]*dto.MetricFamily{}
+	for _, family := range families {
+		result[family.GetName()] = family
+	}
+	return result
+}
+
+// labelValue returns value of the label with the given name
+func labelValue(metric *dto.Metric, name string) string {
+	for _, label := range metric.GetLabel() {
+		if label.GetName() == name {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
+
+func testConfig(printers ...config.Printers) config.Config {
+	cfg := config.Config{Printers: printers}
+	cfg.Exporter.ScrapeTimeout = 1
+	return cfg
+}
+
+func TestCollectorCustomLabels(t *testing.T) {
+	server := newMockPrinter(t, defaultPrinterResponses())
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	collector := NewCollector(testConfig(config.Printers{
+		Address: printerAddress(server),
+		Apikey:  "test_api_key",
+		Name:    "TestPrinter",
+		Type:    "MK4",
+		Labels:  map[string]string{"room": "garage", "owner": "alice"},
+	}))
+
+	families := gatherMetrics(t, collector)
+
+	for _, name := range []string{MetricPrinterUp, MetricPrinterPrintSpeedRatio} {
+		family, ok := families[name]
+		if !ok {
+			t.Fatalf("metric %s was not collected", name)
+		}
+		for _, metric := range family.GetMetric() {
+			if labelValue(metric, "room") != "garage" || labelValue(metric, "owner") != "alice" {
+				t.Errorf("metric %s labels = %v, expected room=garage and owner=alice", name, metric.GetLabel())
+			}
+		}
+	}
+}
+
+func TestCollectorSkipsNotFoundEndpoint(t *testing.T) {
+	var statusRequests atomic.Int32
+	responses := defaultPrinterResponses()
+	delete(responses, "/api/v1/status")
+
+	mock := newMockPrinter(t, responses)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/status" {
+			statusRequests.Add(1)
+		}
+		mock.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	collector := NewCollector(testConfig(config.Printers{
+		Address: printerAddress(server),
+		Apikey:  "test_api_key",
+		Name:    "TestPrinter",
+		Type:    "MK4",
+	}))
+
+	for i := 0; i < 3; i++ {
+		families := gatherMetrics(t, collector)
+		if families[MetricPrinterUp].GetMetric()[0].GetGauge().GetValue() != 1 {
+			t.Errorf("scrape %d: printer should be up when optional endpoint returns 404", i)
+		}
+	}
+
+	if statusRequests.Load() != 1 {
+		t.Errorf("status endpoint requested %d times, expected 1", statusRequests.Load())
+	}
+}
+
+func TestCollectorMaxConcurrentScrapes(t *testing.T) {
+	const limit = 2
+	var active, maxActive atomic.Int32
+
+	mock := newMockPrinter(t, defaultPrinterResponses())
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := active.Add(1)
+		defer active.Add(-1)
+		for {
+			observed := maxActive.Load()
+			if current <= observed || maxActive.CompareAndSwap(observed, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		mock.Config.Handler.ServeHTTP(w, r)
+	})
+
+	var printers []config.Printers
+	for i := 0; i < 6; i++ {
+		server := httptest.NewServer(handler)
+		defer server.Close()
+		printers = append(printers, config.Printers{Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4"})
+	}
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	cfg := testConfig(printers...)
+	cfg.PrusaLink.MaxConcurrentScrapes = limit
+	families := gatherMetrics(t, NewCollector(cfg))
+
+	if len(families[MetricPrinterUp].GetMetric()) != len(printers) {
+		t.Errorf("%s collected for %d printers, expected %d", MetricPrinterUp, len(families[MetricPrinterUp].GetMetric()), len(printers))
+	}
+	if maxActive.Load() > limit {
+		t.Errorf("%d printers scraped concurrently, expected at most %d", maxActive.Load(), limit)
+	}
+}
+
+func TestCollectorHTTPStatus(t *testing.T) {
+	mock := newMockPrinter(t, defaultPrinterResponses())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/job" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mock.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	families := gatherMetrics(t, NewCollector(testConfig(config.Printers{
+		Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4",
+	})))
+
+	family, ok := families[MetricPrinterHTTPStatus]
+	if !ok {
+		t.Fatalf("%s not collected", MetricPrinterHTTPStatus)
+	}
+	statuses := map[string]float64{}
+	for _, metric := range family.GetMetric() {
+		statuses[labelValue(metric, "endpoint")] = metric.GetGauge().GetValue()
+	}
+	if statuses["job"] != http.StatusUnauthorized {
+		t.Errorf("%s{endpoint=\"job\"} = %v, expected 401", MetricPrinterHTTPStatus, statuses["job"])
+	}
+	if _, ok := statuses["printer"]; ok {
+		t.Errorf("%s{endpoint=\"printer\"} collected, but printer endpoint was not requested", MetricPrinterHTTPStatus)
+	}
+	if families[MetricPrinterUp].GetMetric()[0].GetGauge().GetValue() != 0 {
+		t.Errorf("%s = 1, expected 0 after 401", MetricPrinterUp)
+	}
+}
+
+func TestCollectorSkipEndpointsConfig(t *testing.T) {
+	var infoRequests atomic.Int32
+	mock := newMockPrinter(t, defaultPrinterResponses())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/info" {
+			infoRequests.Add(1)
+		}
+		mock.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	collector := NewCollector(testConfig(config.Printers{
+		Address:       printerAddress(server),
+		Apikey:        "test_api_key",
+		SkipEndpoints: []string{"info"},
+	}))
+	gatherMetrics(t, collector)
+
+	if infoRequests.Load() != 0 {
+		t.Errorf("info endpoint requested %d times, expected 0", infoRequests.Load())
+	}
+}
+
+func TestCollectorDetectsPrinterType(t *testing.T) {
+	var versionRequests atomic.Int32
+	responses := defaultPrinterResponses()
+	responses["/api/version"] = `{"api":"2.0.0","server":"2.1.2","text":"PrusaLink","hostname":"PrusaXL"}`
+
+	mock := newMockPrinter(t, responses)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/version" {
+			versionRequests.Add(1)
+		}
+		mock.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	collector := NewCollector(testConfig(config.Printers{
+		Address: printerAddress(server),
+		Apikey:  "test_api_key",
+		Name:    "TestPrinter",
+	}))
+
+	for i := 0; i < 2; i++ {
+		families := gatherMetrics(t, collector)
+		if model := labelValue(families[MetricPrinterUp].GetMetric()[0], "printer_model"); model != "XL" {
+			t.Errorf("printer_model = %q, expected XL", model)
+		}
+	}
+
+	// one detection request plus one version request per scrape
+	if versionRequests.Load() != 3 {
+		t.Errorf("version endpoint requested %d times, expected 3", versionRequests.Load())
+	}
+}
+
+func TestCollectorFirmwareInfo(t *testing.T) {
+	responses := defaultPrinterResponses()
+	responses["/api/version"] = `{"api":"2.0.0","server":"2.1.2","text":"PrusaLink","firmware":"6.2.0+8848"}`
+	server := newMockPrinter(t, responses)
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	printer := config.Printers{Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4"}
+
+	families := gatherMetrics(t, NewCollector(testConfig(printer)))
+	family, ok := families[MetricPrinterFirmware]
+	if !ok {
+		t.Fatalf("metric %s was not collected", MetricPrinterFirmware)
+	}
+	if firmware := labelValue(family.GetMetric()[0], "firmware"); firmware != "6.2.0+8848" {
+		t.Errorf("firmware = %q, expected 6.2.0+8848", firmware)
+	}
+
+	cfg := testConfig(printer)
+	cfg.PrusaLink.DisableMetrics = []string{MetricPrinterFirmware}
+	families = gatherMetrics(t, NewCollector(cfg))
+	if _, ok := families[MetricPrinterFirmware]; ok {
+		t.Errorf("metric %s collected although disabled", MetricPrinterFirmware)
+	}
+}
+
+func TestCollectorLayers(t *testing.T) {
+	tests := []struct {
+		name          string
+		printer       string
+		expectedLayer float64
+		expectedTotal float64
+	}{
+		{"Printing", `{"state":{"text":"Printing","flags":{"operational":true,"printing":true}}}`, 42, 120},
+		{"Not printing", `{"state":{"text":"Operational","flags":{"operational":true}}}`, 0, 0},
+	}
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responses := defaultPrinterResponses()
+			responses["/api/printer"] = tt.printer
+			responses["/api/v1/status"] = `{"printer":{"state":"PRINTING","current_layer":42,"total_layers":120}}`
+			server := newMockPrinter(t, responses)
+
+			families := gatherMetrics(t, NewCollector(testConfig(config.Printers{
+				Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4",
+			})))
+
+			if value := families[MetricPrinterCurrentLayer].GetMetric()[0].GetGauge().GetValue(); value != tt.expectedLayer {
+				t.Errorf("%s = %v, expected %v", MetricPrinterCurrentLayer, value, tt.expectedLayer)
+			}
+			if value := families[MetricPrinterTotalLayers].GetMetric()[0].GetGauge().GetValue(); value != tt.expectedTotal {
+				t.Errorf("%s = %v, expected %v", MetricPrinterTotalLayers, value, tt.expectedTotal)
+			}
+		})
+	}
+}
+
+func TestCollectorScrapeLatency(t *testing.T) {
+	server := newMockPrinter(t, defaultPrinterResponses())
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	printer := config.Printers{Address: printerAddress(server), Apikey: "test_api_key", Name: "TestPrinter", Type: "MK4"}
+	collector := NewCollector(testConfig(printer))
+
+	for _, latency := range []float64{0.1, 0.2, 0.3, 0.4} {
+		collector.scrapeLatency.WithLabelValues(printer.Address, printer.Type, printer.Name).Observe(latency)
+	}
+
+	families := gatherMetrics(t, collector)
+	family, ok := families["prusa_scrape_latency_seconds"]
+	if !ok {
+		t.Fatal("metric prusa_scrape_latency_seconds was not collected")
+	}
+
+	summary := family.GetMetric()[0].GetSummary()
+	// four observed latencies and one from the scrape itself
+	if summary.GetSampleCount() != 5 {
+		t.Errorf("sample count = %d, expected 5", summary.GetSampleCount())
+	}
+	if len(summary.GetQuantile()) != 3 {
+		t.Errorf("quantiles = %d, expected 3", len(summary.GetQuantile()))
+	}
+	for _, quantile := range summary.GetQuantile() {
+		if quantile.GetQuantile() == 0.5 && quantile.GetValue() < 0.1 {
+			t.Errorf("p50 = %v, expected at least 0.1", quantile.GetValue())
+		}
+	}
+}
+
+func TestCollectorCollectionsTotal(t *testing.T) {
+	server := newMockPrinter(t, defaultPrinterResponses())
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewCollector(testConfig(config.Printers{Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4"})))
+
+	for expected := 1.0; expected <= 3; expected++ {
+		families, err := registry.Gather()
+		if err != nil {
+			t.Fatalf("Gather() error: %v", err)
+		}
+		index := slices.IndexFunc(families, func(family *dto.MetricFamily) bool {
+			return family.GetName() == "prusa_collections_total"
+		})
+		if index < 0 {
+			t.Fatal("metric prusa_collections_total was not collected")
+		}
+		if value := families[index].GetMetric()[0].GetCounter().GetValue(); value != expected {
+			t.Errorf("prusa_collections_total = %v, expected %v", value, expected)
+		}
+	}
+}
+
+func TestCollectorNozzleSizePerTool(t *testing.T) {
+	responses := defaultPrinterResponses()
+	responses["/api/v1/info"] = `{"name":"XL","nozzle_diameter":0.4,"tools":[{"nozzle_diameter":0.4},{"nozzle_diameter":0.6}]}`
+	server := newMockPrinter(t, responses)
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	families := gatherMetrics(t, NewCollector(testConfig(config.Printers{
+		Address: printerAddress(server), Apikey: "test_api_key", Type: "XL",
+	})))
+
+	expected := map[string]float64{"tool0": 0.4, "tool1": 0.6}
+	for _, metric := range families[MetricPrinterNozzleSize].GetMetric() {
+		tool := labelValue(metric, "tool")
+		if metric.GetGauge().GetValue() != expected[tool] {
+			t.Errorf("nozzle size of %s = %v, expected %v", tool, metric.GetGauge().GetValue(), expected[tool])
+		}
+		delete(expected, tool)
+	}
+	if len(expected) != 0 {
+		t.Errorf("missing nozzle size for tools %v", expected)
+	}
+}
+
+func TestCollectorJobTargetTemperatures(t *testing.T) {
+	responses := defaultPrinterResponses()
+	responses["/api/job"] = `{"state":"Printing","job":{"file":{"name":"benchy.bgcode","path":"/usb/benchy.bgcode"}}}`
+	responses["/api/v1/job"] = `{"id":1,"state":"PRINTING","file":{"name":"benchy.bgcode","meta":{"temperature":215,"bed_temperature":60}}}`
+	server := newMockPrinter(t, responses)
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	families := gatherMetrics(t, NewCollector(testConfig(config.Printers{
+		Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4",
+	})))
+
+	if value := families[MetricPrinterJobTargetNozzle].GetMetric()[0].GetGauge().GetValue(); value != 215 {
+		t.Errorf("%s = %v, expected 215", MetricPrinterJobTargetNozzle, value)
+	}
+	if value := families[MetricPrinterJobTargetBed].GetMetric()[0].GetGauge().GetValue(); value != 60 {
+		t.Errorf("%s = %v, expected 60", MetricPrinterJobTargetBed, value)
+	}
+}
+
+func TestCollectorSpeedAndFlowPercent(t *testing.T) {
+	responses := defaultPrinterResponses()
+	responses["/api/printer"] = `{"state":{"text":"Printing","flags":{"printing":true}},"telemetry":{"print-speed":120}}`
+	responses["/api/v1/status"] = `{"printer":{"state":"PRINTING","flow":95}}`
+	server := newMockPrinter(t, responses)
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	families := gatherMetrics(t, NewCollector(testConfig(config.Printers{
+		Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4",
+	})))
+
+	expected := map[string]float64{
+		MetricPrinterPrintSpeedRatio:   1.2,
+		MetricPrinterPrintSpeedPercent: 120,
+		MetricPrinterFlow:              0.95,
+		MetricPrinterFlowPercent:       95,
+	}
+	for name, want := range expected {
+		family, ok := families[name]
+		if !ok {
+			t.Errorf("%s not collected", name)
+			continue
+		}
+		if value := family.GetMetric()[0].GetGauge().GetValue(); value != want {
+			t.Errorf("%s = %v, expected %v", name, value, want)
+		}
+	}
+}
+
+func TestCollectorLifetimeStats(t *testing.T) {
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	t.Run("supported", func(t *testing.T) {
+		responses := defaultPrinterResponses()
+		responses["/api/v1/stats"] = `{"total_prints":42,"total_print_time":360000,"filament_used":125500}`
+		server := newMockPrinter(t, responses)
+
+		families := gatherMetrics(t, NewCollector(testConfig(config.Printers{
+			Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4",
+		})))
+
+		expected := map[string]float64{
+			MetricPrinterLifetimePrints:    42,
+			MetricPrinterLifetimePrintTime: 360000,
+			MetricPrinterLifetimeFilament:  125.5,
+		}
+		for name, want := range expected {
+			family, ok := families[name]
+			if !ok {
+				t.Errorf("%s not collected", name)
+				continue
+			}
+			if value := family.GetMetric()[0].GetCounter().GetValue(); value != want {
+				t.Errorf("%s = %v, expected %v", name, value, want)
+			}
+		}
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		responses := defaultPrinterResponses()
+		server := newMockPrinter(t, responses)
+
+		collector := NewCollector(testConfig(config.Printers{
+			Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4",
+		}))
+		families := gatherMetrics(t, collector)
+
+		if _, ok := families[MetricPrinterLifetimePrints]; ok {
+			t.Errorf("%s collected for printer without stats endpoint", MetricPrinterLifetimePrints)
+		}
+		if _, ok := families[MetricPrinterUp]; !ok {
+			t.Errorf("%s not collected", MetricPrinterUp)
+		}
+
+		// endpoint added by firmware update is skipped until the retry interval passes
+		responses["/api/v1/stats"] = `{"total_prints":42,"total_print_time":360000,"filament_used":125500}`
+		if _, ok := gatherMetrics(t, collector)[MetricPrinterLifetimePrints]; ok {
+			t.Errorf("%s collected before retry interval passed", MetricPrinterLifetimePrints)
+		}
+
+		collector.unsupportedEndpoints[printerAddress(server)]["stats"] = time.Now().Add(-unsupportedEndpointRetryInterval)
+		if _, ok := gatherMetrics(t, collector)[MetricPrinterLifetimePrints]; !ok {
+			t.Errorf("%s not collected after retry interval passed", MetricPrinterLifetimePrints)
+		}
+	})
+}
+
+func TestCollectorUserInteractionRequired(t *testing.T) {
+	responses := defaultPrinterResponses()
+	responses["/api/printer"] = `{"state":{"text":"Waiting for user - M600","flags":{"paused":true}}}`
+	responses["/api/v1/status"] = `{"printer":{"state":"PAUSED"}}`
+	server := newMockPrinter(t, responses)
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	families := gatherMetrics(t, NewCollector(testConfig(config.Printers{
+		Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4",
+	})))
+
+	family, ok := families[MetricPrinterUserInteraction]
+	if !ok {
+		t.Fatalf("%s not collected", MetricPrinterUserInteraction)
+	}
+	if value := family.GetMetric()[0].GetGauge().GetValue(); value != 1 {
+		t.Errorf("%s = %v, expected 1", MetricPrinterUserInteraction, value)
+	}
+}
+
+func TestCollectorActivePrints(t *testing.T) {
+	newPrinter := func(printing bool, path string) config.Printers {
+		responses := defaultPrinterResponses()
+		if printing {
+			responses["/api/printer"] = `{"state":{"text":"Printing","flags":{"operational":true,"printing":true}}}`
+			responses["/api/job"] = `{"state":"Printing","job":{"file":{"name":"benchy.bgcode","path":"` + path + `"}}}`
+		}
+		server := newMockPrinter(t, responses)
+		return config.Printers{Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4"}
+	}
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	families := gatherMetrics(t, NewCollector(testConfig(
+		newPrinter(true, "/usb/benchy.bgcode"),
+		newPrinter(true, "/usb/cube.bgcode"),
+		newPrinter(true, "/local/benchy.bgcode"),
+		newPrinter(false, ""),
+	)))
+
+	family, ok := families[MetricActivePrints]
+	if !ok {
+		t.Fatalf("%s not collected", MetricActivePrints)
+	}
+	counts := map[string]float64{}
+	for _, metric := range family.GetMetric() {
+		counts[labelValue(metric, "origin")] = metric.GetGauge().GetValue()
+	}
+	expected := map[string]float64{"usb": 2, "local": 1}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("%s = %v, expected %v", MetricActivePrints, counts, expected)
+	}
+}
+
+func TestCollectorHeartbeatUnreachablePrinter(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	address := printerAddress(server)
+	server.Close()
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	before := time.Now().Unix()
+	families := gatherMetrics(t, NewCollector(testConfig(config.Printers{Address: address, Apikey: "test_api_key", Type: "MK4"})))
+
+	if value := families[MetricPrinterUp].GetMetric()[0].GetGauge().GetValue(); value != 0 {
+		t.Errorf("%s = %v, expected 0 for unreachable printer", MetricPrinterUp, value)
+	}
+
+	family, ok := families[MetricPrinterHeartbeat]
+	if !ok {
+		t.Fatalf("%s not collected for unreachable printer", MetricPrinterHeartbeat)
+	}
+	if value := family.GetMetric()[0].GetGauge().GetValue(); value < float64(before) || value > float64(time.Now().Unix()) {
+		t.Errorf("%s = %v, expected current unix time", MetricPrinterHeartbeat, value)
+	}
+}
+
+func TestCollectorFirmwareVersionCount(t *testing.T) {
+	var offline atomic.Bool
+	newPrinter := func(firmware string, canGoOffline bool) config.Printers {
+		responses := defaultPrinterResponses()
+		responses["/api/version"] = `{"api":"2.0.0","server":"2.1.2","firmware":"` + firmware + `"}`
+		mock := newMockPrinter(t, responses)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if canGoOffline && offline.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			mock.Config.Handler.ServeHTTP(w, r)
+		}))
+		t.Cleanup(server.Close)
+		return config.Printers{Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4"}
+	}
+
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachableAddress := printerAddress(unreachable)
+	unreachable.Close()
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	collector := NewCollector(testConfig(
+		newPrinter("6.2.3+8725", false),
+		newPrinter("6.2.3+8725", true),
+		newPrinter("6.1.0+7813", false),
+		config.Printers{Address: unreachableAddress, Apikey: "test_api_key", Type: "MK4"},
+	))
+
+	expected := map[string]float64{"6.2.3+8725": 2, "6.1.0+7813": 1}
+	for _, scrape := range []string{"all online", "one printer offline"} {
+		families := gatherMetrics(t, collector)
+		counts := map[string]float64{}
+		for _, metric := range families[MetricFirmwareVersionCount].GetMetric() {
+			counts[labelValue(metric, "version")] = metric.GetGauge().GetValue()
+		}
+		if !reflect.DeepEqual(counts, expected) {
+			t.Errorf("%s: %s = %v, expected %v", scrape, MetricFirmwareVersionCount, counts, expected)
+		}
+		offline.Store(true)
+	}
+}
+
+func TestCollectorEstimatedCompletion(t *testing.T) {
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	tests := []struct {
+		name      string
+		printer   string
+		remaining float64
+	}{
+		{"Printing", `{"state":{"text":"Printing","flags":{"printing":true}}}`, 3600},
+		{"Idle", `{"state":{"text":"Operational","flags":{"operational":true}}}`, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responses := defaultPrinterResponses()
+			responses["/api/printer"] = tt.printer
+			responses["/api/job"] = `{"state":"Printing","job":{"file":{"name":"benchy.bgcode","path":"/usb/benchy.bgcode"}},"progress":{"printTimeLeft":3600}}`
+			server := newMockPrinter(t, responses)
+
+			before := time.Now().Unix()
+			families := gatherMetrics(t, NewCollector(testConfig(config.Printers{
+				Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4",
+			})))
+			after := time.Now().Unix()
+
+			value := families[MetricPrinterEstimatedCompletion].GetMetric()[0].GetGauge().GetValue()
+			if tt.remaining == 0 {
+				if value != 0 {
+					t.Errorf("%s = %v, expected 0 when not printing", MetricPrinterEstimatedCompletion, value)
+				}
+				return
+			}
+			if value < float64(before)+tt.remaining || value > float64(after)+tt.remaining {
+				t.Errorf("%s = %v, expected now + %v", MetricPrinterEstimatedCompletion, value, tt.remaining)
+			}
+		})
+	}
+}
+
+func TestCollectorPrintStart(t *testing.T) {
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	responses := defaultPrinterResponses()
+	responses["/api/printer"] = `{"state":{"text":"Printing","flags":{"printing":true}}}`
+	responses["/api/job"] = `{"state":"Printing","job":{"file":{"name":"benchy.bgcode","path":"/usb/benchy.bgcode"}},"progress":{"printTime":600}}`
+	server := newMockPrinter(t, responses)
+
+	collector := NewCollector(testConfig(config.Printers{
+		Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4",
+	}))
+	printStart := func() float64 {
+		families := gatherMetrics(t, collector)
+		return families[MetricPrinterPrintStart].GetMetric()[0].GetGauge().GetValue()
+	}
+
+	before := time.Now().Unix()
+	start := printStart()
+	after := time.Now().Unix()
+	if start < float64(before-600) || start > float64(after-600) {
+		t.Fatalf("%s = %v, expected now - 600", MetricPrinterPrintStart, start)
+	}
+
+	// print time keeps advancing while paused, start of the job must not move
+	responses["/api/printer"] = `{"state":{"text":"Paused","flags":{"paused":true}}}`
+	responses["/api/job"] = `{"state":"Paused","job":{"file":{"name":"benchy.bgcode","path":"/usb/benchy.bgcode"}},"progress":{"printTime":1200}}`
+	if paused := printStart(); paused != start {
+		t.Errorf("%s = %v while paused, expected %v", MetricPrinterPrintStart, paused, start)
+	}
+
+	responses["/api/printer"] = `{"state":{"text":"Operational","flags":{"operational":true}}}`
+	responses["/api/job"] = `{"state":"Operational","job":{"file":{"name":"","path":""}}}`
+	if idle := printStart(); idle != 0 {
+		t.Errorf("%s = %v when not printing, expected 0", MetricPrinterPrintStart, idle)
+	}
+}
+
+func TestCollectorSensors(t *testing.T) {
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	tests := []struct {
+		name     string
+		status   string
+		expected map[string]float64
+	}{
+		{"Both sensors", `{"printer":{"state":"IDLE","filament_sensor":true,"door_sensor":false}}`,
+			map[string]float64{MetricPrinterFilamentSensor: 1, MetricPrinterDoorSensor: 0}},
+		{"Door open", `{"printer":{"state":"IDLE","filament_sensor":false,"door_sensor":true}}`,
+			map[string]float64{MetricPrinterFilamentSensor: 0, MetricPrinterDoorSensor: 1}},
+		{"Without door sensor", `{"printer":{"state":"IDLE","filament_sensor":true}}`,
+			map[string]float64{MetricPrinterFilamentSensor: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responses := defaultPrinterResponses()
+			responses["/api/v1/status"] = tt.status
+			server := newMockPrinter(t, responses)
+
+			families := gatherMetrics(t, NewCollector(testConfig(config.Printers{
+				Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4",
+			})))
+
+			for _, name := range []string{MetricPrinterFilamentSensor, MetricPrinterDoorSensor} {
+				family, collected := families[name]
+				expected, ok := tt.expected[name]
+				if collected != ok {
+					t.Errorf("%s collected = %t, expected %t", name, collected, ok)
+					continue
+				}
+				if ok && family.GetMetric()[0].GetGauge().GetValue() != expected {
+					t.Errorf("%s = %v, expected %v", name, family.GetMetric()[0].GetGauge().GetValue(), expected)
+				}
+			}
+		})
+	}
+}
+
+func TestCollectorBedMeshRange(t *testing.T) {
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	tests := []struct {
+		name     string
+		mesh     string
+		expected float64
+		reported bool
+	}{
+		{"Mesh", `{"points":[[0.05,-0.12,0.01],[0.2,0.0,-0.03]]}`, 0.00032, true},
+		{"Not calibrated", `{"points":[]}`, 0, false},
+		{"Not supported", "", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responses := defaultPrinterResponses()
+			if tt.mesh != "" {
+				responses["/api/v1/mesh"] = tt.mesh
+			}
+			server := newMockPrinter(t, responses)
+
+			families := gatherMetrics(t, NewCollector(testConfig(config.Printers{
+				Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4",
+			})))
+
+			family, ok := families[MetricPrinterBedMeshRange]
+			if ok != tt.reported {
+				t.Fatalf("%s collected = %t, expected %t", MetricPrinterBedMeshRange, ok, tt.reported)
+			}
+			if ok && math.Abs(family.GetMetric()[0].GetGauge().GetValue()-tt.expected) > 1e-9 {
+				t.Errorf("%s = %v, expected %v", MetricPrinterBedMeshRange, family.GetMetric()[0].GetGauge().GetValue(), tt.expected)
+			}
+			if families[MetricPrinterUp].GetMetric()[0].GetGauge().GetValue() != 1 {
+				t.Errorf("%s = 0, expected printer up regardless of mesh", MetricPrinterUp)
+			}
+		})
+	}
+}
+
+func TestCollectorPrinterEndpointFailure(t *testing.T) {
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	responses := defaultPrinterResponses()
+	delete(responses, "/api/printer")
+	responses["/api/job"] = `{"state":"Printing","job":{"file":{"name":"benchy.bgcode","path":"/usb/benchy.bgcode"}},"progress":{"completion":0.42,"printTime":600,"printTimeLeft":900}}`
+	server := newMockPrinter(t, responses)
+
+	families := gatherMetrics(t, NewCollector(testConfig(config.Printers{
+		Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4",
+	})))
+
+	if families[MetricPrinterUp].GetMetric()[0].GetGauge().GetValue() != 0 {
+		t.Errorf("%s = 1, expected 0 when printer endpoint fails", MetricPrinterUp)
+	}
+
+	expected := map[string]float64{
+		MetricPrinterCurrentJob:         1,
+		MetricPrinterPrintTime:          600,
+		MetricPrinterPrintTimeRemaining: 900,
+		MetricPrinterPrintProgressRatio: 0.42,
+	}
+	for name, value := range expected {
+		family, ok := families[name]
+		if !ok {
+			t.Errorf("%s not collected when printer endpoint fails", name)
+			continue
+		}
+		if got := family.GetMetric()[0].GetGauge().GetValue(); got != value {
+			t.Errorf("%s = %v, expected %v", name, got, value)
+		}
+	}
+	if labelValue(families[MetricPrinterCurrentJob].GetMetric()[0], "printer_job_name") != "benchy.bgcode" {
+		t.Errorf("%s labels = %v, expected printer_job_name benchy.bgcode", MetricPrinterCurrentJob, families[MetricPrinterCurrentJob].GetMetric()[0].GetLabel())
+	}
+}
+
+func TestCollectorFilesCount(t *testing.T) {
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	responses := defaultPrinterResponses()
+	responses["/api/files"] = `{"files":[
+		{"name":"usb","type":"folder","origin":"usb","children":[
+			{"name":"benchy.bgcode","type":"machinecode","origin":"usb"},
+			{"name":"CUBE.GCODE","type":"machinecode","origin":"usb"},
+			{"name":"parts","type":"folder","origin":"usb","children":[
+				{"name":"clip.gcode","type":"machinecode","origin":"usb"},
+				{"name":"notes.txt","type":"other","origin":"usb"}
+			]},
+			{"name":"firmware.bbf","type":"other","origin":"usb"}
+		]},
+		{"name":"local","type":"folder","origin":"local","children":[]}
+	]}`
+	server := newMockPrinter(t, responses)
+
+	families := gatherMetrics(t, NewCollector(testConfig(config.Printers{
+		Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4",
+	})))
+
+	family, ok := families[MetricPrinterFiles]
+	if !ok {
+		t.Fatalf("%s not collected", MetricPrinterFiles)
+	}
+	counts := map[string]float64{}
+	for _, metric := range family.GetMetric() {
+		counts[labelValue(metric, "printer_storage")+"/"+labelValue(metric, "file_type")] = metric.GetGauge().GetValue()
+	}
+	expected := map[string]float64{"usb/gcode": 3, "usb/other": 2, "usb/all": 5, "local/gcode": 0, "local/other": 0, "local/all": 0}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("%s = %v, expected %v", MetricPrinterFiles, counts, expected)
+	}
+}
+
+func TestCollectorQueueLength(t *testing.T) {
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	tests := []struct {
+		name     string
+		queue    string
+		expected float64
+		reported bool
+	}{
+		{"Queue", `{"jobs":[{"id":1,"path":"/usb/a.bgcode"},{"id":2,"path":"/usb/b.bgcode"},{"id":3,"path":"/usb/c.bgcode"}]}`, 3, true},
+		{"Empty queue", `{"jobs":[]}`, 0, true},
+		{"Not supported", "", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responses := defaultPrinterResponses()
+			if tt.queue != "" {
+				responses["/api/v1/queue"] = tt.queue
+			}
+			server := newMockPrinter(t, responses)
+
+			families := gatherMetrics(t, NewCollector(testConfig(config.Printers{
+				Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4",
+			})))
+
+			family, ok := families[MetricPrinterQueueLength]
+			if ok != tt.reported {
+				t.Fatalf("%s collected = %t, expected %t", MetricPrinterQueueLength, ok, tt.reported)
+			}
+			if ok && family.GetMetric()[0].GetGauge().GetValue() != tt.expected {
+				t.Errorf("%s = %v, expected %v", MetricPrinterQueueLength, family.GetMetric()[0].GetGauge().GetValue(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestCollectorLastScrapeSuccess(t *testing.T) {
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	var failing atomic.Bool
+	mock := newMockPrinter(t, defaultPrinterResponses())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		mock.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	collector := NewCollector(testConfig(config.Printers{
+		Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4",
+	}))
+	lastSuccess := func() (float64, bool) {
+		family, ok := gatherMetrics(t, collector)[MetricPrinterLastScrapeSuccess]
+		if !ok {
+			return 0, false
+		}
+		return family.GetMetric()[0].GetGauge().GetValue(), true
+	}
+
+	failing.Store(true)
+	if _, ok := lastSuccess(); ok {
+		t.Errorf("%s collected before any successful scrape", MetricPrinterLastScrapeSuccess)
+	}
+
+	failing.Store(false)
+	delete(collector.backoff.printers, printerAddress(server)) // retry without waiting for the backoff
+	before := time.Now().Unix()
+	succeeded, ok := lastSuccess()
+	if !ok || succeeded < float64(before) || succeeded > float64(time.Now().Unix()) {
+		t.Fatalf("%s = %v (collected %t), expected time of the scrape", MetricPrinterLastScrapeSuccess, succeeded, ok)
+	}
+
+	time.Sleep(1100 * time.Millisecond) // timestamp has second precision
+	failing.Store(true)
+	if failed, ok := lastSuccess(); !ok || failed != succeeded {
+		t.Errorf("%s = %v (collected %t) after failed scrape, expected %v", MetricPrinterLastScrapeSuccess, failed, ok, succeeded)
+	}
+}
+
+func TestCollectorHeaterPWM(t *testing.T) {
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	tests := []struct {
+		name     string
+		status   string
+		expected map[string]float64
+	}{
+		{"Both heaters", `{"printer":{"state":"PRINTING","heater_nozzle_pwm":45,"heater_bed_pwm":80}}`,
+			map[string]float64{"nozzle": 0.45, "bed": 0.8}},
+		{"Nozzle only", `{"printer":{"state":"PRINTING","heater_nozzle_pwm":100}}`,
+			map[string]float64{"nozzle": 1}},
+		{"Not reported", `{"printer":{"state":"IDLE"}}`, map[string]float64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responses := defaultPrinterResponses()
+			responses["/api/v1/status"] = tt.status
+			server := newMockPrinter(t, responses)
+
+			families := gatherMetrics(t, NewCollector(testConfig(config.Printers{
+				Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4",
+			})))
+
+			pwm := map[string]float64{}
+			for _, metric := range families[MetricPrinterHeaterPWM].GetMetric() {
+				pwm[labelValue(metric, "printer_heated_element")] = metric.GetGauge().GetValue()
+			}
+			if !reflect.DeepEqual(pwm, tt.expected) {
+				t.Errorf("%s = %v, expected %v", MetricPrinterHeaterPWM, pwm, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCollectorMaterialInfo(t *testing.T) {
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	tests := []struct {
+		material string
+		expected float64
+	}{
+		{"PETG", 1},
+		{"PLA-CF", 1},
+		{"---", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.material, func(t *testing.T) {
+			responses := defaultPrinterResponses()
+			responses["/api/printer"] = `{"state":{"text":"Operational","flags":{"operational":true}},"telemetry":{"material":"` + tt.material + `"}}`
+			server := newMockPrinter(t, responses)
+
+			families := gatherMetrics(t, NewCollector(testConfig(config.Printers{
+				Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4",
+			})))
+
+			family, ok := families[MetricPrinterMaterial]
+			if !ok {
+				t.Fatalf("%s not collected", MetricPrinterMaterial)
+			}
+			metric := family.GetMetric()[0]
+			if filament := labelValue(metric, "printer_filament"); filament != tt.material {
+				t.Errorf("%s printer_filament = %q, expected %q", MetricPrinterMaterial, filament, tt.material)
+			}
+			if value := metric.GetGauge().GetValue(); value != tt.expected {
+				t.Errorf("%s = %v, expected %v", MetricPrinterMaterial, value, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCollectorBackoff(t *testing.T) {
+	var (
+		jobRequests atomic.Int32
+		failing     atomic.Bool
+	)
+	failing.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/job" {
+			jobRequests.Add(1)
+		}
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, ok := defaultPrinterResponses()[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	cfg := testConfig(config.Printers{Address: printerAddress(server), Name: "Offline", Type: "MK4"})
+	cfg.PrusaLink.Backoff.Initial = 60
+	collector := NewCollector(cfg)
+
+	for i := range 3 {
+		families := gatherMetrics(t, collector)
+		if up := families[MetricPrinterUp].GetMetric()[0].GetGauge().GetValue(); up != 0 {
+			t.Errorf("prusa_up of failing printer in cycle %d = %v, expected 0", i, up)
+		}
+		if backoff := families[MetricPrinterScrapeBackoff].GetMetric()[0].GetGauge().GetValue(); backoff != 60 {
+			t.Errorf("prusa_scrape_backoff_seconds in cycle %d = %v, expected 60", i, backoff)
+		}
+	}
+	if requests := jobRequests.Load(); requests != 1 {
+		t.Errorf("failing printer was scraped %d times in 3 cycles, expected 1", requests)
+	}
+
+	// expired backoff is retried and reset by a successful scrape
+	failing.Store(false)
+	collector.backoff.printers[printerAddress(server)] = printerBackoff{failures: 1, delay: time.Minute}
+	families := gatherMetrics(t, collector)
+	if up := families[MetricPrinterUp].GetMetric()[0].GetGauge().GetValue(); up != 1 {
+		t.Errorf("prusa_up after expired backoff = %v, expected 1", up)
+	}
+	if backoff := families[MetricPrinterScrapeBackoff].GetMetric()[0].GetGauge().GetValue(); backoff != 0 {
+		t.Errorf("prusa_scrape_backoff_seconds after successful scrape = %v, expected 0", backoff)
+	}
+}
+
+func TestCollectorSLTemperatures(t *testing.T) {
+	responses := defaultPrinterResponses()
+	responses["/api/printer"] = `{
+		"telemetry":{"temp-bed":24.5,"tempCpu":51.2,"tempAmbient":23.1,"tempUvLed":38.7,"fanBlower":1200},
+		"temperature":{"tool0":{"actual":0,"target":0},"bed":{"actual":0,"target":0}},
+		"state":{"text":"Operational","flags":{"operational":true}}
+	}`
+	server := newMockPrinter(t, responses)
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	collector := NewCollector(testConfig(config.Printers{Address: printerAddress(server), Apikey: "test_api_key", Type: "SL1S"}))
+	families := gatherMetrics(t, collector)
+
+	temperatures := map[string]float64{}
+	for _, metric := range families[string(MetricPrinterTemp)].GetMetric() {
+		temperatures[labelValue(metric, "printer_heated_element")] = metric.GetGauge().GetValue()
+	}
+	expected := map[string]float64{"bed": 24.5, "cpu": 51.2, "ambient": 23.1, "uvled": 38.7}
+	if !reflect.DeepEqual(temperatures, expected) {
+		t.Errorf("%s = %v, expected %v", MetricPrinterTemp, temperatures, expected)
+	}
+
+	for _, metric := range families[string(MetricPrinterTempTarget)].GetMetric() {
+		if element := labelValue(metric, "printer_heated_element"); element == "tool0" {
+			t.Errorf("%s reported for nozzle of SL printer", MetricPrinterTempTarget)
+		}
+	}
+}
+
+func TestCollectorLegacyTelemetry(t *testing.T) {
+	responses := defaultPrinterResponses()
+	delete(responses, "/api/v1/status")
+	responses["/api/printer"] = `{
+		"telemetry":{"temp-bed":60.1,"temp-nozzle":215.3,"print-speed":100,"z-height":1.5,"material":"PLA"},
+		"state":{"text":"Printing","flags":{"operational":true,"printing":true}}
+	}`
+	server := newMockPrinter(t, responses)
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	families := gatherMetrics(t, NewCollector(testConfig(config.Printers{Address: printerAddress(server), Apikey: "test_api_key", Type: "MK3S"})))
+
+	temperatures := map[string]float64{}
+	for _, metric := range families[string(MetricPrinterTemp)].GetMetric() {
+		temperatures[labelValue(metric, "printer_heated_element")] = metric.GetGauge().GetValue()
+	}
+	if expected := map[string]float64{"bed": 60.1, "tool0": 215.3}; !reflect.DeepEqual(temperatures, expected) {
+		t.Errorf("%s = %v, expected %v", MetricPrinterTemp, temperatures, expected)
+	}
+
+	for _, metric := range families[string(MetricPrinterAxis)].GetMetric() {
+		if labelValue(metric, "printer_axis") == "z" && metric.GetGauge().GetValue() != 1.5 {
+			t.Errorf("%s z = %v, expected 1.5", MetricPrinterAxis, metric.GetGauge().GetValue())
+		}
+	}
+	if speed := families[string(MetricPrinterPrintSpeedPercent)].GetMetric()[0].GetGauge().GetValue(); speed != 100 {
+		t.Errorf("%s = %v, expected 100", MetricPrinterPrintSpeedPercent, speed)
+	}
+	material := families[string(MetricPrinterMaterial)].GetMetric()[0]
+	if labelValue(material, "printer_filament") != "PLA" || material.GetGauge().GetValue() != 1 {
+		t.Errorf("%s = %v with filament %q, expected 1 with PLA", MetricPrinterMaterial, material.GetGauge().GetValue(), labelValue(material, "printer_filament"))
+	}
+}
+
+func TestCollectorMotionSettings(t *testing.T) {
+	responses := defaultPrinterResponses()
+	responses["/api/v1/status"] = `{"printer":{"state":"PRINTING","acceleration":1250,"jerk":8}}`
+	withMotion := newMockPrinter(t, responses)
+	withoutMotion := newMockPrinter(t, defaultPrinterResponses())
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	families := gatherMetrics(t, NewCollector(testConfig(
+		config.Printers{Address: printerAddress(withMotion), Apikey: "test_api_key", Name: "Tuned", Type: "MK4"},
+		config.Printers{Address: printerAddress(withoutMotion), Apikey: "test_api_key", Name: "Stock", Type: "MK4"},
+	)))
+
+	for name, expected := range map[string]float64{MetricPrinterAcceleration: 1250, MetricPrinterJerk: 8} {
+		metrics := families[name].GetMetric()
+		if len(metrics) != 1 {
+			t.Fatalf("%s collected for %d printers, expected only the one reporting it", name, len(metrics))
+		}
+		if printer := labelValue(metrics[0], "printer_name"); printer != "Tuned" || metrics[0].GetGauge().GetValue() != expected {
+			t.Errorf("%s of %s = %v, expected %v of Tuned", name, printer, metrics[0].GetGauge().GetValue(), expected)
+		}
+	}
+}
+
+func TestCollectorDisabledPrinter(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	enabled := newMockPrinter(t, defaultPrinterResponses())
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	disabled := false
+	collector := NewCollector(testConfig(
+		config.Printers{Address: printerAddress(server), Name: "Disabled", Type: "MK4", Enabled: &disabled},
+		config.Printers{Address: printerAddress(enabled), Apikey: "test_api_key", Name: "Enabled", Type: "MK4"},
+	))
+	families := gatherMetrics(t, collector)
+
+	if requests.Load() != 0 {
+		t.Errorf("disabled printer received %d requests, expected none", requests.Load())
+	}
+
+	up := map[string]*dto.Metric{}
+	for _, metric := range families[MetricPrinterUp].GetMetric() {
+		up[labelValue(metric, "printer_name")] = metric
+	}
+	if metric, ok := up["Disabled"]; !ok || metric.GetGauge().GetValue() != 0 || labelValue(metric, "reason") != "disabled" {
+		t.Errorf("%s of disabled printer = %v, expected 0 with reason disabled", MetricPrinterUp, metric)
+	}
+	if metric, ok := up["Enabled"]; !ok || metric.GetGauge().GetValue() != 1 || labelValue(metric, "reason") != "" {
+		t.Errorf("%s of enabled printer = %v, expected 1 without reason", MetricPrinterUp, metric)
+	}
+	heartbeats := map[string]string{}
+	for _, metric := range families[MetricPrinterHeartbeat].GetMetric() {
+		heartbeats[labelValue(metric, "printer_name")] = labelValue(metric, "enabled")
+	}
+	if expected := map[string]string{"Disabled": "false", "Enabled": "true"}; !reflect.DeepEqual(heartbeats, expected) {
+		t.Errorf("%s enabled labels = %v, expected %v", MetricPrinterHeartbeat, heartbeats, expected)
+	}
+}
+
+func TestCollectorMetricPrefix(t *testing.T) {
+	server := newMockPrinter(t, defaultPrinterResponses())
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	cfg := testConfig(config.Printers{Address: printerAddress(server), Apikey: "test_api_key", Name: "TestPrinter", Type: "MK4"})
+	cfg.PrusaLink.Prefix = "farm_prusa_"
+	cfg.PrusaLink.DisableMetrics = []string{"farm_prusa_heartbeat"}
+	families := gatherMetrics(t, NewCollector(cfg))
+
+	for _, name := range []string{"farm_prusa_up", "farm_prusa_temperature_celsius", "farm_prusa_collections_total", "farm_prusa_scrape_latency_seconds"} {
+		if _, ok := families[name]; !ok {
+			t.Errorf("%s not collected with prefix farm_prusa_", name)
+		}
+	}
+	for name := range families {
+		if !strings.HasPrefix(name, "farm_prusa_") {
+			t.Errorf("%s collected without configured prefix", name)
+		}
+	}
+	if _, ok := families["farm_prusa_heartbeat"]; ok {
+		t.Error("farm_prusa_heartbeat collected although disabled with the configured prefix")
+	}
+}
+
+func TestCollectorScrapeErrors(t *testing.T) {
+	responses := defaultPrinterResponses()
+	delete(responses, "/api/printer")
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/status" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer failing.Close()
+	healthy := newMockPrinter(t, defaultPrinterResponses())
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	cfg := testConfig(
+		config.Printers{Address: printerAddress(failing), Apikey: "test_api_key", Name: "Failing", Type: "MK4"},
+		config.Printers{Address: printerAddress(healthy), Apikey: "test_api_key", Name: "Healthy", Type: "MK4"},
+	)
+	cfg.PrusaLink.Backoff.Initial = 1
+	collector := NewCollector(cfg)
+	families := gatherMetrics(t, collector)
+
+	if value := families["prusa_exporter_scrapes_total"].GetMetric()[0].GetCounter().GetValue(); value != 2 {
+		t.Errorf("prusa_exporter_scrapes_total = %v, expected 2", value)
+	}
+
+	errors := map[string]float64{}
+	for _, metric := range families["prusa_exporter_scrape_errors_total"].GetMetric() {
+		errors[labelValue(metric, "endpoint")] = metric.GetCounter().GetValue()
+	}
+	// printer endpoint fails the scrape, so the status endpoint is not reached
+	if expected := map[string]float64{"printer": 1}; !reflect.DeepEqual(errors, expected) {
+		t.Errorf("prusa_exporter_scrape_errors_total = %v, expected %v", errors, expected)
+	}
+
+	responses["/api/printer"] = defaultPrinterResponses()["/api/printer"]
+	delete(collector.backoff.printers, printerAddress(failing))
+	families = gatherMetrics(t, collector)
+
+	errors = map[string]float64{}
+	for _, metric := range families["prusa_exporter_scrape_errors_total"].GetMetric() {
+		errors[labelValue(metric, "endpoint")] = metric.GetCounter().GetValue()
+	}
+	if expected := map[string]float64{"printer": 1, "status": 1}; !reflect.DeepEqual(errors, expected) {
+		t.Errorf("prusa_exporter_scrape_errors_total = %v after status failed, expected %v", errors, expected)
+	}
+	if value := families["prusa_exporter_scrapes_total"].GetMetric()[0].GetCounter().GetValue(); value != 4 {
+		t.Errorf("prusa_exporter_scrapes_total = %v, expected 4", value)
+	}
+}
+
+func TestCollectorFilePosition(t *testing.T) {
+	responses := defaultPrinterResponses()
+	responses["/api/job"] = `{"state":"Printing","job":{"file":{"name":"benchy.gcode","path":"/usb/benchy.gcode","size":2097152}},"progress":{"completion":0.25,"filepos":524288}}`
+	responses["/api/printer"] = `{"state":{"text":"Printing","flags":{"printing":true}}}`
+	server := newMockPrinter(t, responses)
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	collector := NewCollector(testConfig(config.Printers{Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4"}))
+	gauge := func(families map[string]*dto.MetricFamily, name string) float64 {
+		return families[name].GetMetric()[0].GetGauge().GetValue()
+	}
+
+	families := gatherMetrics(t, collector)
+	if value := gauge(families, MetricPrinterFilePosition); value != 524288 {
+		t.Errorf("%s = %v, expected 524288", MetricPrinterFilePosition, value)
+	}
+	if value := gauge(families, MetricPrinterFileSize); value != 2097152 {
+		t.Errorf("%s = %v, expected 2097152", MetricPrinterFileSize, value)
+	}
+
+	// finished job is still reported by the job endpoint
+	responses["/api/job"] = `{"state":"Finished","job":{"file":{"name":"benchy.gcode","path":"/usb/benchy.gcode","size":2097152}},"progress":{"completion":1,"filepos":2097152}}`
+	responses["/api/printer"] = `{"state":{"text":"Finished","flags":{"operational":true,"finished":true}}}`
+	families = gatherMetrics(t, collector)
+	if value := gauge(families, MetricPrinterFilePosition); value != 0 {
+		t.Errorf("%s = %v when not printing, expected 0", MetricPrinterFilePosition, value)
+	}
+	if value := gauge(families, MetricPrinterFileSize); value != 0 {
+		t.Errorf("%s = %v when not printing, expected 0", MetricPrinterFileSize, value)
+	}
+}
+
+func TestCollectorBedSegments(t *testing.T) {
+	responses := defaultPrinterResponses()
+	responses["/api/printer"] = `{"temperature":{"tool0":{"actual":215},"bed":{"actual":60.2}},"state":{"text":"Operational","flags":{"operational":true}}}`
+	responses["/api/v1/status"] = `{"printer":{"state":"IDLE","temp_bed":60.2,"temp_bed_segments":[60.1,60.4,59.8,60.3]}}`
+	server := newMockPrinter(t, responses)
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	collector := NewCollector(testConfig(config.Printers{Address: printerAddress(server), Apikey: "test_api_key", Type: "XL"}))
+	temperatures := func() map[string]float64 {
+		result := map[string]float64{}
+		for _, metric := range gatherMetrics(t, collector)[string(MetricPrinterTemp)].GetMetric() {
+			result[labelValue(metric, "printer_heated_element")] = metric.GetGauge().GetValue()
+		}
+		return result
+	}
+
+	expected := map[string]float64{"bed": 60.2, "tool0": 215, "bed_0": 60.1, "bed_1": 60.4, "bed_2": 59.8, "bed_3": 60.3}
+	if result := temperatures(); !reflect.DeepEqual(result, expected) {
+		t.Errorf("%s of segmented bed = %v, expected %v", MetricPrinterTemp, result, expected)
+	}
+
+	responses["/api/v1/status"] = `{"printer":{"state":"IDLE","temp_bed":60.2}}`
+	expected = map[string]float64{"bed": 60.2, "tool0": 215}
+	if result := temperatures(); !reflect.DeepEqual(result, expected) {
+		t.Errorf("%s of single bed = %v, expected %v", MetricPrinterTemp, result, expected)
+	}
+}
+
+func TestCollectorElectronicsTemperatures(t *testing.T) {
+	responses := defaultPrinterResponses()
+	responses["/api/printer"] = `{"temperature":{"tool0":{"actual":215},"bed":{"actual":60}},"state":{"text":"Operational","flags":{"operational":true}}}`
+	responses["/api/v1/status"] = `{"printer":{"state":"IDLE","temp_mcu":42.5,"temp_board":35.25}}`
+	server := newMockPrinter(t, responses)
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	collector := NewCollector(testConfig(config.Printers{Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4"}))
+	temperatures := func() map[string]float64 {
+		result := map[string]float64{}
+		for _, metric := range gatherMetrics(t, collector)[string(MetricPrinterTemp)].GetMetric() {
+			result[labelValue(metric, "printer_heated_element")] = metric.GetGauge().GetValue()
+		}
+		return result
+	}
+
+	expected := map[string]float64{"bed": 60, "tool0": 215, "mcu": 42.5, "board": 35.25}
+	if result := temperatures(); !reflect.DeepEqual(result, expected) {
+		t.Errorf("%s = %v, expected %v", MetricPrinterTemp, result, expected)
+	}
+
+	responses["/api/v1/status"] = `{"printer":{"state":"IDLE"}}`
+	expected = map[string]float64{"bed": 60, "tool0": 215}
+	if result := temperatures(); !reflect.DeepEqual(result, expected) {
+		t.Errorf("%s without electronics temperatures = %v, expected %v", MetricPrinterTemp, result, expected)
+	}
+}
+
+func TestCollectorPrinterTags(t *testing.T) {
+	server := newMockPrinter(t, defaultPrinterResponses())
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	collector := NewCollector(testConfig(
+		config.Printers{Address: printerAddress(server), Apikey: "test_api_key", Name: "Tagged", Type: "MK4", Tags: []string{"prod", "room-a", "prod"}},
+		config.Printers{Address: printerAddress(server), Apikey: "test_api_key", Name: "Untagged", Type: "MK4"},
+	))
+
+	tags := map[string][]string{}
+	for _, metric := range gatherMetrics(t, collector)[MetricPrinterTag].GetMetric() {
+		if value := metric.GetGauge().GetValue(); value != 1 {
+			t.Errorf("%s = %v, expected 1", MetricPrinterTag, value)
+		}
+		name := labelValue(metric, "printer_name")
+		tags[name] = append(tags[name], labelValue(metric, "tag"))
+	}
+
+	expected := map[string][]string{"Tagged": {"prod", "room-a"}}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("%s tags = %v, expected %v", MetricPrinterTag, tags, expected)
+	}
+}
+
+func TestCollectorTemperatureDeviation(t *testing.T) {
+	responses := defaultPrinterResponses()
+	responses["/api/printer"] = `{"temperature":{"tool0":{"actual":212.5,"target":215},"bed":{"actual":58,"target":0}},"state":{"text":"Printing","flags":{"printing":true}}}`
+	server := newMockPrinter(t, responses)
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	collector := NewCollector(testConfig(config.Printers{Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4"}))
+	deviations := func() map[string]float64 {
+		result := map[string]float64{}
+		for _, metric := range gatherMetrics(t, collector)[MetricPrinterTempDeviation].GetMetric() {
+			result[labelValue(metric, "printer_heated_element")] = metric.GetGauge().GetValue()
+		}
+		return result
+	}
+
+	// bed target is not set
+	if result, expected := deviations(), map[string]float64{"tool0": -2.5}; !reflect.DeepEqual(result, expected) {
+		t.Errorf("%s = %v, expected %v", MetricPrinterTempDeviation, result, expected)
+	}
+
+	responses["/api/printer"] = `{"temperature":{"tool0":{"actual":216,"target":215},"bed":{"actual":61.5,"target":60}},"state":{"text":"Printing","flags":{"printing":true}}}`
+	if result, expected := deviations(), map[string]float64{"tool0": 1, "bed": 1.5}; !reflect.DeepEqual(result, expected) {
+		t.Errorf("%s = %v, expected %v", MetricPrinterTempDeviation, result, expected)
+	}
+}
+
+func TestCollectorStripAddressPort(t *testing.T) {
+	server := newMockPrinter(t, defaultPrinterResponses())
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	cfg := testConfig(config.Printers{Address: printerAddress(server), Apikey: "test_api_key", Name: "TestPrinter", Type: "MK4"})
+	cfg.PrusaLink.StripAddressPort = true
+	families := gatherMetrics(t, NewCollector(cfg))
+
+	for _, name := range []string{"prusa_up", "prusa_temperature_celsius"} {
+		family, ok := families[name]
+		if !ok {
+			t.Fatalf("%s not collected", name)
+		}
+		for _, metric := range family.GetMetric() {
+			if address := labelValue(metric, "printer_address"); address != "127.0.0.1" {
+				t.Errorf("%s printer_address = %q, want 127.0.0.1", name, address)
+			}
+		}
+	}
+	if up := families["prusa_up"].GetMetric()[0].GetGauge().GetValue(); up != 1 {
+		t.Errorf("prusa_up = %v, want 1 with requests sent to %s", up, printerAddress(server))
+	}
+}
+
+func TestCollectorStripAddressPortSharedHost(t *testing.T) {
+	first := newMockPrinter(t, defaultPrinterResponses())
+	second := newMockPrinter(t, defaultPrinterResponses())
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	cfg := testConfig(
+		config.Printers{Address: printerAddress(first), Apikey: "test_api_key", Name: "First", Type: "MK4"},
+		config.Printers{Address: printerAddress(second), Apikey: "test_api_key", Name: "Second", Type: "MK4"},
+	)
+	cfg.PrusaLink.StripAddressPort = true
+
+	addresses := map[string]string{}
+	for _, metric := range gatherMetrics(t, NewCollector(cfg))["prusa_up"].GetMetric() {
+		addresses[labelValue(metric, "printer_name")] = labelValue(metric, "printer_address")
+	}
+	if addresses["First"] != printerAddress(first) || addresses["Second"] != printerAddress(second) {
+		t.Errorf("prusa_up printer_address = %v, expected full addresses of printers on the same host", addresses)
+	}
+}
+
+func TestCollectorAPIVersionFallback(t *testing.T) {
+	legacyResponses := defaultPrinterResponses()
+	delete(legacyResponses, "/api/v1/status")
+	mock := newMockPrinter(t, legacyResponses)
+	var statusRequests atomic.Int32
+	legacy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/status" {
+			statusRequests.Add(1)
+		}
+		mock.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer legacy.Close()
+	v1 := newMockPrinter(t, defaultPrinterResponses())
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	collector := NewCollector(testConfig(
+		config.Printers{Address: printerAddress(legacy), Apikey: "test_api_key", Name: "MK3S", Type: "MK3S"},
+		config.Printers{Address: printerAddress(v1), Apikey: "test_api_key", Name: "MK4", Type: "MK4"},
+	))
+
+	for i := 0; i < 2; i++ {
+		families := gatherMetrics(t, collector)
+
+		versions := map[string]string{}
+		for _, metric := range families[MetricPrinterAPIVersion].GetMetric() {
+			versions[labelValue(metric, "printer_name")] = labelValue(metric, "version")
+		}
+		if versions["MK3S"] != APIVersionLegacy || versions["MK4"] != APIVersionV1 {
+			t.Errorf("scrape %d: %s versions = %v, expected MK3S legacy and MK4 v1", i, MetricPrinterAPIVersion, versions)
+		}
+		for _, metric := range families[MetricPrinterUp].GetMetric() {
+			if metric.GetGauge().GetValue() != 1 {
+				t.Errorf("scrape %d: %s of %s = %v, expected 1", i, MetricPrinterUp, labelValue(metric, "printer_name"), metric.GetGauge().GetValue())
+			}
+		}
+	}
+
+	if count := statusRequests.Load(); count != 1 {
+		t.Errorf("v1 status requested %d times from legacy printer, expected 1", count)
+	}
+
+	// firmware upgraded to v1 API, v1 is requested again after the recheck interval
+	legacyResponses["/api/v1/status"] = defaultPrinterResponses()["/api/v1/status"]
+	collector.apiChecked[printerAddress(legacy)] = time.Now().Add(-apiVersionRecheckInterval)
+	families := gatherMetrics(t, collector)
+
+	for _, metric := range families[MetricPrinterAPIVersion].GetMetric() {
+		if name, version := labelValue(metric, "printer_name"), labelValue(metric, "version"); name == "MK3S" && version != APIVersionV1 {
+			t.Errorf("%s of upgraded MK3S = %s, expected v1", MetricPrinterAPIVersion, version)
+		}
+	}
+	if count := statusRequests.Load(); count != 2 {
+		t.Errorf("v1 status requested %d times after recheck interval, expected 2", count)
+	}
+}
+
+func TestCollectorDecodeErrors(t *testing.T) {
+	responses := defaultPrinterResponses()
+	responses["/api/printer"] = `<html><body>Captive portal</body></html>`
+	server := newMockPrinter(t, responses)
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	families := gatherMetrics(t, NewCollector(testConfig(config.Printers{
+		Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4",
+	})))
+
+	errors := map[string]float64{}
+	for _, metric := range families["prusa_exporter_scrape_errors_total"].GetMetric() {
+		errors[labelValue(metric, "endpoint")+"/"+labelValue(metric, "type")] = metric.GetCounter().GetValue()
+	}
+	if expected := map[string]float64{"printer/decode": 1}; !reflect.DeepEqual(errors, expected) {
+		t.Errorf("prusa_exporter_scrape_errors_total = %v, expected %v", errors, expected)
+	}
+}
+
+func TestCollectorNameMismatch(t *testing.T) {
+	server := newMockPrinter(t, defaultPrinterResponses()) // device name is TestPrinter
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	tests := []struct {
+		configName string
+		expected   bool
+	}{
+		{"TestPrinter", false},
+		{"Garage MK4", true},
+	}
+
+	for _, tt := range tests {
+		families := gatherMetrics(t, NewCollector(testConfig(config.Printers{
+			Address: printerAddress(server), Apikey: "test_api_key", Name: tt.configName, Type: "MK4",
+		})))
+
+		family, ok := families[MetricPrinterNameMismatch]
+		if ok != tt.expected {
+			t.Fatalf("config name %q: %s collected = %t, expected %t", tt.configName, MetricPrinterNameMismatch, ok, tt.expected)
+		}
+		if !ok {
+			continue
+		}
+		metric := family.GetMetric()[0]
+		if labelValue(metric, "config_name") != tt.configName || labelValue(metric, "device_name") != "TestPrinter" {
+			t.Errorf("labels = %v, expected config_name=%s and device_name=TestPrinter", metric.GetLabel(), tt.configName)
+		}
+	}
+}
+
+func TestCollectorLastPrintCompleted(t *testing.T) {
+	var printerState atomic.Value
+	printerState.Store(`{"state":{"text":"Printing","flags":{"printing":true}}}`)
+
+	responses := defaultPrinterResponses()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.URL.Path]
+		if r.URL.Path == "/api/printer" {
+			body = printerState.Load().(string)
+		} else if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	collector := NewCollector(testConfig(config.Printers{Address: printerAddress(server), Apikey: "test_api_key", Name: "printer", Type: "MK4"}))
+
+	if _, ok := gatherMetrics(t, collector)[MetricPrinterLastPrintCompleted]; ok {
+		t.Fatalf("%s collected before any print completed", MetricPrinterLastPrintCompleted)
+	}
+
+	before := time.Now().Unix()
+	printerState.Store(`{"state":{"text":"Finished","flags":{"finished":true}}}`)
+
+	family, ok := gatherMetrics(t, collector)[MetricPrinterLastPrintCompleted]
+	if !ok {
+		t.Fatalf("%s not collected after printing to finished transition", MetricPrinterLastPrintCompleted)
+	}
+	completed := family.GetMetric()[0].GetGauge().GetValue()
+	if completed < float64(before) || completed > float64(time.Now().Unix()) {
+		t.Errorf("%s = %v, expected timestamp of the transition", MetricPrinterLastPrintCompleted, completed)
+	}
+
+	// staying finished keeps the timestamp of the transition
+	family = gatherMetrics(t, collector)[MetricPrinterLastPrintCompleted]
+	if value := family.GetMetric()[0].GetGauge().GetValue(); value != completed {
+		t.Errorf("%s = %v after another scrape, expected %v", MetricPrinterLastPrintCompleted, value, completed)
+	}
+}
+
+func TestCollectorLengthUnit(t *testing.T) {
+	responses := defaultPrinterResponses()
+	responses["/api/printer"] = `{"state":{"text":"Operational","flags":{"operational":true}},"telemetry":{"axis_x":120,"axis_y":80,"axis_z":15.5}}`
+	responses["/api/v1/stats"] = `{"total_prints":42,"total_print_time":360000,"filament_used":125500}`
+	server := newMockPrinter(t, responses)
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	tests := []struct {
+		unit         string
+		nozzleName   string
+		axisName     string
+		filamentName string
+		nozzle       float64
+		axisZ        float64
+		filament     float64
+	}{
+		{LengthUnitLegacy, "prusa_nozzle_size_meters", "prusa_axis", "prusa_lifetime_filament_used_meters_total", 0.4, 15.5, 125.5},
+		{LengthUnitMeters, "prusa_nozzle_size_meters", "prusa_axis", "prusa_lifetime_filament_used_meters_total", 0.0004, 0.0155, 125.5},
+		{LengthUnitMillimeters, "prusa_nozzle_size_millimeters", "prusa_axis_millimeters", "prusa_lifetime_filament_used_millimeters_total", 0.4, 15.5, 125500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.unit, func(t *testing.T) {
+			cfg := testConfig(config.Printers{Address: printerAddress(server), Apikey: "test_api_key", Type: "MK4"})
+			cfg.PrusaLink.LengthUnit = tt.unit
+			families := gatherMetrics(t, NewCollector(cfg))
+
+			nozzle, ok := families[tt.nozzleName]
+			if !ok {
+				t.Fatalf("%s not collected", tt.nozzleName)
+			}
+			if value := nozzle.GetMetric()[0].GetGauge().GetValue(); value != tt.nozzle {
+				t.Errorf("%s = %v, expected %v", tt.nozzleName, value, tt.nozzle)
+			}
+
+			axis, ok := families[tt.axisName]
+			if !ok {
+				t.Fatalf("%s not collected", tt.axisName)
+			}
+			for _, metric := range axis.GetMetric() {
+				if labelValue(metric, "printer_axis") == "z" && metric.GetGauge().GetValue() != tt.axisZ {
+					t.Errorf("%s{printer_axis=\"z\"} = %v, expected %v", tt.axisName, metric.GetGauge().GetValue(), tt.axisZ)
+				}
+			}
+
+			filament, ok := families[tt.filamentName]
+			if !ok {
+				t.Fatalf("%s not collected", tt.filamentName)
+			}
+			if value := filament.GetMetric()[0].GetCounter().GetValue(); value != tt.filament {
+				t.Errorf("%s = %v, expected %v", tt.filamentName, value, tt.filament)
+			}
+		})
+	}
+}
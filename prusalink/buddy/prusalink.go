@@ -2,13 +2,20 @@ package prusalink
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"image"
 	"image/png"
 	"io"
+	"math"
 	"net/http"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -49,6 +56,19 @@ var (
 
 	configuration config.Config
 	configMutex   sync.RWMutex
+
+	// bytes of response bodies read from printers, keyed by printer address
+	responseBytes      = map[string]float64{}
+	responseBytesMutex sync.Mutex
+
+	// HTTP status codes of the last request to the printer endpoints, keyed by printer address and path
+	httpStatuses      = map[string]map[string]int{}
+	httpStatusesMutex sync.Mutex
+
+	// digest transports reused across requests, so the challenge is cached and not renegotiated
+	// on every request, keyed by printer address and credentials
+	digestTransports      = map[string]*digest.Transport{}
+	digestTransportsMutex sync.Mutex
 )
 
 // GetConfiguration safely returns a copy of the current configuration
@@ -65,15 +85,122 @@ func SetConfiguration(newConfig config.Config) {
 	configuration = newConfig
 }
 
-// UpdatePrinterUDPStatus safely updates the UDP metrics enabled status for a specific printer
-func UpdatePrinterUDPStatus(index int, enabled bool) {
+// getDigestTransport returns digest transport of the printer, a new one is created when credentials change
+func getDigestTransport(printer config.Printers) *digest.Transport {
+	key := printer.Address + "\xff" + printer.Username + "\xff" + printer.Password
+
+	digestTransportsMutex.Lock()
+	defer digestTransportsMutex.Unlock()
+	transport, ok := digestTransports[key]
+	if !ok {
+		transport = &digest.Transport{
+			Username:  printer.Username,
+			Password:  printer.Password,
+			Transport: printerTransport,
+		}
+		digestTransports[key] = transport
+	}
+	return transport
+}
+
+// authType returns authentication type of the printer, printers without auth_type use API key when it is set
+func authType(printer config.Printers) string {
+	if printer.AuthType != "" {
+		return printer.AuthType
+	}
+	if printer.Apikey != "" {
+		return config.AuthAPIKey
+	}
+	return config.AuthDigest
+}
+
+// authTransport returns transport of requests to the printer, digest authentication is handled by the transport
+func authTransport(printer config.Printers) http.RoundTripper {
+	if authType(printer) == config.AuthDigest {
+		return getDigestTransport(printer)
+	}
+	return printerTransport
+}
+
+// authorizeRequest sets basic auth or API key credentials of the printer on the request
+func authorizeRequest(req *http.Request, printer config.Printers) {
+	switch authType(printer) {
+	case config.AuthBasic:
+		req.SetBasicAuth(printer.Username, printer.Password)
+	case config.AuthAPIKey:
+		req.Header.Add("X-Api-Key", printer.Apikey)
+	}
+}
+
+// DefaultUserAgent is User-Agent header of requests to printers unless overridden by http.user-agent flag
+var DefaultUserAgent = "prusa_exporter/" + exporterVersion()
+
+// exporterVersion returns version of the exporter module, dev for builds without version information
+func exporterVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
+
+// setUserAgent sets User-Agent header of the request to the printer, some firewalls block requests without it
+func setUserAgent(req *http.Request) {
+	userAgent := GetConfiguration().Exporter.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+}
+
+// recordResponseBytes adds size of response body read from the printer
+func recordResponseBytes(address string, size int) {
+	responseBytesMutex.Lock()
+	defer responseBytesMutex.Unlock()
+	responseBytes[address] += float64(size)
+}
+
+// getResponseBytes returns total bytes of response bodies read from the printer
+func getResponseBytes(address string) float64 {
+	responseBytesMutex.Lock()
+	defer responseBytesMutex.Unlock()
+	return responseBytes[address]
+}
+
+// recordHTTPStatus remembers HTTP status code of the last request to the printer endpoint, -1 for connection errors
+func recordHTTPStatus(address, path string, statusCode int) {
+	httpStatusesMutex.Lock()
+	defer httpStatusesMutex.Unlock()
+	if httpStatuses[address] == nil {
+		httpStatuses[address] = map[string]int{}
+	}
+	httpStatuses[address][path] = statusCode
+}
+
+// getHTTPStatus returns HTTP status code of the last request to the printer endpoint
+func getHTTPStatus(address, path string) (int, bool) {
+	httpStatusesMutex.Lock()
+	defer httpStatusesMutex.Unlock()
+	statusCode, ok := httpStatuses[address][path]
+	return statusCode, ok
+}
+
+// UpdatePrinterUDPStatus safely updates the UDP metrics enabled status and its reason for a specific printer
+func UpdatePrinterUDPStatus(index int, enabled bool, reason string) {
 	configMutex.Lock()
 	defer configMutex.Unlock()
 	if index >= 0 && index < len(configuration.Printers) {
 		configuration.Printers[index].UDPMetricsEnabled = enabled
+		configuration.Printers[index].UDPMetricsReason = reason
 	}
 }
 
+// materialLoaded returns true if the printer reports loaded filament, "---" means no filament.
+// Custom materials like PLA-CF may contain dash too, so only the placeholder is treated as empty.
+func materialLoaded(material string) bool {
+	material = strings.TrimSpace(material)
+	return material != "" && strings.Trim(material, "-") != ""
+}
+
 // BoolToFloat is used for basic parsing boolean to float64
 // 0.0 for false, 1.0 for true
 func BoolToFloat(boolean bool) float64 {
@@ -87,250 +214,621 @@ func BoolToFloat(boolean bool) float64 {
 // getStateFlag returns the state flag for the given printer.
 // The state flag is a float64 value representing the current state of the printer.
 // It is used for tracking the printer's status and progress.
+//
+// 0 no flags, 1 operational, 2 prepared, 3 paused, 4 printing, 5 cancelling, 6 pausing, 7 error,
+// 8 sd ready, 9 closed on error, 10 ready, 11 busy, 12 finished, 13 attention
+//
+// Printers report generic flags like operational together with specific ones like busy or finished,
+// so specific states take precedence.
 func getStateFlag(printer Printer) float64 {
-	if printer.State.Flags.Operational {
-		return 1
-	} else if printer.State.Flags.Prepared {
-		return 2
-	} else if printer.State.Flags.Paused {
-		return 3
-	} else if printer.State.Flags.Printing {
-		return 4
-	} else if printer.State.Flags.Cancelling {
-		return 5
-	} else if printer.State.Flags.Pausing {
-		return 6
-	} else if printer.State.Flags.Error {
+	flags := printer.State.Flags
+	switch {
+	case strings.EqualFold(flags.LinkState, "ATTENTION") || strings.EqualFold(printer.State.Text, "Attention"):
+		return 13
+	case flags.Error:
 		return 7
-	} else if printer.State.Flags.SdReady {
-		return 8
-	} else if printer.State.Flags.ClosedOrError || printer.State.Flags.ClosedOnError {
+	case flags.ClosedOrError || flags.ClosedOnError:
 		return 9
-	} else if printer.State.Flags.Ready {
-		return 10
-	} else if printer.State.Flags.Busy {
-		return 11
-	} else if printer.State.Flags.Finished {
+	case flags.Cancelling:
+		return 5
+	case flags.Pausing:
+		return 6
+	case flags.Paused:
+		return 3
+	case flags.Printing:
+		return 4
+	case flags.Finished:
 		return 12
-	} else {
+	case flags.Busy:
+		return 11
+	case flags.Prepared:
+		return 2
+	case flags.Operational:
+		return 1
+	case flags.Ready:
+		return 10
+	case flags.SdReady:
+		return 8
+	default:
 		return 0
 	}
 }
 
-// accessPrinterEndpoint is used to access the printer's API endpoint
-func accessPrinterEndpoint(path string, printer config.Printers) ([]byte, error) {
-	url := string("http://" + printer.Address + path)
+// temperature is the temperature of printer element reported as printer_heated_element
+type temperature struct {
+	element string
+	value   float64
+}
+
+// isSLPrinter returns true for resin printers, these report temperatures in telemetry and have no nozzle
+func isSLPrinter(printerType string) bool {
+	return strings.HasPrefix(strings.ToUpper(printerType), "SL")
+}
+
+// getTemperatures returns current temperatures of printer elements, segments of segmented heatbed
+// are reported as bed_N in addition to the aggregate bed, MCU and board only if reported by the firmware
+func getTemperatures(printer Printer, status Status, printerType string) []temperature {
+	if isSLPrinter(printerType) {
+		return []temperature{
+			{"bed", printer.Telemetry.TempBed},
+			{"cpu", printer.Telemetry.TempCPU},
+			{"ambient", printer.Telemetry.TempAmbient},
+			{"uvled", printer.Telemetry.TempUvLed},
+		}
+	}
+	temperatures := []temperature{
+		{"bed", printer.Temperature.Bed.Actual},
+		{"tool0", printer.Temperature.Tool0.Actual},
+	}
+	for i, segment := range status.Printer.TempBedSegments {
+		temperatures = append(temperatures, temperature{"bed_" + strconv.Itoa(i), segment})
+	}
+	if status.Printer.TempMCU != nil {
+		temperatures = append(temperatures, temperature{"mcu", *status.Printer.TempMCU})
+	}
+	if status.Printer.TempBoard != nil {
+		temperatures = append(temperatures, temperature{"board", *status.Printer.TempBoard})
+	}
+	return temperatures
+}
+
+// getTargetTemperatures returns target temperatures of printer elements, SL printers have no nozzle
+func getTargetTemperatures(printer Printer, printerType string) []temperature {
+	if isSLPrinter(printerType) {
+		return []temperature{{"bed", printer.Temperature.Bed.Target}}
+	}
+	return []temperature{
+		{"bed", printer.Temperature.Bed.Target},
+		{"tool0", printer.Temperature.Tool0.Target},
+	}
+}
+
+// getTemperatureDeviations returns difference of actual temperature from target of elements with target set
+func getTemperatureDeviations(printer Printer, status Status, printerType string) []temperature {
+	actual := map[string]float64{}
+	for _, temp := range getTemperatures(printer, status, printerType) {
+		actual[temp.element] = temp.value
+	}
+
+	var deviations []temperature
+	for _, target := range getTargetTemperatures(printer, printerType) {
+		if value, ok := actual[target.element]; ok && target.value > 0 {
+			deviations = append(deviations, temperature{target.element, value - target.value})
+		}
+	}
+	return deviations
+}
+
+// getNozzleDiameters returns nozzle diameter per tool, single tool printers report only the info nozzle diameter
+func getNozzleDiameters(info Info) []float64 {
+	if len(info.Tools) == 0 {
+		return []float64{info.NozzleDiameter}
+	}
+
+	diameters := make([]float64, len(info.Tools))
+	for i, tool := range info.Tools {
+		diameters[i] = tool.NozzleDiameter
+	}
+	return diameters
+}
+
+// HTTPError is returned when the printer responds with an HTTP error status code
+type HTTPError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("HTTP error: %d %s", e.StatusCode, e.Status)
+}
+
+// decodeErrorBodyLength is number of bytes of the response body included in DecodeError
+const decodeErrorBodyLength = 100
+
+// DecodeError is returned when the printer responds with a body that is not valid JSON, e.g. a captive portal page
+type DecodeError struct {
+	Address  string
+	Endpoint string
+	Body     string // beginning of the response body
+	Err      error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("failed to decode %s response from %s: %v, body: %q", e.Endpoint, e.Address, e.Err, e.Body)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// decodeResponse unmarshals JSON response of the printer endpoint, the error contains beginning of the body
+func decodeResponse(response []byte, v any, path string, printer config.Printers) error {
+	err := json.Unmarshal(response, v)
+	if err == nil {
+		return nil
+	}
+	body := response
+	if len(body) > decodeErrorBodyLength {
+		body = body[:decodeErrorBodyLength]
+	}
+	return &DecodeError{Address: printer.Address, Endpoint: path, Body: string(body), Err: err}
+}
+
+// isNotFound returns true if the error is HTTP 404 returned by the printer
+func isNotFound(err error) bool {
+	var httpErr *HTTPError
+	return errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound
+}
+
+// firmwareVersion returns firmware version of the printer, older firmware reports it only as server version
+func firmwareVersion(version Version) string {
+	if version.Firmware != "" {
+		return version.Firmware
+	}
+	return version.Server
+}
+
+// jobOrigin returns origin of the job file, firmware not reporting origin falls back to the first segment of the path
+func jobOrigin(job Job) string {
+	if job.Job.File.Origin != "" {
+		return job.Job.File.Origin
+	}
+
+	origin, _, found := strings.Cut(strings.TrimPrefix(job.Job.File.Path, "/"), "/")
+	if !found || origin == "" {
+		return "unknown"
+	}
+	return strings.ToLower(origin)
+}
+
+// userInteractionStates are fragments of the state text reported while the printer waits for the user
+var userInteractionStates = []string{"m600", "waiting for user", "attention", "change filament"}
+
+// userInteractionRequired returns true if the printer reports attention state
+// or is paused with state text indicating that it waits for the user
+func userInteractionRequired(printer Printer, status Status) bool {
+	if strings.EqualFold(status.Printer.State, "ATTENTION") {
+		return true
+	}
+
+	if !printer.State.Flags.Paused {
+		return false
+	}
+
+	text := strings.ToLower(printer.State.Text)
+	return slices.ContainsFunc(userInteractionStates, func(state string) bool {
+		return strings.Contains(text, state)
+	})
+}
+
+// stateFlag is a single boolean state flag of the printer
+type stateFlag struct {
+	name  string
+	value bool
+}
+
+// getStateFlags returns all boolean state flags of the printer, unlike getStateFlag nothing is collapsed
+func getStateFlags(printer Printer) []stateFlag {
+	flags := printer.State.Flags
+	return []stateFlag{
+		{"operational", flags.Operational},
+		{"prepared", flags.Prepared},
+		{"paused", flags.Paused},
+		{"printing", flags.Printing},
+		{"cancelling", flags.Cancelling},
+		{"pausing", flags.Pausing},
+		{"error", flags.Error},
+		{"sd_ready", flags.SdReady},
+		{"closed_on_error", flags.ClosedOnError},
+		{"closed_or_error", flags.ClosedOrError},
+		{"ready", flags.Ready},
+		{"busy", flags.Busy},
+		{"finished", flags.Finished},
+	}
+}
+
+// printerTimeout returns HTTP timeout for requests to the printer, the default is used when printer does not override it
+func printerTimeout(printer config.Printers, defaultTimeout time.Duration) time.Duration {
+	if printer.Timeout > 0 {
+		return time.Duration(printer.Timeout) * time.Second
+	}
+	return defaultTimeout
+}
+
+// accessPrinterEndpoint is used to access the printer's API endpoint. Returns response body and HTTP status code,
+// status code is -1 if the request failed before receiving the response. The request is aborted when ctx is done.
+func accessPrinterEndpoint(ctx context.Context, path string, printer config.Printers) ([]byte, int, error) {
+	cfg := GetConfiguration()
+	return accessPrinterEndpointTimeout(ctx, path, printer, printerTimeout(printer, 5*time.Duration(cfg.Exporter.ScrapeTimeout)*time.Second))
+}
+
+// accessPrinterEndpointTimeout is accessPrinterEndpoint with timeout of the request, e.g. longer for job images
+func accessPrinterEndpointTimeout(ctx context.Context, path string, printer config.Printers, timeout time.Duration) ([]byte, int, error) {
+	url := printerURL(printer.Address, path)
 	var (
 		res    *http.Response
 		result []byte
 		err    error
 	)
 
-	cfg := GetConfiguration()
-	if printer.Apikey == "" {
-		client := &http.Client{
-			Transport: &digest.Transport{
-				Username: printer.Username,
-				Password: printer.Password,
-			},
-			Timeout: 5 * time.Duration(cfg.Exporter.ScrapeTimeout) * time.Second,
-		}
-		res, err = client.Get(url)
-
-		if err != nil {
-			return result, err
-		}
-	} else {
-		req, err := http.NewRequest("GET", url, nil)
-		client := &http.Client{
-			Timeout: 5 * time.Duration(cfg.Exporter.ScrapeTimeout) * time.Second,
-		}
+	refreshPrinterAddress(printer.Address)
 
-		if err != nil {
-			return result, err
-		}
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return result, -1, err
+	}
+	authorizeRequest(req, printer)
+	setUserAgent(req)
 
-		req.Header.Add("X-Api-Key", printer.Apikey)
-		res, err = client.Do(req)
-		if err != nil {
-			return result, err
-		}
+	client := &http.Client{
+		Transport: authTransport(printer),
+		Timeout:   timeout,
 	}
+	res, err = client.Do(req)
+	if err != nil {
+		recordHTTPStatus(printer.Address, path, -1)
+		return result, -1, err
+	}
+
+	recordHTTPStatus(printer.Address, path, res.StatusCode)
 
 	// Check for HTTP error status codes
 	if res.StatusCode >= 400 {
 		res.Body.Close()
-		return nil, fmt.Errorf("HTTP error: %d %s", res.StatusCode, res.Status)
+		return nil, res.StatusCode, &HTTPError{StatusCode: res.StatusCode, Status: res.Status}
 	}
 
 	result, err = io.ReadAll(res.Body)
 	res.Body.Close()
+	recordResponseBytes(printer.Address, len(result))
 
 	if err != nil {
 		log.Error().Msg(err.Error())
 	}
 
-	return result, nil
+	return result, res.StatusCode, nil
 }
 
 // GetVersion is used to get the printer's version API endpoint
-func GetVersion(printer config.Printers) (Version, error) {
+func GetVersion(ctx context.Context, printer config.Printers) (Version, error) {
 	var version Version
-	response, err := accessPrinterEndpoint("/api/version", printer)
+	response, _, err := accessPrinterEndpoint(ctx, "/api/version", printer)
 
 	if err != nil {
 		return version, err
 	}
 
-	err = json.Unmarshal(response, &version)
+	err = decodeResponse(response, &version, "/api/version", printer)
 
 	return version, err
 }
 
 // GetJob is used to get the printer's job API endpoint
-func GetJob(printer config.Printers) (Job, error) {
+func GetJob(ctx context.Context, printer config.Printers) (Job, error) {
 	var job Job
-	response, err := accessPrinterEndpoint("/api/job", printer)
+	response, _, err := accessPrinterEndpoint(ctx, "/api/job", printer)
 
 	if err != nil {
 		return job, err
 	}
 
-	err = json.Unmarshal(response, &job)
+	err = decodeResponse(response, &job, "/api/job", printer)
 
 	return job, err
 }
 
 // GetPrinter is used to get the printer's printer API endpoint
-func GetPrinter(printer config.Printers) (Printer, error) {
+func GetPrinter(ctx context.Context, printer config.Printers) (Printer, error) {
 	var printerData Printer
-	response, err := accessPrinterEndpoint("/api/printer", printer)
+	response, _, err := accessPrinterEndpoint(ctx, "/api/printer", printer)
 
 	if err != nil {
 		return printerData, err
 	}
 
-	err = json.Unmarshal(response, &printerData)
+	err = decodeResponse(response, &printerData, "/api/printer", printer)
+	applyLegacyTelemetry(&printerData)
 
 	return printerData, err
 }
 
+// applyLegacyTelemetry fills temperatures and Z axis missing in the printer endpoint of firmware that reports
+// them only in legacy telemetry (temp-nozzle, temp-bed, z-height), so they end up in the same metrics
+func applyLegacyTelemetry(printer *Printer) {
+	tool0 := &printer.Temperature.Tool0
+	if tool0.Actual == 0 && tool0.Target == 0 {
+		tool0.Actual = printer.Telemetry.TempNozzle
+	}
+	bed := &printer.Temperature.Bed
+	if bed.Actual == 0 && bed.Target == 0 {
+		bed.Actual = printer.Telemetry.TempBed
+	}
+	if printer.Telemetry.AxisZ == 0 {
+		printer.Telemetry.AxisZ = printer.Telemetry.ZHeight
+	}
+}
+
 // GetFiles is used to get the printer's files API endpoint
-func GetFiles(printer config.Printers) (Files, error) {
+func GetFiles(ctx context.Context, printer config.Printers) (Files, error) {
 	var files Files
-	response, err := accessPrinterEndpoint("/api/files?recursive=true", printer)
+	response, _, err := accessPrinterEndpoint(ctx, "/api/files?recursive=true", printer)
 
 	if err != nil {
 		return files, err
 	}
 
-	err = json.Unmarshal(response, &files)
+	err = decodeResponse(response, &files, "/api/files?recursive=true", printer)
 
 	return files, err
 }
 
+// gcodeExtensions are extensions of files the printer can print
+var gcodeExtensions = []string{".gcode", ".bgcode", ".gco", ".g"}
+
+// countFiles returns number of files per storage and file type (gcode or other), folders are not counted.
+// Storage is the top level folder, files outside of any folder are counted in their origin.
+func countFiles(files Files) map[string]map[string]float64 {
+	counts := map[string]map[string]float64{}
+	var walk func(storage string, entries []File)
+	walk = func(storage string, entries []File) {
+		for _, entry := range entries {
+			if entry.Type == "folder" {
+				walk(storage, entry.Children)
+				continue
+			}
+			fileType := "other"
+			if slices.ContainsFunc(gcodeExtensions, func(extension string) bool {
+				return strings.HasSuffix(strings.ToLower(entry.Name), extension)
+			}) {
+				fileType = "gcode"
+			}
+			if counts[storage] == nil {
+				counts[storage] = map[string]float64{}
+			}
+			counts[storage][fileType]++
+		}
+	}
+
+	for _, entry := range files.Files {
+		if entry.Type == "folder" {
+			counts[entry.Name] = map[string]float64{} // empty storage is reported with zero counts
+			walk(entry.Name, entry.Children)
+		} else {
+			walk(entry.Origin, []File{entry})
+		}
+	}
+	return counts
+}
+
 // GetJobV1 is used to get the printer's job v1 API endpoint
-func GetJobV1(printer config.Printers) (JobV1, error) {
+func GetJobV1(ctx context.Context, printer config.Printers) (JobV1, error) {
 	var job JobV1
-	response, err := accessPrinterEndpoint("/api/v1/job", printer)
+	response, _, err := accessPrinterEndpoint(ctx, "/api/v1/job", printer)
 
-	if err != nil {
+	if err != nil || len(response) == 0 { // 204 No Content when there is no job
 		return job, err
 	}
 
-	err = json.Unmarshal(response, &job)
+	err = decodeResponse(response, &job, "/api/v1/job", printer)
 
 	return job, err
 }
 
 // GetStatus is used to get Buddy status endpoint
-func GetStatus(printer config.Printers) (Status, error) {
+func GetStatus(ctx context.Context, printer config.Printers) (Status, error) {
 	var status Status
-	response, err := accessPrinterEndpoint("/api/v1/status", printer)
+	response, _, err := accessPrinterEndpoint(ctx, "/api/v1/status", printer)
 
 	if err != nil {
 		return status, err
 	}
 
-	err = json.Unmarshal(response, &status)
+	err = decodeResponse(response, &status, "/api/v1/status", printer)
 
 	return status, err
 }
 
+// API versions the printer status is read from
+const (
+	APIVersionV1     = "v1"
+	APIVersionLegacy = "legacy"
+)
+
+// GetStatusWithFallback is used to get Buddy status endpoint. Firmware without v1 API (e.g. MK3S) returns 404
+// and the status is converted from already fetched legacy printer endpoint. Returns API version the status is read from.
+func GetStatusWithFallback(ctx context.Context, printer config.Printers, legacy Printer) (Status, string, error) {
+	status, err := GetStatus(ctx, printer)
+	if !isNotFound(err) {
+		return status, APIVersionV1, err
+	}
+	return legacyStatus(legacy), APIVersionLegacy, nil
+}
+
+// legacyStatus converts legacy printer endpoint to status, fields not provided by the legacy API stay empty
+func legacyStatus(printer Printer) Status {
+	var status Status
+	status.Printer.State = strings.ToUpper(printer.State.Text)
+	status.Printer.TempBed = printer.Temperature.Bed.Actual
+	status.Printer.TargetBed = printer.Temperature.Bed.Target
+	status.Printer.TempNozzle = printer.Temperature.Tool0.Actual
+	status.Printer.TargetNozzle = printer.Temperature.Tool0.Target
+	status.Printer.AxisX = printer.Telemetry.AxisX
+	status.Printer.AxisY = printer.Telemetry.AxisY
+	status.Printer.AxisZ = printer.Telemetry.AxisZ
+	status.Printer.Speed = printer.Telemetry.PrintSpeed
+	return status
+}
+
 // GetStorageV1 is used to get the printer's storage v1 API endpoint
-func GetStorageV1(printer config.Printers) (StorageV1, error) {
+func GetStorageV1(ctx context.Context, printer config.Printers) (StorageV1, error) {
 	var storage StorageV1
-	response, err := accessPrinterEndpoint("/api/v1/storage", printer)
+	response, _, err := accessPrinterEndpoint(ctx, "/api/v1/storage", printer)
 
 	if err != nil {
 		return storage, err
 	}
 
-	err = json.Unmarshal(response, &storage)
+	err = decodeResponse(response, &storage, "/api/v1/storage", printer)
 
 	return storage, err
 }
 
 // GetInfo is used to get the printer's info API endpoint
-func GetInfo(printer config.Printers) (Info, error) {
+func GetInfo(ctx context.Context, printer config.Printers) (Info, error) {
 	var info Info
-	response, err := accessPrinterEndpoint("/api/v1/info", printer)
+	response, _, err := accessPrinterEndpoint(ctx, "/api/v1/info", printer)
 
 	if err != nil {
 		return info, err
 	}
 
-	err = json.Unmarshal(response, &info)
+	err = decodeResponse(response, &info, "/api/v1/info", printer)
 
 	return info, err
 }
 
+// GetStats is used to get the printer's lifetime statistics API endpoint
+func GetStats(ctx context.Context, printer config.Printers) (Stats, error) {
+	var stats Stats
+	response, _, err := accessPrinterEndpoint(ctx, "/api/v1/stats", printer)
+
+	if err != nil {
+		return stats, err
+	}
+
+	err = decodeResponse(response, &stats, "/api/v1/stats", printer)
+
+	return stats, err
+}
+
+// GetQueue is used to get the printer's print queue API endpoint
+func GetQueue(ctx context.Context, printer config.Printers) (Queue, error) {
+	var queue Queue
+	response, _, err := accessPrinterEndpoint(ctx, "/api/v1/queue", printer)
+
+	if err != nil {
+		return queue, err
+	}
+
+	err = decodeResponse(response, &queue, "/api/v1/queue", printer)
+
+	return queue, err
+}
+
+// GetMesh is used to get the printer's bed mesh API endpoint
+func GetMesh(ctx context.Context, printer config.Printers) (Mesh, error) {
+	var mesh Mesh
+	response, _, err := accessPrinterEndpoint(ctx, "/api/v1/mesh", printer)
+
+	if err != nil {
+		return mesh, err
+	}
+
+	err = decodeResponse(response, &mesh, "/api/v1/mesh", printer)
+
+	return mesh, err
+}
+
+// meshRange returns difference of the highest and the lowest probed point of the mesh in millimeters,
+// false if the mesh has no points e.g. before the first calibration
+func meshRange(mesh Mesh) (float64, bool) {
+	lowest, highest := math.Inf(1), math.Inf(-1)
+	for _, row := range mesh.Points {
+		for _, z := range row {
+			lowest = math.Min(lowest, z)
+			highest = math.Max(highest, z)
+		}
+	}
+	if math.IsInf(lowest, 1) {
+		return 0, false
+	}
+	return highest - lowest, true
+}
+
 // GetSettings is used to get the printer's settings API endpoint
-func GetSettings(printer config.Printers) (Settings, error) {
+func GetSettings(ctx context.Context, printer config.Printers) (Settings, error) {
 	var settings Settings
-	response, err := accessPrinterEndpoint("/api/settings", printer)
+	response, _, err := accessPrinterEndpoint(ctx, "/api/settings", printer)
 
 	if err != nil {
 		return settings, err
 	}
 
-	err = json.Unmarshal(response, &settings)
+	err = decodeResponse(response, &settings, "/api/settings", printer)
 
 	return settings, err
 }
 
 // GetCameras is used to get the printer's cameras API endpoint
-func GetCameras(printer config.Printers) (Cameras, error) {
+func GetCameras(ctx context.Context, printer config.Printers) (Cameras, error) {
 	var cameras Cameras
-	response, err := accessPrinterEndpoint("/api/v1/cameras", printer)
+	response, _, err := accessPrinterEndpoint(ctx, "/api/v1/cameras", printer)
 
 	if err != nil {
 		return cameras, err
 	}
 
-	err = json.Unmarshal(response, &cameras)
+	err = decodeResponse(response, &cameras, "/api/v1/cameras", printer)
 
 	return cameras, err
 }
 
 // GetPrinterProfiles is used to get the printer's printerprofiles API endpoint
-func GetPrinterProfiles(printer config.Printers) (PrinterProfiles, error) {
+func GetPrinterProfiles(ctx context.Context, printer config.Printers) (PrinterProfiles, error) {
 	var profiles PrinterProfiles
-	response, err := accessPrinterEndpoint("/api/v1/printerprofiles", printer)
+	response, _, err := accessPrinterEndpoint(ctx, "/api/v1/printerprofiles", printer)
 
 	if err != nil {
 		return profiles, err
 	}
 
-	err = json.Unmarshal(response, &profiles)
+	err = decodeResponse(response, &profiles, "/api/v1/printerprofiles", printer)
 
 	return profiles, err
 }
 
+// jobImageTimeout returns timeout of fetching the job image, images can be large so they have their own timeout.
+// It is never shorter than the timeout of other requests to the printer, so per-printer override applies as well.
+func jobImageTimeout(printer config.Printers) time.Duration {
+	cfg := GetConfiguration()
+	timeout := printerTimeout(printer, 5*time.Duration(cfg.Exporter.ScrapeTimeout)*time.Second)
+	return max(time.Duration(cfg.Exporter.ImageTimeout)*time.Second, timeout)
+}
+
 // GetJobImage is used to get the printer's job image from API
-func GetJobImage(printer config.Printers, imagePath string) (string, error) { // returns base64 encoded image
+func GetJobImage(ctx context.Context, printer config.Printers, imagePath string, size string) (string, error) { // returns base64 encoded image
 	//http://192.168.20.50/thumb/l/usb/PYTHON~1.BGC
-	response, err := accessPrinterEndpoint("/thumb/l"+imagePath, printer)
+	thumbnail := "/thumb/s"
+	if size != ImageSizeSmall {
+		thumbnail = "/thumb/l"
+	}
+
+	timeout := jobImageTimeout(printer)
+	response, _, err := accessPrinterEndpointTimeout(ctx, thumbnail+imagePath, printer, timeout)
+	if isNotFound(err) && thumbnail == "/thumb/l" {
+		log.Debug().Msg("Large job image not available from " + printer.Address + ", falling back to small")
+		response, _, err = accessPrinterEndpointTimeout(ctx, "/thumb/s"+imagePath, printer, timeout)
+	}
 	if err != nil {
 		return "", err
 	}
@@ -365,8 +863,8 @@ func compressPNG(input []byte, compressionLevel png.CompressionLevel) ([]byte, e
 }
 
 // GetPrinterType returns the printer type of the given printer - e.g. "MINI", "MK4", "XL", "I3MK3S", "I3MK3", "I3MK25S",
-func GetPrinterType(printer config.Printers) (string, error) {
-	version, err := GetVersion(printer)
+func GetPrinterType(ctx context.Context, printer config.Printers) (string, error) {
+	version, err := GetVersion(ctx, printer)
 	if err != nil {
 		return "unknown", err
 	}
@@ -375,7 +873,7 @@ func GetPrinterType(printer config.Printers) (string, error) {
 
 	if version.Hostname == "" {
 		if version.Original == "" {
-			info, err := GetInfo(printer)
+			info, err := GetInfo(ctx, printer)
 			if err != nil {
 				return "unknown", err
 			}
@@ -403,8 +901,9 @@ func GetPrinterType(printer config.Printers) (string, error) {
 // ProbePrinter is used to probe the printer - just testing the connection
 func ProbePrinter(printer config.Printers) (bool, error) {
 	cfg := GetConfiguration()
-	req, _ := http.NewRequest("GET", "http://"+printer.Address+"/", nil)
-	client := &http.Client{Timeout: time.Duration(cfg.Exporter.ScrapeTimeout) * time.Millisecond}
+	req, _ := http.NewRequest("GET", printerURL(printer.Address, "/"), nil)
+	setUserAgent(req)
+	client := &http.Client{Transport: printerTransport, Timeout: time.Duration(cfg.Exporter.ScrapeTimeout) * time.Millisecond}
 	r, e := client.Do(req)
 
 	if e != nil {
@@ -413,8 +912,9 @@ func ProbePrinter(printer config.Printers) (bool, error) {
 
 	if r.StatusCode == 401 {
 		log.Debug().Msg("401 Unauthorized, trying to access with API key - " + printer.Address)
-		req, _ := http.NewRequest("GET", "http://"+printer.Address+"/api/v1/status", nil)
+		req, _ := http.NewRequest("GET", printerURL(printer.Address, "/api/v1/status"), nil)
 		req.Header.Add("X-Api-Key", printer.Apikey)
+		setUserAgent(req)
 		r, e = client.Do(req)
 		if e != nil {
 			return false, e
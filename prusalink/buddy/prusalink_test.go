@@ -1,10 +1,14 @@
 package prusalink
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -185,6 +189,17 @@ func TestGetStateFlag(t *testing.T) {
 			},
 			expected: 0,
 		},
+		{name: "Paused", printer: printerState(`{"flags":{"operational":true,"paused":true}}`), expected: 3},
+		{name: "Cancelling", printer: printerState(`{"flags":{"operational":true,"printing":true,"cancelling":true}}`), expected: 5},
+		{name: "Pausing", printer: printerState(`{"flags":{"operational":true,"printing":true,"pausing":true}}`), expected: 6},
+		{name: "Error", printer: printerState(`{"flags":{"operational":true,"error":true}}`), expected: 7},
+		{name: "Closed on error", printer: printerState(`{"flags":{"closedOnError":true}}`), expected: 9},
+		{name: "Ready", printer: printerState(`{"flags":{"ready":true}}`), expected: 10},
+		{name: "Busy", printer: printerState(`{"text":"Busy","flags":{"operational":true,"busy":true}}`), expected: 11},
+		{name: "Finished", printer: printerState(`{"text":"Finished","flags":{"operational":true,"ready":true,"finished":true}}`), expected: 12},
+		{name: "Attention link state", printer: printerState(`{"text":"Busy","flags":{"link_state":"ATTENTION","operational":true,"busy":true}}`), expected: 13},
+		{name: "Attention text", printer: printerState(`{"text":"Attention","flags":{"operational":true}}`), expected: 13},
+		{name: "Printing while operational", printer: printerState(`{"text":"Printing","flags":{"operational":true,"printing":true}}`), expected: 4},
 	}
 
 	for _, tt := range tests {
@@ -197,6 +212,124 @@ func TestGetStateFlag(t *testing.T) {
 	}
 }
 
+// printerState returns printer with the state decoded from JSON
+func printerState(state string) Printer {
+	var printer Printer
+	if err := json.Unmarshal([]byte(`{"state":`+state+`}`), &printer); err != nil {
+		panic(err)
+	}
+	return printer
+}
+
+func TestGetStateFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		flags    string
+		expected map[string]bool
+	}{
+		{
+			name:     "Printing",
+			flags:    `{"operational":true,"printing":true}`,
+			expected: map[string]bool{"operational": true, "printing": true, "paused": false, "error": false},
+		},
+		{
+			name:     "Paused",
+			flags:    `{"operational":true,"paused":true}`,
+			expected: map[string]bool{"operational": true, "printing": false, "paused": true, "error": false},
+		},
+		{
+			name:     "Error",
+			flags:    `{"error":true,"closedOrError":true}`,
+			expected: map[string]bool{"operational": false, "error": true, "closed_or_error": true, "finished": false},
+		},
+		{
+			name:     "Finished and busy",
+			flags:    `{"finished":true,"busy":true}`,
+			expected: map[string]bool{"finished": true, "busy": true, "ready": false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var printer Printer
+			if err := json.Unmarshal([]byte(`{"state":{"flags":`+tt.flags+`}}`), &printer); err != nil {
+				t.Fatalf("json.Unmarshal() error: %v", err)
+			}
+
+			flags := map[string]bool{}
+			for _, flag := range getStateFlags(printer) {
+				flags[flag.name] = flag.value
+			}
+
+			if len(flags) != 13 {
+				t.Errorf("getStateFlags() returned %d flags, expected 13", len(flags))
+			}
+			for name, value := range tt.expected {
+				if flags[name] != value {
+					t.Errorf("getStateFlags() flag %s = %t, expected %t", name, flags[name], value)
+				}
+			}
+		})
+	}
+}
+
+func TestUserInteractionRequired(t *testing.T) {
+	tests := []struct {
+		name     string
+		printer  string
+		status   string
+		expected bool
+	}{
+		{"Filament change", `{"state":{"text":"M600 - change filament","flags":{"paused":true}}}`, `{"printer":{"state":"PAUSED"}}`, true},
+		{"Waiting for user", `{"state":{"text":"Waiting for user","flags":{"paused":true}}}`, `{}`, true},
+		{"Attention state", `{"state":{"text":"Busy","flags":{"busy":true}}}`, `{"printer":{"state":"ATTENTION"}}`, true},
+		{"Paused by user", `{"state":{"text":"Paused","flags":{"paused":true}}}`, `{"printer":{"state":"PAUSED"}}`, false},
+		{"Printing", `{"state":{"text":"Printing","flags":{"printing":true}}}`, `{"printer":{"state":"PRINTING"}}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var printer Printer
+			if err := json.Unmarshal([]byte(tt.printer), &printer); err != nil {
+				t.Fatalf("json.Unmarshal() error: %v", err)
+			}
+			var status Status
+			if err := json.Unmarshal([]byte(tt.status), &status); err != nil {
+				t.Fatalf("json.Unmarshal() error: %v", err)
+			}
+
+			if result := userInteractionRequired(printer, status); result != tt.expected {
+				t.Errorf("userInteractionRequired() = %t, expected %t", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetNozzleDiameters(t *testing.T) {
+	tests := []struct {
+		name     string
+		info     string
+		expected []float64
+	}{
+		{"Single tool", `{"nozzle_diameter":0.4}`, []float64{0.4}},
+		{"Multi tool", `{"nozzle_diameter":0.4,"tools":[{"nozzle_diameter":0.4},{"nozzle_diameter":0.6}]}`, []float64{0.4, 0.6}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var info Info
+			if err := json.Unmarshal([]byte(tt.info), &info); err != nil {
+				t.Fatalf("json.Unmarshal() error: %v", err)
+			}
+
+			diameters := getNozzleDiameters(info)
+			if !slices.Equal(diameters, tt.expected) {
+				t.Errorf("getNozzleDiameters() = %v, expected %v", diameters, tt.expected)
+			}
+		})
+	}
+}
+
 func TestAccessPrinterEndpoint(t *testing.T) {
 	// Create a test server
 	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -248,14 +381,7 @@ func TestAccessPrinterEndpoint(t *testing.T) {
 	defer func() { configuration = originalConfig }()
 
 	configuration = config.Config{
-		Exporter: struct {
-			ScrapeTimeout int    `yaml:"scrape_timeout"`
-			LogLevel      string `yaml:"log_level"`
-			IPOverride    string
-			AllMetricsUDP bool
-			ExtraMetrics  []string
-			LokiPushURL   string
-		}{
+		Exporter: config.Exporter{
 			ScrapeTimeout: 5,
 		},
 	}
@@ -325,7 +451,7 @@ func TestAccessPrinterEndpoint(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := accessPrinterEndpoint(tt.path, tt.printer)
+			result, _, err := accessPrinterEndpoint(context.Background(), tt.path, tt.printer)
 
 			if tt.expectError {
 				if err == nil {
@@ -349,6 +475,205 @@ func TestAccessPrinterEndpoint(t *testing.T) {
 	configuration = originalConfig
 }
 
+func TestAccessPrinterEndpointContextCancel(t *testing.T) {
+	release := make(chan struct{})
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer testServer.Close()
+	defer close(release)
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+	SetConfiguration(config.Config{Exporter: config.Exporter{ScrapeTimeout: 5}})
+
+	printer := config.Printers{Address: strings.TrimPrefix(testServer.URL, "http://"), Apikey: "test_api_key"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, statusCode, err := accessPrinterEndpoint(ctx, "/api/v1/status", printer)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("accessPrinterEndpoint() error = %v, expected context.Canceled", err)
+	}
+	if statusCode != -1 {
+		t.Errorf("accessPrinterEndpoint() status code = %d, expected -1", statusCode)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("accessPrinterEndpoint() returned after %s, expected to be aborted by cancelled context", elapsed)
+	}
+}
+
+func TestAccessPrinterEndpointDigestReuse(t *testing.T) {
+	var requests, challenges atomic.Int32
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Digest ") {
+			challenges.Add(1)
+			w.Header().Set("WWW-Authenticate", `Digest realm="Test", qop="auth", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque="5ccc069c403ebaf9f0171e9517f40e41"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"printer":{"state":"IDLE"}}`))
+	}))
+	defer testServer.Close()
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+	SetConfiguration(config.Config{Exporter: config.Exporter{ScrapeTimeout: 5}})
+
+	printer := config.Printers{
+		Address:  strings.TrimPrefix(testServer.URL, "http://"),
+		Username: "maker",
+		Password: "secret",
+	}
+
+	if _, _, err := accessPrinterEndpoint(context.Background(), "/api/v1/status", printer); err != nil {
+		t.Fatalf("first accessPrinterEndpoint() error: %v", err)
+	}
+	if requests.Load() != 2 || challenges.Load() != 1 {
+		t.Fatalf("first request made %d requests with %d challenges, expected 2 and 1", requests.Load(), challenges.Load())
+	}
+
+	requests.Store(0)
+	if _, _, err := accessPrinterEndpoint(context.Background(), "/api/v1/status", printer); err != nil {
+		t.Fatalf("second accessPrinterEndpoint() error: %v", err)
+	}
+	if requests.Load() != 1 || challenges.Load() != 1 {
+		t.Errorf("second request made %d requests, %d challenges in total, expected cached challenge to be reused", requests.Load(), challenges.Load())
+	}
+}
+
+func TestAccessPrinterEndpointBasicAuth(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "maker" || password != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="PrusaLink"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"printer":{"state":"IDLE"}}`))
+	}))
+	defer testServer.Close()
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+	SetConfiguration(config.Config{Exporter: config.Exporter{ScrapeTimeout: 5}})
+
+	address := strings.TrimPrefix(testServer.URL, "http://")
+	tests := []struct {
+		name     string
+		printer  config.Printers
+		expected int
+	}{
+		{"Basic", config.Printers{Address: address, AuthType: config.AuthBasic, Username: "maker", Password: "secret"}, http.StatusOK},
+		{"BasicWrongPassword", config.Printers{Address: address, AuthType: config.AuthBasic, Username: "maker", Password: "wrong"}, http.StatusUnauthorized},
+		{"Digest", config.Printers{Address: address, AuthType: config.AuthDigest, Username: "maker", Password: "secret"}, http.StatusUnauthorized},
+		{"APIKeyWithCredentials", config.Printers{Address: address, AuthType: config.AuthAPIKey, Apikey: "key", Username: "maker", Password: "secret"}, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, statusCode, _ := accessPrinterEndpoint(context.Background(), "/api/v1/status", tt.printer)
+			if statusCode != tt.expected {
+				t.Errorf("accessPrinterEndpoint() status = %d, expected %d", statusCode, tt.expected)
+			}
+		})
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	userAgents := make(chan string, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents <- r.Method + " " + r.UserAgent()
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	printer := config.Printers{Address: strings.TrimPrefix(server.URL, "http://"), Apikey: "test_api_key"}
+	cfg := config.Config{Exporter: config.Exporter{ScrapeTimeout: 5}}
+	SetConfiguration(cfg)
+
+	if _, _, err := accessPrinterEndpoint(context.Background(), "/api/version", printer); err != nil {
+		t.Fatalf("accessPrinterEndpoint() error: %v", err)
+	}
+	if userAgent := <-userAgents; userAgent != "GET "+DefaultUserAgent {
+		t.Errorf("User-Agent = %q, expected %q", userAgent, "GET "+DefaultUserAgent)
+	}
+
+	cfg.Exporter.UserAgent = "farm-monitor/1.0"
+	SetConfiguration(cfg)
+
+	if _, _, err := accessPrinterEndpoint(context.Background(), "/api/version", printer); err != nil {
+		t.Fatalf("accessPrinterEndpoint() error: %v", err)
+	}
+	if _, err := deleteGcode("enable_udp_metrics.gcode", printer); err != nil {
+		t.Fatalf("deleteGcode() error: %v", err)
+	}
+	for _, expected := range []string{"GET farm-monitor/1.0", "DELETE farm-monitor/1.0"} {
+		if userAgent := <-userAgents; userAgent != expected {
+			t.Errorf("User-Agent = %q, expected %q", userAgent, expected)
+		}
+	}
+}
+
+func TestResponseBytes(t *testing.T) {
+	responses := map[string]string{
+		"/api/version": `{"api":"2.0.0"}`,
+		"/api/job":     `{"state":"Operational"}`,
+	}
+	server := newMockPrinter(t, responses)
+	printer := config.Printers{Address: printerAddress(server), Apikey: "test_api_key"}
+
+	expected := 0
+	for path, body := range responses {
+		if _, _, err := accessPrinterEndpoint(context.Background(), path, printer); err != nil {
+			t.Fatalf("accessPrinterEndpoint(%s) error: %v", path, err)
+		}
+		expected += len(body)
+	}
+	if _, _, err := accessPrinterEndpoint(context.Background(), "/api/version", printer); err != nil {
+		t.Fatalf("accessPrinterEndpoint() error: %v", err)
+	}
+	expected += len(responses["/api/version"])
+
+	if result := getResponseBytes(printer.Address); result != float64(expected) {
+		t.Errorf("getResponseBytes() = %v, expected %d", result, expected)
+	}
+	if result := getResponseBytes("192.0.2.1"); result != 0 {
+		t.Errorf("getResponseBytes() for unknown printer = %v, expected 0", result)
+	}
+}
+
+func TestGetJobDecodeError(t *testing.T) {
+	portal := `<!DOCTYPE html><html><head><title>Network login</title></head><body>Please sign in to access the network. Please sign in to access the network. Please sign in to access the network. Please sign in to access the network. Please sign in to access the network. </body></html>`
+	server := newMockPrinter(t, map[string]string{"/api/job": portal})
+	printer := config.Printers{Address: printerAddress(server), Apikey: "test_api_key"}
+
+	_, err := GetJob(context.Background(), printer)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("GetJob() error = %v, expected DecodeError", err)
+	}
+	if decodeErr.Body != portal[:decodeErrorBodyLength] {
+		t.Errorf("DecodeError body = %q, expected first %d bytes of the response", decodeErr.Body, decodeErrorBodyLength)
+	}
+	for _, part := range []string{printer.Address, "/api/job", "invalid character '<'", "<!DOCTYPE html>"} {
+		if !strings.Contains(err.Error(), part) {
+			t.Errorf("GetJob() error %q does not contain %q", err.Error(), part)
+		}
+	}
+}
+
 func TestPrinterTypes(t *testing.T) {
 	expectedTypes := map[string]string{
 		"PrusaMINI":         "MINI",
@@ -384,14 +709,7 @@ func TestHTTPTimeouts(t *testing.T) {
 	defer func() { configuration = originalConfig }()
 
 	configuration = config.Config{
-		Exporter: struct {
-			ScrapeTimeout int    `yaml:"scrape_timeout"`
-			LogLevel      string `yaml:"log_level"`
-			IPOverride    string
-			AllMetricsUDP bool
-			ExtraMetrics  []string
-			LokiPushURL   string
-		}{
+		Exporter: config.Exporter{
 			ScrapeTimeout: 1, // 1 second timeout
 		},
 	}
@@ -404,11 +722,14 @@ func TestHTTPTimeouts(t *testing.T) {
 		Password: "test_pass",
 	}
 
-	_, err := accessPrinterEndpoint("/api/v1/status", printer)
+	_, statusCode, err := accessPrinterEndpoint(context.Background(), "/api/v1/status", printer)
 	if err == nil {
 		t.Error("accessPrinterEndpoint() should timeout but didn't")
 		return
 	}
+	if statusCode != -1 {
+		t.Errorf("accessPrinterEndpoint() status code = %d, expected -1", statusCode)
+	}
 
 	// Check that error is timeout-related
 	errMsg := err.Error()
@@ -420,6 +741,41 @@ func TestHTTPTimeouts(t *testing.T) {
 	configuration = originalConfig
 }
 
+func TestPrinterTimeoutOverride(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(1500 * time.Millisecond)
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer testServer.Close()
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+	SetConfiguration(testConfig()) // 5 * 1 second timeout for printers without override
+
+	serverHost := strings.TrimPrefix(testServer.URL, "http://")
+
+	tests := []struct {
+		name        string
+		timeout     int
+		expectError bool
+	}{
+		{"Global timeout", 0, false},
+		{"Shorter printer timeout", 1, true},
+		{"Longer printer timeout", 30, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			printer := config.Printers{Address: serverHost, Apikey: "test_api_key", Timeout: tt.timeout}
+
+			_, _, err := accessPrinterEndpoint(context.Background(), "/api/v1/status", printer)
+			if (err != nil) != tt.expectError {
+				t.Errorf("accessPrinterEndpoint() error = %v, expected error %t", err, tt.expectError)
+			}
+		})
+	}
+}
+
 func TestJSONStructures(t *testing.T) {
 	// Test that our JSON structures can be marshaled and unmarshaled correctly
 
@@ -0,0 +1,141 @@
+package prusalink
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const defaultDNSRefreshInterval = 5 * time.Minute
+
+// hostResolver is used to resolve printer hostnames, net.Resolver satisfies it
+type hostResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+type resolvedHost struct {
+	ip      string
+	expires time.Time
+}
+
+var (
+	resolver      hostResolver = net.DefaultResolver
+	resolvedHosts              = map[string]resolvedHost{}
+	resolverMutex sync.Mutex
+
+	dialer = &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+
+	// printerTransport is shared by all printer requests, hostnames are dialed using periodically re-resolved IP
+	printerTransport = &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         dialPrinter,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+)
+
+// dnsRefreshInterval returns how long resolved printer hostnames are cached
+func dnsRefreshInterval() time.Duration {
+	cfg := GetConfiguration()
+	if cfg.Exporter.DNSRefreshInterval <= 0 {
+		return defaultDNSRefreshInterval
+	}
+	return time.Duration(cfg.Exporter.DNSRefreshInterval) * time.Second
+}
+
+// resolveHost returns IP address of the host and whether it changed since the last resolution.
+// Resolved hostnames are cached for dnsRefreshInterval.
+func resolveHost(ctx context.Context, host string) (string, bool, error) {
+	if _, err := netip.ParseAddr(host); err == nil { // IP address, possibly with IPv6 zone
+		return host, false, nil
+	}
+
+	resolverMutex.Lock()
+	cached, ok := resolvedHosts[host]
+	resolverMutex.Unlock()
+
+	if ok && time.Now().Before(cached.expires) {
+		return cached.ip, false, nil
+	}
+
+	addresses, err := resolver.LookupHost(ctx, host)
+	if err == nil && len(addresses) == 0 {
+		err = fmt.Errorf("no addresses found for %s", host)
+	}
+	if err != nil {
+		if ok {
+			log.Warn().Msgf("Failed to re-resolve %s, using previous address %s - %s", host, cached.ip, err.Error())
+			return cached.ip, false, nil
+		}
+		return "", false, err
+	}
+
+	ip := addresses[0]
+	resolverMutex.Lock()
+	resolvedHosts[host] = resolvedHost{ip: ip, expires: time.Now().Add(dnsRefreshInterval())}
+	resolverMutex.Unlock()
+
+	changed := ok && cached.ip != ip
+	if changed {
+		log.Info().Msgf("Printer hostname %s now resolves to %s (was %s)", host, ip, cached.ip)
+	} else {
+		log.Debug().Msgf("Printer hostname %s resolved to %s", host, ip)
+	}
+
+	return ip, changed, nil
+}
+
+// printerHost returns host of the printer address without port and IPv6 brackets
+func printerHost(address string) string {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+}
+
+// printerURL returns URL of the printer endpoint, bare IPv6 addresses are wrapped in brackets
+func printerURL(address, path string) string {
+	if ip, err := netip.ParseAddr(address); err == nil && ip.Is6() {
+		address = "[" + strings.ReplaceAll(address, "%", "%25") + "]" // zone separator must be escaped in URL
+	}
+	return "http://" + address + path
+}
+
+// refreshPrinterAddress re-resolves the printer hostname when the cached address expired. When the
+// IP changed, idle connections are closed so the new address is used right away.
+func refreshPrinterAddress(address string) {
+	host := printerHost(address)
+
+	_, changed, err := resolveHost(context.Background(), host)
+	if err != nil {
+		log.Debug().Msgf("Failed to resolve %s - %s", host, err.Error())
+		return
+	}
+
+	if changed {
+		printerTransport.CloseIdleConnections()
+	}
+}
+
+// dialPrinter dials the printer using the cached IP address of its hostname
+func dialPrinter(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	ip, _, err := resolveHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	return dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+}
@@ -0,0 +1,96 @@
+package prusalink
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type mockResolver struct {
+	addresses []string
+	calls     int
+}
+
+func (m *mockResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	m.calls++
+	return []string{m.addresses[0]}, nil
+}
+
+func TestResolveHost(t *testing.T) {
+	originalResolver := resolver
+	defer func() { resolver = originalResolver }()
+
+	mock := &mockResolver{addresses: []string{"192.168.1.10"}}
+	resolver = mock
+
+	ip, changed, err := resolveHost(context.Background(), "printer.local")
+	if err != nil {
+		t.Fatalf("resolveHost() error: %v", err)
+	}
+	if ip != "192.168.1.10" || changed {
+		t.Errorf("resolveHost() = %s, %t, expected 192.168.1.10, false", ip, changed)
+	}
+
+	// cached address is used until it expires
+	mock.addresses[0] = "192.168.1.20"
+	ip, _, _ = resolveHost(context.Background(), "printer.local")
+	if ip != "192.168.1.10" || mock.calls != 1 {
+		t.Errorf("resolveHost() = %s after %d lookups, expected cached 192.168.1.10 after 1 lookup", ip, mock.calls)
+	}
+
+	// expire the cached entry to simulate elapsed refresh interval
+	resolverMutex.Lock()
+	entry := resolvedHosts["printer.local"]
+	entry.expires = time.Now().Add(-time.Second)
+	resolvedHosts["printer.local"] = entry
+	resolverMutex.Unlock()
+
+	ip, changed, err = resolveHost(context.Background(), "printer.local")
+	if err != nil {
+		t.Fatalf("resolveHost() error: %v", err)
+	}
+	if ip != "192.168.1.20" || !changed {
+		t.Errorf("resolveHost() = %s, %t, expected 192.168.1.20, true", ip, changed)
+	}
+
+	// IP addresses are never resolved
+	ip, _, _ = resolveHost(context.Background(), "10.0.0.1")
+	if ip != "10.0.0.1" || mock.calls != 2 {
+		t.Errorf("resolveHost() = %s after %d lookups, expected 10.0.0.1 without lookup", ip, mock.calls)
+	}
+}
+
+func TestPrinterURL(t *testing.T) {
+	tests := []struct {
+		address  string
+		expected string
+		host     string
+	}{
+		{"192.168.1.10", "http://192.168.1.10/api/v1/status", "192.168.1.10"},
+		{"192.168.1.10:8080", "http://192.168.1.10:8080/api/v1/status", "192.168.1.10"},
+		{"printer.local", "http://printer.local/api/v1/status", "printer.local"},
+		{"fe80::1", "http://[fe80::1]/api/v1/status", "fe80::1"},
+		{"fe80::1%eth0", "http://[fe80::1%25eth0]/api/v1/status", "fe80::1%eth0"},
+		{"[fe80::1]", "http://[fe80::1]/api/v1/status", "fe80::1"},
+		{"[fe80::1]:8080", "http://[fe80::1]:8080/api/v1/status", "fe80::1"},
+	}
+
+	for _, tt := range tests {
+		result := printerURL(tt.address, "/api/v1/status")
+		if result != tt.expected {
+			t.Errorf("printerURL(%q) = %q, expected %q", tt.address, result, tt.expected)
+		}
+		parsed, err := url.Parse(result)
+		if err != nil {
+			t.Errorf("printerURL(%q) = %q is not valid URL: %v", tt.address, result, err)
+			continue
+		}
+		if parsed.Hostname() != tt.host {
+			t.Errorf("host of printerURL(%q) = %q, expected %q", tt.address, parsed.Hostname(), tt.host)
+		}
+		if host := printerHost(tt.address); host != tt.host {
+			t.Errorf("printerHost(%q) = %q, expected %q", tt.address, host, tt.host)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package prusalink
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+// printerSummary is the result of the last scrape of a printer returned by StatusHandler
+type printerSummary struct {
+	Address  string  `json:"address"`
+	Name     string  `json:"name"`
+	Up       bool    `json:"up"`
+	State    string  `json:"state"`
+	Job      string  `json:"job"`
+	Progress float64 `json:"progress"` // ratio from 0 to 1
+}
+
+// updateSummary remembers result of the last scrape of the printer
+func (c *Collector) updateSummary(summary printerSummary) {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+	c.summaries[summary.Address] = summary
+}
+
+// StatusHandler returns handler of GET /status.json listing result of the most recent scrape of every
+// configured printer as JSON. Printers not scraped yet are reported as down.
+func (c *Collector) StatusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		c.stateMutex.Lock()
+		summaries := make([]printerSummary, 0, len(c.configuration.Printers))
+		for _, s := range c.configuration.Printers {
+			summary, ok := c.summaries[s.Address]
+			if !ok {
+				summary = printerSummary{Address: s.Address, Name: s.Name}
+			}
+			summaries = append(summaries, summary)
+		}
+		c.stateMutex.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(summaries); err != nil {
+			log.Error().Msg("Error encoding printer status - " + err.Error())
+		}
+	}
+}
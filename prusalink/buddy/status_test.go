@@ -0,0 +1,69 @@
+package prusalink
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pstrobl96/prusa_exporter/config"
+)
+
+func TestStatusHandler(t *testing.T) {
+	responses := defaultPrinterResponses()
+	responses["/api/job"] = `{"state":"Printing","job":{"file":{"name":"benchy.gcode","path":"/usb/benchy.gcode"}},"progress":{"completion":0.42}}`
+	responses["/api/printer"] = `{"state":{"text":"Printing","flags":{"printing":true}}}`
+	server := newMockPrinter(t, responses)
+
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	collector := NewCollector(testConfig(
+		config.Printers{Address: printerAddress(server), Apikey: "test_api_key", Name: "Printing", Type: "MK4"},
+		config.Printers{Address: "127.0.0.1:1", Name: "Unscraped", Type: "MK4"},
+	))
+
+	get := func() []printerSummary {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		collector.StatusHandler()(rr, httptest.NewRequest(http.MethodGet, "/status.json", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET /status.json returned %d, expected %d", rr.Code, http.StatusOK)
+		}
+		if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+			t.Errorf("Content-Type = %q, expected application/json", contentType)
+		}
+		var summaries []printerSummary
+		if err := json.Unmarshal(rr.Body.Bytes(), &summaries); err != nil {
+			t.Fatalf("json.Unmarshal() error: %v", err)
+		}
+		return summaries
+	}
+
+	expected := []printerSummary{
+		{Address: printerAddress(server), Name: "Printing"},
+		{Address: "127.0.0.1:1", Name: "Unscraped"},
+	}
+	if summaries := get(); len(summaries) != len(expected) || summaries[0] != expected[0] || summaries[1] != expected[1] {
+		t.Errorf("status before scrape = %+v, expected %+v", summaries, expected)
+	}
+
+	gatherMetrics(t, collector)
+
+	expected[0] = printerSummary{Address: printerAddress(server), Name: "Printing", Up: true, State: "Printing", Job: "benchy.gcode", Progress: 0.42}
+	summaries := get()
+	if len(summaries) != len(expected) {
+		t.Fatalf("GET /status.json returned %d printers, expected %d", len(summaries), len(expected))
+	}
+	for i, summary := range summaries {
+		if summary != expected[i] {
+			t.Errorf("status of %s = %+v, expected %+v", expected[i].Name, summary, expected[i])
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	collector.StatusHandler()(rr, httptest.NewRequest(http.MethodPost, "/status.json", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /status.json returned %d, expected %d", rr.Code, http.StatusMethodNotAllowed)
+	}
+}
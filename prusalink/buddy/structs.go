@@ -111,32 +111,27 @@ type Printer struct {
 
 // Files is a struct that contains data about the files on the printer
 type Files struct {
-	Files []struct {
-		Name     string `json:"name"`
-		Path     string `json:"path"`
-		Display  string `json:"display"`
-		Type     string `json:"type"`
-		Origin   string `json:"origin"`
-		Children []struct {
-			Name    string `json:"name"`
-			Display string `json:"display"`
-			Path    string `json:"path"`
-			Origin  string `json:"origin"`
-			Refs    struct {
-				Resource       string `json:"resource"`
-				ThumbnailSmall string `json:"thumbnailSmall"`
-				ThumbnailBig   string `json:"thumbnailBig"`
-				Download       string `json:"download"`
-			} `json:"refs"`
-		} `json:"children"`
-		Date     float64  `json:"date"`
-		Size     float64  `json:"size"`
-		TypePath []string `json:"typePath"`
-		Refs     struct {
-			Resource any `json:"resource"`
-		} `json:"refs"`
-		ReadOnly bool `json:"read_only,omitempty"`
-	} `json:"files"`
+	Files []File `json:"files"`
+}
+
+// File is a file or folder on the printer, folders list their content in children when listed recursively
+type File struct {
+	Name     string   `json:"name"`
+	Path     string   `json:"path"`
+	Display  string   `json:"display"`
+	Type     string   `json:"type"`
+	Origin   string   `json:"origin"`
+	Children []File   `json:"children"`
+	Date     float64  `json:"date"`
+	Size     float64  `json:"size"`
+	TypePath []string `json:"typePath"`
+	Refs     struct {
+		Resource       any    `json:"resource"`
+		ThumbnailSmall string `json:"thumbnailSmall"`
+		ThumbnailBig   string `json:"thumbnailBig"`
+		Download       string `json:"download"`
+	} `json:"refs"`
+	ReadOnly bool `json:"read_only,omitempty"`
 }
 
 // JobV1 is a struct that contains data about the print job from path /api/v1/job
@@ -165,6 +160,8 @@ type JobV1 struct {
 			LayerHeight                     float64 `json:"layer_height"`
 			FilamentType                    string  `json:"filament_type"`
 			EstimatedPrintTime              float64 `json:"estimated_print_time"`
+			Temperature                     float64 `json:"temperature"`
+			BedTemperature                  float64 `json:"bed_temperature"`
 		} `json:"meta"`
 	} `json:"file"`
 }
@@ -190,6 +187,25 @@ type Status struct {
 		Speed        float64 `json:"speed"`
 		FanHotend    float64 `json:"fan_hotend"`
 		FanPrint     float64 `json:"fan_print"`
+		CurrentLayer float64 `json:"current_layer"`
+		TotalLayers  float64 `json:"total_layers"`
+		// commanded fan speeds in rpm, nil when not reported by the firmware
+		TargetFanHotend *float64 `json:"target_fan_hotend,omitempty"`
+		TargetFanPrint  *float64 `json:"target_fan_print,omitempty"`
+		// electronics temperatures, nil when not reported by the firmware
+		TempMCU   *float64 `json:"temp_mcu,omitempty"`
+		TempBoard *float64 `json:"temp_board,omitempty"`
+		// temperatures of segments of segmented heatbed (XL), empty for single bed heater
+		TempBedSegments []float64 `json:"temp_bed_segments,omitempty"`
+		// heater PWM in percent, nil when not reported by the firmware
+		HeaterNozzlePWM *float64 `json:"heater_nozzle_pwm,omitempty"`
+		HeaterBedPWM    *float64 `json:"heater_bed_pwm,omitempty"`
+		// motion settings, nil when not reported by the firmware
+		Acceleration *float64 `json:"acceleration,omitempty"` // mm/s^2
+		Jerk         *float64 `json:"jerk,omitempty"`         // mm/s
+		// sensor states, nil when the printer does not have the sensor
+		FilamentSensor *bool `json:"filament_sensor,omitempty"` // true when filament is detected
+		DoorSensor     *bool `json:"door_sensor,omitempty"`     // true when door is open
 	} `json:"printer"`
 }
 
@@ -220,6 +236,29 @@ type Info struct {
 	Serial            string  `json:"serial"`
 	Hostname          string  `json:"hostname"`
 	Port              float64 `json:"port"`
+	Tools             []struct {
+		NozzleDiameter float64 `json:"nozzle_diameter"`
+	} `json:"tools,omitempty"` // multi-tool printers like XL
+}
+
+// Stats is a struct that contains lifetime statistics of the printer
+type Stats struct {
+	TotalPrints    float64 `json:"total_prints"`
+	TotalPrintTime float64 `json:"total_print_time"` // seconds
+	FilamentUsed   float64 `json:"filament_used"`    // millimeters
+}
+
+// Queue is a struct that contains jobs waiting in the print queue
+type Queue struct {
+	Jobs []struct {
+		ID   float64 `json:"id"`
+		Path string  `json:"path"`
+	} `json:"jobs"`
+}
+
+// Mesh is a struct that contains bed mesh measured by the last mesh bed leveling
+type Mesh struct {
+	Points [][]float64 `json:"points"` // probed Z heights in millimeters, rows of the mesh
 }
 
 // PrinterProfiles is a struct that contains data about the printer profiles
@@ -0,0 +1,63 @@
+package prusalink
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// udpStatus is the UDP metrics status of a printer returned by UDPStatusHandler
+type udpStatus struct {
+	Address     string     `json:"address"`
+	Name        string     `json:"name"`
+	Enabled     bool       `json:"udp_enabled"`
+	Verified    bool       `json:"udp_verified"` // printer pushed UDP metrics to the exporter
+	ErrorReason string     `json:"error_reason"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastPush    *time.Time `json:"last_push,omitempty"`
+}
+
+// UDPStatusHandler returns handler of GET /udp-status listing UDP metrics status of every printer as JSON.
+// lastPush returns time of the last push from the printer IP address.
+func UDPStatusHandler(lastPush func(ip string) (time.Time, bool)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		printers := GetConfiguration().Printers
+		statuses := make([]udpStatus, 0, len(printers))
+		for _, s := range printers {
+			status := udpStatus{
+				Address:     s.Address,
+				Name:        s.Name,
+				Enabled:     s.UDPMetricsEnabled,
+				ErrorReason: s.UDPMetricsReason,
+			}
+			if status.ErrorReason == "" {
+				status.ErrorReason = UDPReasonNotSent
+			}
+
+			udpEnableMutex.Lock()
+			status.LastError = udpEnableErrors[s.Address]
+			udpEnableMutex.Unlock()
+
+			if ip, err := printerIP(s.Address); err == nil {
+				if last, ok := lastPush(ip); ok {
+					status.Verified = true
+					status.LastPush = &last
+				}
+			}
+
+			statuses = append(statuses, status)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(statuses); err != nil {
+			log.Error().Msg("Error encoding UDP status - " + err.Error())
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package prusalink
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pstrobl96/prusa_exporter/config"
+)
+
+func TestUDPStatusHandler(t *testing.T) {
+	originalConfig := GetConfiguration()
+	defer SetConfiguration(originalConfig)
+
+	SetConfiguration(testConfig(
+		config.Printers{Address: "192.168.1.100", Name: "Pushing", UDPMetricsEnabled: true, UDPMetricsReason: UDPReasonOK},
+		config.Printers{Address: "192.168.1.101:80", Name: "Silent", UDPMetricsEnabled: true, UDPMetricsReason: UDPReasonOK},
+		config.Printers{Address: "192.168.1.102", Name: "Offline", UDPMetricsReason: UDPReasonSendFailed},
+		config.Printers{Address: "192.168.1.103", Name: "Skipped"},
+	))
+	setUDPEnableError("192.168.1.102", errors.New("connection refused"))
+	defer setUDPEnableError("192.168.1.102", nil)
+
+	pushed := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	lastPush := func(ip string) (time.Time, bool) {
+		return pushed, ip == "192.168.1.100"
+	}
+
+	rr := httptest.NewRecorder()
+	UDPStatusHandler(lastPush)(rr, httptest.NewRequest(http.MethodGet, "/udp-status", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET /udp-status returned %d, expected %d", rr.Code, http.StatusOK)
+	}
+
+	var statuses []udpStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &statuses); err != nil {
+		t.Fatalf("json.Unmarshal() error: %v", err)
+	}
+
+	expected := []udpStatus{
+		{Address: "192.168.1.100", Name: "Pushing", Enabled: true, Verified: true, ErrorReason: UDPReasonOK, LastPush: &pushed},
+		{Address: "192.168.1.101:80", Name: "Silent", Enabled: true, ErrorReason: UDPReasonOK},
+		{Address: "192.168.1.102", Name: "Offline", ErrorReason: UDPReasonSendFailed, LastError: "connection refused"},
+		{Address: "192.168.1.103", Name: "Skipped", ErrorReason: UDPReasonNotSent},
+	}
+	if len(statuses) != len(expected) {
+		t.Fatalf("GET /udp-status returned %d printers, expected %d", len(statuses), len(expected))
+	}
+	for i, status := range statuses {
+		want := expected[i]
+		if status.LastPush != nil && want.LastPush != nil && status.LastPush.Equal(*want.LastPush) {
+			status.LastPush, want.LastPush = nil, nil
+		}
+		if status != want {
+			t.Errorf("status of %s = %+v, expected %+v", want.Name, status, want)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	UDPStatusHandler(lastPush)(rr, httptest.NewRequest(http.MethodPost, "/udp-status", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /udp-status returned %d, expected %d", rr.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,85 @@
+package prusalink
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultUtilizationWindow = 24 * time.Hour
+
+// stateSpan is a period when the printer was continuously printing or not printing
+type stateSpan struct {
+	start    time.Time
+	end      time.Time
+	printing bool
+}
+
+// utilizationTracker remembers printing periods of printers over a sliding window
+type utilizationTracker struct {
+	window time.Duration
+	spans  map[string][]stateSpan // keyed by printer address
+	mutex  sync.Mutex
+}
+
+func newUtilizationTracker(window time.Duration) *utilizationTracker {
+	if window <= 0 {
+		window = defaultUtilizationWindow
+	}
+	return &utilizationTracker{window: window, spans: map[string][]stateSpan{}}
+}
+
+// observe records the printer state at the given time. Time since the previous observation
+// is accounted to the previous state.
+func (u *utilizationTracker) observe(address string, now time.Time, printing bool) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	spans := u.spans[address]
+	if len(spans) > 0 {
+		last := &spans[len(spans)-1]
+		last.end = now
+		if last.printing == printing {
+			u.spans[address] = trimSpans(spans, now.Add(-u.window))
+			return
+		}
+	}
+
+	spans = append(spans, stateSpan{start: now, end: now, printing: printing})
+	u.spans[address] = trimSpans(spans, now.Add(-u.window))
+}
+
+// ratio returns time spent printing divided by observed time within the window ending at now
+func (u *utilizationTracker) ratio(address string, now time.Time) float64 {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	windowStart := now.Add(-u.window)
+	var printing, total time.Duration
+	for _, span := range u.spans[address] {
+		start := span.start
+		if start.Before(windowStart) {
+			start = windowStart
+		}
+		if !span.end.After(start) {
+			continue
+		}
+
+		total += span.end.Sub(start)
+		if span.printing {
+			printing += span.end.Sub(start)
+		}
+	}
+
+	if total == 0 {
+		return 0
+	}
+	return printing.Seconds() / total.Seconds()
+}
+
+// trimSpans drops spans that ended before the window start
+func trimSpans(spans []stateSpan, windowStart time.Time) []stateSpan {
+	for len(spans) > 1 && spans[0].end.Before(windowStart) {
+		spans = spans[1:]
+	}
+	return spans
+}
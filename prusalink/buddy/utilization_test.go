@@ -0,0 +1,41 @@
+package prusalink
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUtilizationRatio(t *testing.T) {
+	tracker := newUtilizationTracker(time.Hour)
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// idle 10 minutes, printing 30 minutes, idle 20 minutes
+	sequence := []struct {
+		offset   time.Duration
+		printing bool
+	}{
+		{0, false},
+		{5 * time.Minute, false},
+		{10 * time.Minute, true},
+		{25 * time.Minute, true},
+		{40 * time.Minute, false},
+		{60 * time.Minute, false},
+	}
+	for _, step := range sequence {
+		tracker.observe("192.168.1.100", start.Add(step.offset), step.printing)
+	}
+
+	if ratio := tracker.ratio("192.168.1.100", start.Add(time.Hour)); ratio != 0.5 {
+		t.Errorf("ratio() = %v, expected 0.5", ratio)
+	}
+
+	// after another 30 idle minutes only last 10 printing minutes fall into the window
+	tracker.observe("192.168.1.100", start.Add(90*time.Minute), false)
+	if ratio := tracker.ratio("192.168.1.100", start.Add(90*time.Minute)); ratio != 10.0/60.0 {
+		t.Errorf("ratio() = %v, expected %v", ratio, 10.0/60.0)
+	}
+
+	if ratio := tracker.ratio("192.168.1.200", start); ratio != 0 {
+		t.Errorf("ratio() of unknown printer = %v, expected 0", ratio)
+	}
+}
@@ -0,0 +1,209 @@
+package udp
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricMetadata describes a well-known measurement sent by the printer
+type metricMetadata struct {
+	Help string
+	Unit string
+	Type prometheus.ValueType
+}
+
+var (
+	settings          Settings
+	measurementPrefix string
+	settingsMutex     sync.RWMutex
+
+	// metadata for measurements known from the firmware, keyed by measurement name without prefix
+	knownMetrics = map[string]metricMetadata{
+		"temp_noz":            {"Nozzle temperature.", "celsius", prometheus.GaugeValue},
+		"ttemp_noz":           {"Nozzle target temperature.", "celsius", prometheus.GaugeValue},
+		"temp_bed":            {"Bed temperature.", "celsius", prometheus.GaugeValue},
+		"ttemp_bed":           {"Bed target temperature.", "celsius", prometheus.GaugeValue},
+		"temp_ambient":        {"Ambient temperature.", "celsius", prometheus.GaugeValue},
+		"temp_brd":            {"Board temperature.", "celsius", prometheus.GaugeValue},
+		"temp_chamber":        {"Chamber temperature.", "celsius", prometheus.GaugeValue},
+		"temp_mcu":            {"MCU temperature.", "celsius", prometheus.GaugeValue},
+		"temp_hbr":            {"Heatbreak temperature.", "celsius", prometheus.GaugeValue},
+		"temp_psu":            {"Power supply temperature.", "celsius", prometheus.GaugeValue},
+		"temp_sandwich":       {"Sandwich board temperature.", "celsius", prometheus.GaugeValue},
+		"temp_splitter":       {"Splitter board temperature.", "celsius", prometheus.GaugeValue},
+		"chamber_temp":        {"Chamber temperature.", "celsius", prometheus.GaugeValue},
+		"chamber_ttemp":       {"Chamber target temperature.", "celsius", prometheus.GaugeValue},
+		"buddy_temp":          {"Buddy board temperature.", "celsius", prometheus.GaugeValue},
+		"bedlet_temp":         {"Temperature of a bed segment (bedlet).", "celsius", prometheus.GaugeValue},
+		"bedlet_target":       {"Target temperature of a bed segment (bedlet).", "celsius", prometheus.GaugeValue},
+		"bed_mcu_temp":        {"Modular bed MCU temperature.", "celsius", prometheus.GaugeValue},
+		"dwarf_mcu_temp":      {"Dwarf (toolhead board) MCU temperature.", "celsius", prometheus.GaugeValue},
+		"dwarf_board_temp":    {"Dwarf (toolhead board) temperature.", "celsius", prometheus.GaugeValue},
+		"curr_inp":            {"Input current.", "amperes", prometheus.GaugeValue},
+		"curr_nozz":           {"Nozzle heater current.", "amperes", prometheus.GaugeValue},
+		"bed_curr":            {"Bed heater current.", "amperes", prometheus.GaugeValue},
+		"bedlet_curr":         {"Current of a bed segment (bedlet).", "amperes", prometheus.GaugeValue},
+		"dwarf_heat_curr":     {"Dwarf (toolhead board) heater current.", "amperes", prometheus.GaugeValue},
+		"cur_mmu_imp":         {"MMU current.", "amperes", prometheus.GaugeValue},
+		"Sandwitch5VCurrent":  {"Sandwich board 5V rail current.", "amperes", prometheus.GaugeValue},
+		"splitter_5V_current": {"Splitter board 5V rail current.", "amperes", prometheus.GaugeValue},
+		"xlbuddy5VCurrent":    {"XL buddy board 5V rail current.", "amperes", prometheus.GaugeValue},
+		"volt_bed":            {"Bed heater voltage.", "volts", prometheus.GaugeValue},
+		"volt_nozz":           {"Nozzle heater voltage.", "volts", prometheus.GaugeValue},
+		"24VVoltage":          {"24V rail voltage.", "volts", prometheus.GaugeValue},
+		"5VVoltage":           {"5V rail voltage.", "volts", prometheus.GaugeValue},
+		"fan":                 {"Fan speed and PWM.", "", prometheus.GaugeValue},
+		"fan_speed":           {"Fan speed.", "", prometheus.GaugeValue},
+		"fan_hbr_speed":       {"Heatbreak fan speed.", "", prometheus.GaugeValue},
+		"xbe_fan":             {"XL toolhead fan speed and PWM.", "", prometheus.GaugeValue},
+		"print_fan_act":       {"Print fan actual speed.", "rpm", prometheus.GaugeValue},
+		"hbr_fan_act":         {"Heatbreak fan actual speed.", "rpm", prometheus.GaugeValue},
+		"hbr_fan_enc":         {"Heatbreak fan encoder reading.", "", prometheus.GaugeValue},
+		"cpu_usage":           {"CPU usage of the printer.", "percent", prometheus.GaugeValue},
+		"heap":                {"Heap usage of the printer.", "bytes", prometheus.GaugeValue},
+		"heap_free":           {"Free heap of the printer.", "bytes", prometheus.GaugeValue},
+		"heap_total":          {"Total heap of the printer.", "bytes", prometheus.GaugeValue},
+		"fsensor":             {"Filament sensor state.", "", prometheus.GaugeValue},
+		"fsensor_raw":         {"Raw filament sensor reading.", "", prometheus.GaugeValue},
+		"side_fsensor":        {"Side filament sensor state.", "", prometheus.GaugeValue},
+		"door_sensor":         {"Door sensor state.", "", prometheus.GaugeValue},
+		"loadcell":            {"Loadcell reading.", "", prometheus.GaugeValue},
+		"loadcell_value":      {"Loadcell value.", "", prometheus.GaugeValue},
+		"adj_z":               {"Z adjustment (live Z).", "millimeters", prometheus.GaugeValue},
+		"active_extruder":     {"Index of the active extruder.", "", prometheus.GaugeValue},
+		"eth_in":              {"Ethernet received traffic.", "bytes", prometheus.GaugeValue},
+		"eth_out":             {"Ethernet sent traffic.", "bytes", prometheus.GaugeValue},
+		"esp_in":              {"Wi-Fi (ESP) received traffic.", "bytes", prometheus.GaugeValue},
+		"esp_out":             {"Wi-Fi (ESP) sent traffic.", "bytes", prometheus.GaugeValue},
+		"fw_version":          {"Firmware version of the printer.", "", prometheus.GaugeValue},
+		"buddy_revision":      {"Buddy board revision.", "", prometheus.GaugeValue},
+		"buddy_bom":           {"Buddy board BOM identifier.", "", prometheus.GaugeValue},
+		"points_dropped":      {"Metric points dropped by the printer.", "", prometheus.CounterValue},
+		"cmdcnt":              {"Number of processed commands.", "", prometheus.CounterValue},
+		"modbus_reqfail":      {"Number of failed modbus requests.", "", prometheus.CounterValue},
+	}
+)
+
+// Settings holds the options used while processing udp metrics
+type Settings struct {
+	// Metadata enables curated metric types for known measurements, counters among them change type from gauge
+	Metadata bool
+	// TagRenames maps tag keys sent by printers to label names, tags not present keep their name
+	TagRenames map[string]string
+	// NormalizeNames appends unit suffix, e.g. _celsius, to names of metrics with known unit
+	NormalizeNames bool
+	// Materials maps filament types to metric values, merged over the default mapping
+	Materials map[string]float64
+	// ExtraLabels are static labels added to every printer metric, tags sent by the printer take precedence
+	ExtraLabels map[string]string
+	// MACAllowlist drops metrics of printers not listed, it takes precedence over MACBlocklist
+	MACAllowlist []string
+	// MACBlocklist drops metrics of listed printers
+	MACBlocklist []string
+	// SourceTimestamps exposes samples with the timestamp sent by the printer instead of scrape time
+	SourceTimestamps bool
+	// MaxClockSkew is the largest accepted difference of a source timestamp from the exporter time
+	MaxClockSkew time.Duration
+}
+
+// Configure sets the options used while processing udp metrics
+func Configure(s Settings) {
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+	settings = s
+}
+
+func getSettings() Settings {
+	settingsMutex.RLock()
+	defer settingsMutex.RUnlock()
+	return settings
+}
+
+// macAllowed returns false if metrics of the printer_mac are filtered out by the allowlist or blocklist
+func macAllowed(mac string) bool {
+	s := getSettings()
+	matches := func(listed string) bool {
+		return strings.EqualFold(listed, mac)
+	}
+
+	if len(s.MACAllowlist) > 0 {
+		return slices.ContainsFunc(s.MACAllowlist, matches)
+	}
+	return !slices.ContainsFunc(s.MACBlocklist, matches)
+}
+
+func setMetricPrefix(prefix string) {
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+	measurementPrefix = prefix
+}
+
+func metricPrefix() string {
+	settingsMutex.RLock()
+	defer settingsMutex.RUnlock()
+	return measurementPrefix
+}
+
+// unitPrefixes maps measurement name prefixes to units, measurements not matching any are looked up in knownMetrics
+var unitPrefixes = []struct {
+	prefix string
+	unit   string
+}{
+	{"temp_", "celsius"},
+	{"ttemp_", "celsius"},
+	{"curr_", "amperes"},
+	{"cur_", "amperes"},
+	{"volt_", "volts"},
+}
+
+// unitSuffixes are units appended to metric names when names are normalized
+var unitSuffixes = []string{"celsius", "amperes", "volts", "rpm"}
+
+// normalizeName appends unit suffix of the measurement to the metric name, unless it already ends with it
+func normalizeName(metricName string, measurement string) string {
+	name := strings.TrimPrefix(measurement, metricPrefix())
+
+	unit := knownMetrics[name].Unit
+	for _, p := range unitPrefixes {
+		if strings.HasPrefix(name, p.prefix) {
+			unit = p.unit
+			break
+		}
+	}
+
+	if !slices.Contains(unitSuffixes, unit) || strings.HasSuffix(metricName, "_"+unit) {
+		return metricName
+	}
+	return metricName + "_" + unit
+}
+
+// describeMetric returns help text and value type for the metric created from measurement and field
+func describeMetric(measurement string, field string) (string, prometheus.ValueType) {
+	name := strings.TrimPrefix(measurement, metricPrefix())
+	meta, ok := knownMetrics[name]
+	if !ok {
+		help := "Measurement " + name + " sent by the printer, not described by the exporter."
+		if field != "v" && field != "value" {
+			help = strings.TrimSuffix(help, ".") + " - " + field + "."
+		}
+		return help, prometheus.GaugeValue
+	}
+
+	help := meta.Help
+	if field != "v" && field != "value" {
+		help = strings.TrimSuffix(help, ".") + " - " + field + "."
+	}
+	if meta.Unit != "" {
+		help = help + " Unit: " + meta.Unit + "."
+	}
+
+	// curated types change some metrics from gauge to counter, which renames them in OpenMetrics, so they are opt-in
+	if !getSettings().Metadata {
+		return help, prometheus.GaugeValue
+	}
+	return help, meta.Type
+}
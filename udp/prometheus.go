@@ -1,48 +1,117 @@
 package udp
 
 import (
+	"maps"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog/log"
 )
 
+const (
+	// noMaterial is reported when no filament is loaded
+	noMaterial = -1.0
+	// unknownMaterial is reported for loaded filament missing in the material mapping, e.g. custom filament
+	unknownMaterial = -2.0
+)
+
+// defaultMaterials maps filament types sent by the printer to metric values
+var defaultMaterials = map[string]float64{
+	"PLA":  1,
+	"PETG": 2,
+	"ASA":  3,
+	"PC":   4,
+	"PVB":  5,
+	"ABS":  6,
+	"HIPS": 7,
+	"PP":   8,
+	"FLEX": 9,
+	"PA":   10,
+}
+
+// materialValue returns metric value of the filament type, configured materials take precedence over defaults
+func materialValue(material string) float64 {
+	if material == "---" {
+		return noMaterial
+	}
+	if value, ok := getSettings().Materials[material]; ok {
+		return value
+	}
+	if value, ok := defaultMaterials[material]; ok {
+		return value
+	}
+	return unknownMaterial
+}
+
+// defaultMaxClockSkew is used when Settings.MaxClockSkew is not set
+const defaultMaxClockSkew = 5 * time.Minute
+
 var (
-	lastPush = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "prusa_last_push_timestamp",
-			Help: "Last time the printer pushed metrics to the exporter.",
-		},
-		[]string{"printer_mac", "printer_address"},
-	)
+	lastPush = newMetricVec("prusa_last_push_timestamp", "Last time the printer pushed metrics to the exporter.",
+		prometheus.GaugeValue, []string{"printer_mac", "printer_address"})
 	udpRegistry *prometheus.Registry
 
+	// time of the last push per printer IP address
+	lastPushTimes = map[string]time.Time{}
+	lastPushMutex sync.RWMutex
+
 	registryMetrics = safeRegistryMetrics{
 		mu:      sync.Mutex{},
-		metrics: make(map[string]*prometheus.GaugeVec),
+		metrics: make(map[string]*metricVec),
 	}
 )
 
 type safeRegistryMetrics struct {
-	mu      sync.Mutex
-	metrics map[string]*prometheus.GaugeVec
-	labels  map[string][]string
+	mu           sync.Mutex
+	metrics      map[string]*metricVec
+	labels       map[string][]string
+	measurements map[string]string // metric name -> measurement it was created from
+}
+
+// LastPush returns time of the last metrics push from the printer with the given IP address
+func LastPush(ip string) (time.Time, bool) {
+	lastPushMutex.RLock()
+	defer lastPushMutex.RUnlock()
+	last, ok := lastPushTimes[ip]
+	return last, ok
+}
+
+// recordPush updates the last push timestamp of the printer
+func recordPush(mac, ip string, now time.Time) {
+	lastPush.set(float64(now.Unix()), mac, ip)
+
+	lastPushMutex.Lock()
+	lastPushTimes[ip] = now
+	lastPushMutex.Unlock()
+
+	recordMACAddress(mac, ip, now)
 }
 
 // Init initializes the Prometheus udp registry.
 func Init(udpMainRegistry *prometheus.Registry) {
 	udpRegistry = udpMainRegistry
 
-	udpRegistry.MustRegister(lastPush)
+	udpRegistry.MustRegister(lastPush, statsCollector{}, registrationErrors, filteredMessages, badTimestamps)
 	registryMetrics.mu.Lock()
-	registryMetrics.metrics = make(map[string]*prometheus.GaugeVec)
+	registryMetrics.metrics = make(map[string]*metricVec)
 	registryMetrics.labels = make(map[string][]string)
+	registryMetrics.measurements = make(map[string]string)
 	registryMetrics.metrics["last_push"] = lastPush
 	registryMetrics.mu.Unlock()
+
+	macMutex.Lock()
+	macAddresses = map[string]map[string]time.Time{}
+	macMutex.Unlock()
 }
 
 func registerMetric(point point) {
-	var metric *prometheus.GaugeVec
+	var metric *metricVec
+
+	mac := point.Tags["printer_mac"]
+	timestamp := sampleTimestamp(point.Timestamp, mac, time.Now())
+	point.Tags = addExtraLabels(renameTags(point.Tags, getSettings().TagRenames), getSettings().ExtraLabels)
 
 	for key, value := range point.Fields {
 		metricName := point.Measurement
@@ -51,45 +120,130 @@ func registerMetric(point point) {
 		if key != "v" && key != "value" {
 			metricName = metricName + "_" + key
 		}
+		if getSettings().NormalizeNames {
+			metricName = normalizeName(metricName, point.Measurement)
+		}
 
 		registryMetrics.mu.Lock()
 		if existingMetric, exists := registryMetrics.metrics[metricName]; exists {
+			if !sameLabels(registryMetrics.labels[metricName], point.Tags) {
+				// Prometheus does not allow one metric name with different label names, skip rather than misassign labels
+				log.Debug().Msgf("Skipping %s from %s, tag set %v differs from registered labels %v", metricName, mac, getLabels(point.Tags), registryMetrics.labels[metricName])
+				registryMetrics.mu.Unlock()
+				registrationErrors.WithLabelValues(mac).Inc()
+				continue
+			}
 			metric = existingMetric
 		} else {
 			// Create a new metric with the given point
-			metric = prometheus.NewGaugeVec(
-				prometheus.GaugeOpts{
-					Name: metricName,
-					Help: "Metric for " + metricName + " from " + point.Measurement,
-				},
-				tagLabels,
-			)
+			help, valueType := describeMetric(point.Measurement, key)
+			metric = newMetricVec(metricName, help, valueType, tagLabels)
 			if err := udpRegistry.Register(metric); err != nil {
 				log.Trace().Msgf("Metric already registered %s: %v", metricName, err) // not a neccessary and error
+				registrationErrors.WithLabelValues(mac).Inc()
 			}
 			registryMetrics.metrics[metricName] = metric
 			registryMetrics.labels[metricName] = tagLabels
+			registryMetrics.measurements[metricName] = point.Measurement
 		}
 
-		labels := []string{}
-
+		// values are looked up by registered label name, so tag order of the point does not matter
+		labels := make([]string, 0, len(registryMetrics.labels[metricName]))
 		for _, label := range registryMetrics.labels[metricName] {
 			labels = append(labels, point.Tags[label])
-
 		}
 
 		registryMetrics.mu.Unlock()
-		metric.WithLabelValues(labels...).Set(toFloat64(value))
+		metric.setWithTimestamp(toFloat64(value), timestamp, labels...)
 
 	}
 }
 
-func getLabels(tags map[string]string) []string {
-	labels := make([]string, 0, len(tags))
-	for key := range tags {
-		labels = append(labels, key)
+// sampleTimestamp returns the source timestamp of the sample if source timestamps are enabled. Timestamps
+// further from now than the allowed clock skew are replaced by zero time, so the sample gets scrape time.
+func sampleTimestamp(timestamp time.Time, mac string, now time.Time) time.Time {
+	s := getSettings()
+	if !s.SourceTimestamps || timestamp.IsZero() {
+		return time.Time{}
 	}
-	return labels
+
+	skew := s.MaxClockSkew
+	if skew <= 0 {
+		skew = defaultMaxClockSkew
+	}
+	if diff := timestamp.Sub(now); diff > skew || diff < -skew {
+		if skewWarningDue(mac, now) {
+			log.Warn().Msgf("Timestamp %s of printer %s is %s off the exporter time, using scrape time", timestamp.Format(time.RFC3339), mac, diff.Round(time.Second))
+		} else {
+			log.Debug().Msgf("Timestamp %s of printer %s is %s off the exporter time, using scrape time", timestamp.Format(time.RFC3339), mac, diff.Round(time.Second))
+		}
+		badTimestamps.WithLabelValues(mac).Inc()
+		return time.Time{}
+	}
+	return timestamp
+}
+
+// skewWarningInterval limits warnings about skewed timestamps to one per printer, every sample is counted
+const skewWarningInterval = time.Minute
+
+var (
+	skewWarnings     = map[string]time.Time{}
+	skewWarningMutex sync.Mutex
+)
+
+// skewWarningDue returns true if skewed timestamp of the printer was not logged as warning within the interval
+func skewWarningDue(mac string, now time.Time) bool {
+	skewWarningMutex.Lock()
+	defer skewWarningMutex.Unlock()
+	if last, ok := skewWarnings[mac]; ok && now.Sub(last) < skewWarningInterval {
+		return false
+	}
+	skewWarnings[mac] = now
+	return true
+}
+
+// sameLabels returns true if tags contain exactly the given label names
+func sameLabels(labels []string, tags map[string]string) bool {
+	if len(labels) != len(tags) {
+		return false
+	}
+	for _, label := range labels {
+		if _, ok := tags[label]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// renameTags returns tags with keys renamed according to renames
+func renameTags(tags map[string]string, renames map[string]string) map[string]string {
+	if len(renames) == 0 {
+		return tags
+	}
+	renamed := make(map[string]string, len(tags))
+	for key, value := range tags {
+		if name, ok := renames[key]; ok {
+			key = name
+		}
+		renamed[key] = value
+	}
+	return renamed
+}
+
+// addExtraLabels returns tags with extra labels added, so every metric gets the same extra label names.
+// Tags already present keep their value.
+func addExtraLabels(tags map[string]string, extra map[string]string) map[string]string {
+	if len(extra) == 0 {
+		return tags
+	}
+	merged := maps.Clone(extra)
+	maps.Copy(merged, tags)
+	return merged
+}
+
+// getLabels returns sorted tag keys, so label order does not depend on map iteration
+func getLabels(tags map[string]string) []string {
+	return slices.Sorted(maps.Keys(tags))
 }
 
 func toFloat64(value interface{}) float64 {
@@ -109,31 +263,7 @@ func toFloat64(value interface{}) float64 {
 		log.Warn().Msg("Received nil value, returning 0.0")
 		return 0.0
 	case string:
-		if v == "PLA" {
-			return 1.0
-		} else if v == "PETG" {
-			return 2.0
-		} else if v == "ASA" {
-			return 3.0
-		} else if v == "PC" {
-			return 4.0
-		} else if v == "PVB" {
-			return 5.0
-		} else if v == "ABS" {
-			return 6.0
-		} else if v == "HIPS" {
-			return 7.0
-		} else if v == "PP" {
-			return 8.0
-		} else if v == "FLEX" {
-			return 9.0
-		} else if v == "PA" {
-			return 10.0
-		} else if v == "---" {
-			return -1.0 // special case for "---" to indicate no loaded filament
-		} else {
-			return 0.0 // return for custom
-		}
+		return materialValue(v)
 	default:
 		log.Warn().Msgf("Unsupported type %T for value %v", value, value)
 		return 0.0
@@ -1,9 +1,12 @@
 package udp
 
 import (
+	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 func TestInit(t *testing.T) {
@@ -195,6 +198,28 @@ func TestGetLabels(t *testing.T) {
 	}
 }
 
+func TestMaterialValue(t *testing.T) {
+	Configure(Settings{Metadata: true, Materials: map[string]float64{"PLA-CF": 42, "PETG": 20}})
+	defer Configure(Settings{})
+
+	tests := []struct {
+		material string
+		expected float64
+	}{
+		{"PLA-CF", 42},
+		{"PETG", 20},
+		{"PLA", 1},
+		{"PA-GF", unknownMaterial},
+		{"---", noMaterial},
+	}
+
+	for _, tt := range tests {
+		if value := toFloat64(tt.material); value != tt.expected {
+			t.Errorf("toFloat64(%q) = %v, expected %v", tt.material, value, tt.expected)
+		}
+	}
+}
+
 func TestToFloat64(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -218,7 +243,7 @@ func TestToFloat64(t *testing.T) {
 		{"string FLEX", "FLEX", 9.0},
 		{"string PA", "PA", 10.0},
 		{"string ---", "---", -1.0},
-		{"string unknown", "UNKNOWN", 0.0},
+		{"string unknown", "UNKNOWN", unknownMaterial},
 		{"unsupported type", []int{1, 2, 3}, 0.0},
 	}
 
@@ -301,3 +326,299 @@ func BenchmarkToFloat64(b *testing.B) {
 		}
 	}
 }
+
+func TestRegisterMetricMetadata(t *testing.T) {
+	setMetricPrefix("prusa_")
+	defer setMetricPrefix("")
+	defer Configure(Settings{})
+
+	// help text is curated regardless of the flag, only counter types are opt-in
+	for _, metadata := range []bool{false, true} {
+		t.Run(fmt.Sprintf("metadata=%t", metadata), func(t *testing.T) {
+			testRegistry := prometheus.NewRegistry()
+			Init(testRegistry)
+			Configure(Settings{Metadata: metadata})
+
+			registerMetric(point{
+				Measurement: "prusa_temp_noz",
+				Tags:        map[string]string{"printer_mac": "ABC123"},
+				Fields:      map[string]interface{}{"v": 215.0},
+			})
+			registerMetric(point{
+				Measurement: "prusa_points_dropped",
+				Tags:        map[string]string{"printer_mac": "ABC123"},
+				Fields:      map[string]interface{}{"v": int64(3)},
+			})
+			registerMetric(point{
+				Measurement: "prusa_fan",
+				Tags:        map[string]string{"printer_mac": "ABC123"},
+				Fields:      map[string]interface{}{"rpm": int64(3000)},
+			})
+			registerMetric(point{
+				Measurement: "prusa_volt_bed",
+				Tags:        map[string]string{"printer_mac": "ABC123"},
+				Fields:      map[string]interface{}{"v": 24.1},
+			})
+			registerMetric(point{
+				Measurement: "prusa_unknown_measurement",
+				Tags:        map[string]string{"printer_mac": "ABC123"},
+				Fields:      map[string]interface{}{"v": 1.0},
+			})
+
+			metricFamilies, err := testRegistry.Gather()
+			if err != nil {
+				t.Fatalf("registry.Gather() error: %v", err)
+			}
+
+			counterType := dto.MetricType_GAUGE
+			if metadata {
+				counterType = dto.MetricType_COUNTER
+			}
+			expected := map[string]struct {
+				help       string
+				metricType dto.MetricType
+			}{
+				"prusa_temp_noz":            {"Nozzle temperature. Unit: celsius.", dto.MetricType_GAUGE},
+				"prusa_points_dropped":      {"Metric points dropped by the printer.", counterType},
+				"prusa_unknown_measurement": {"Measurement unknown_measurement sent by the printer, not described by the exporter.", dto.MetricType_GAUGE},
+				"prusa_fan_rpm":             {"Fan speed and PWM - rpm.", dto.MetricType_GAUGE},
+				"prusa_volt_bed":            {"Bed heater voltage. Unit: volts.", dto.MetricType_GAUGE},
+			}
+
+			for _, mf := range metricFamilies {
+				want, ok := expected[mf.GetName()]
+				if !ok {
+					continue
+				}
+				if mf.GetHelp() != want.help {
+					t.Errorf("%s help = %q, expected %q", mf.GetName(), mf.GetHelp(), want.help)
+				}
+				if mf.GetType() != want.metricType {
+					t.Errorf("%s type = %v, expected %v", mf.GetName(), mf.GetType(), want.metricType)
+				}
+				delete(expected, mf.GetName())
+			}
+
+			for name := range expected {
+				t.Errorf("metric %s was not gathered", name)
+			}
+		})
+	}
+}
+
+func TestRegisterMetricTagSetChange(t *testing.T) {
+	testRegistry := prometheus.NewRegistry()
+	Init(testRegistry)
+
+	registerMetric(point{
+		Measurement: "tagset_test",
+		Tags:        map[string]string{"printer_mac": "ABC123", "tool": "0"},
+		Fields:      map[string]interface{}{"v": 1.0},
+	})
+	// same measurement with different tag set must not overwrite the series registered above
+	registerMetric(point{
+		Measurement: "tagset_test",
+		Tags:        map[string]string{"printer_mac": "ABC123", "sensor": "0"},
+		Fields:      map[string]interface{}{"v": 2.0},
+	})
+
+	metricFamilies, err := testRegistry.Gather()
+	if err != nil {
+		t.Fatalf("registry.Gather() error: %v", err)
+	}
+
+	for _, mf := range metricFamilies {
+		if mf.GetName() != "tagset_test" {
+			continue
+		}
+		if len(mf.GetMetric()) != 1 {
+			t.Fatalf("tagset_test has %d series, expected 1", len(mf.GetMetric()))
+		}
+		metric := mf.GetMetric()[0]
+		if metric.GetGauge().GetValue() != 1.0 {
+			t.Errorf("tagset_test value = %v, expected 1.0", metric.GetGauge().GetValue())
+		}
+		for _, label := range metric.GetLabel() {
+			if label.GetName() == "tool" && label.GetValue() != "0" {
+				t.Errorf("tool label = %q, expected 0", label.GetValue())
+			}
+		}
+		return
+	}
+	t.Error("tagset_test was not gathered")
+}
+
+func TestRegisterMetricLabelOrder(t *testing.T) {
+	testRegistry := prometheus.NewRegistry()
+	Init(testRegistry)
+
+	points := []map[string]string{
+		{"tool": "0", "printer_mac": "ABC123", "printer_address": "192.168.1.100"},
+		{"printer_address": "192.168.1.101", "tool": "1", "printer_mac": "DEF456"},
+		{"printer_address": "192.168.1.102", "printer_mac": "GHI789"}, // missing tool, skipped
+	}
+	for _, tags := range points {
+		registerMetric(point{Measurement: "order_test", Tags: tags, Fields: map[string]interface{}{"v": 1.5}})
+	}
+
+	registryMetrics.mu.Lock()
+	registered := registryMetrics.labels["order_test"]
+	registryMetrics.mu.Unlock()
+	if expected := []string{"printer_address", "printer_mac", "tool"}; !reflect.DeepEqual(registered, expected) {
+		t.Errorf("registered labels = %v, expected %v", registered, expected)
+	}
+
+	metricFamilies, err := testRegistry.Gather()
+	if err != nil {
+		t.Fatalf("registry.Gather() error: %v", err)
+	}
+
+	for _, mf := range metricFamilies {
+		if mf.GetName() != "order_test" {
+			continue
+		}
+		if len(mf.GetMetric()) != 2 {
+			t.Fatalf("order_test has %d series, expected 2", len(mf.GetMetric()))
+		}
+		for _, metric := range mf.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if !reflect.DeepEqual(labels, points[0]) && !reflect.DeepEqual(labels, points[1]) {
+				t.Errorf("order_test labels = %v, expected one of %v and %v", labels, points[0], points[1])
+			}
+		}
+		return
+	}
+	t.Error("order_test was not gathered")
+}
+
+func TestRegisterMetricNormalizeNames(t *testing.T) {
+	tests := []struct {
+		name        string
+		normalize   bool
+		measurement string
+		field       string
+		expected    string
+	}{
+		{"Temperature", true, "prusa_temp_noz", "v", "prusa_temp_noz_celsius"},
+		{"Current", true, "prusa_curr_inp", "v", "prusa_curr_inp_amperes"},
+		{"Voltage", true, "prusa_volt_bed", "v", "prusa_volt_bed_volts"},
+		{"Known unit", true, "prusa_print_fan_act", "v", "prusa_print_fan_act_rpm"},
+		{"Unknown unit", true, "prusa_cpu_usage", "v", "prusa_cpu_usage"},
+		{"Field", true, "prusa_temp_brd", "raw", "prusa_temp_brd_raw_celsius"},
+		{"Disabled", false, "prusa_temp_bed", "v", "prusa_temp_bed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testRegistry := prometheus.NewRegistry()
+			Init(testRegistry)
+			setMetricPrefix("prusa_")
+			defer setMetricPrefix("")
+			Configure(Settings{Metadata: true, NormalizeNames: tt.normalize})
+			defer Configure(Settings{})
+
+			registerMetric(point{
+				Measurement: tt.measurement,
+				Tags:        map[string]string{"printer_mac": "ABC123"},
+				Fields:      map[string]interface{}{tt.field: 1.0},
+			})
+
+			metricFamilies, err := testRegistry.Gather()
+			if err != nil {
+				t.Fatalf("registry.Gather() error: %v", err)
+			}
+			for _, mf := range metricFamilies {
+				if mf.GetName() == tt.expected {
+					return
+				}
+			}
+			t.Errorf("%s with field %s was not gathered as %s", tt.measurement, tt.field, tt.expected)
+		})
+	}
+}
+
+func TestRegisterMetricExtraLabels(t *testing.T) {
+	testRegistry := prometheus.NewRegistry()
+	Init(testRegistry)
+
+	Configure(Settings{Metadata: true, ExtraLabels: map[string]string{"site": "garage", "tool": "static"}})
+	defer Configure(Settings{})
+
+	registerMetric(point{
+		Measurement: "extra_labels_test",
+		Tags:        map[string]string{"printer_mac": "ABC123", "tool": "0"},
+		Fields:      map[string]interface{}{"v": 1.0},
+	})
+	registerMetric(point{
+		Measurement: "extra_labels_test",
+		Tags:        map[string]string{"printer_mac": "DEF456"},
+		Fields:      map[string]interface{}{"v": 2.0},
+	})
+
+	metricFamilies, err := testRegistry.Gather()
+	if err != nil {
+		t.Fatalf("registry.Gather() error: %v", err)
+	}
+
+	expected := map[string]map[string]string{
+		"ABC123": {"printer_mac": "ABC123", "site": "garage", "tool": "0"},
+		"DEF456": {"printer_mac": "DEF456", "site": "garage", "tool": "static"},
+	}
+	for _, mf := range metricFamilies {
+		if mf.GetName() != "extra_labels_test" {
+			continue
+		}
+		if len(mf.GetMetric()) != len(expected) {
+			t.Fatalf("extra_labels_test has %d series, expected %d", len(mf.GetMetric()), len(expected))
+		}
+		for _, metric := range mf.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if !reflect.DeepEqual(labels, expected[labels["printer_mac"]]) {
+				t.Errorf("extra_labels_test labels = %v, expected %v", labels, expected[labels["printer_mac"]])
+			}
+		}
+		return
+	}
+	t.Error("extra_labels_test was not gathered")
+}
+
+func TestRegisterMetricTagRenames(t *testing.T) {
+	testRegistry := prometheus.NewRegistry()
+	Init(testRegistry)
+
+	Configure(Settings{Metadata: true, TagRenames: map[string]string{"printer_mac": "mac", "printer_address": "instance"}})
+	defer Configure(Settings{})
+
+	registerMetric(point{
+		Measurement: "rename_test",
+		Tags:        map[string]string{"printer_mac": "ABC123", "printer_address": "192.168.1.100", "tool": "0"},
+		Fields:      map[string]interface{}{"v": 1.0},
+	})
+
+	metricFamilies, err := testRegistry.Gather()
+	if err != nil {
+		t.Fatalf("registry.Gather() error: %v", err)
+	}
+
+	for _, mf := range metricFamilies {
+		if mf.GetName() != "rename_test" {
+			continue
+		}
+		labels := map[string]string{}
+		for _, label := range mf.GetMetric()[0].GetLabel() {
+			labels[label.GetName()] = label.GetValue()
+		}
+		expected := map[string]string{"mac": "ABC123", "instance": "192.168.1.100", "tool": "0"}
+		if !reflect.DeepEqual(labels, expected) {
+			t.Errorf("rename_test labels = %v, expected %v", labels, expected)
+		}
+		return
+	}
+	t.Error("rename_test was not gathered")
+}
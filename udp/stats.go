@@ -0,0 +1,126 @@
+package udp
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+)
+
+// macCollisionWindow is how long the client address is remembered for the printer_mac collision detection
+const macCollisionWindow = 5 * time.Minute
+
+var (
+	seriesPerMeasurement = prometheus.NewDesc("prusa_udp_series_per_measurement",
+		"Number of active udp series per measurement.", []string{"measurement"}, nil)
+
+	registrationErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prusa_udp_registration_errors_total",
+			Help: "Number of udp metrics that failed to register and are silently missing, e.g. because of inconsistent tag sets.",
+		},
+		[]string{"printer_mac"},
+	)
+
+	filteredMessages = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prusa_udp_filtered_total",
+			Help: "Number of udp messages dropped because printer_mac is not in the allowlist or is in the blocklist.",
+		},
+		[]string{"printer_mac"},
+	)
+
+	badTimestamps = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prusa_udp_bad_timestamp_total",
+			Help: "Number of udp samples whose timestamp was too far from the exporter time and was replaced by scrape time.",
+		},
+		[]string{"printer_mac"},
+	)
+
+	macCollision = prometheus.NewDesc("prusa_udp_mac_collision",
+		"Returns 1 if metrics with the same printer_mac arrived from several addresses within 5 minutes, their metrics are merged.",
+		[]string{"printer_mac", "printer_addresses"}, nil)
+
+	// client addresses and time they were last seen per printer_mac
+	macAddresses = map[string]map[string]time.Time{}
+	macMutex     sync.Mutex
+)
+
+// recordMACAddress remembers the client address of the printer_mac and warns when another address
+// used the same printer_mac recently
+func recordMACAddress(mac, ip string, now time.Time) {
+	macMutex.Lock()
+	defer macMutex.Unlock()
+
+	addresses, ok := macAddresses[mac]
+	if !ok {
+		addresses = map[string]time.Time{}
+		macAddresses[mac] = addresses
+	}
+
+	_, known := addresses[ip]
+	addresses[ip] = now
+	if known {
+		return
+	}
+
+	for address, seen := range addresses {
+		if address != ip && now.Sub(seen) <= macCollisionWindow {
+			log.Warn().Msgf("Printer mac %s pushes metrics from %s and %s, metrics of both printers are merged", mac, address, ip)
+			return
+		}
+	}
+}
+
+// macCollisions returns sorted addresses per printer_mac seen from more than one address within the collision window
+func macCollisions(now time.Time) map[string][]string {
+	macMutex.Lock()
+	defer macMutex.Unlock()
+
+	collisions := map[string][]string{}
+	for mac, addresses := range macAddresses {
+		maps.DeleteFunc(addresses, func(_ string, seen time.Time) bool {
+			return now.Sub(seen) > macCollisionWindow
+		})
+		if len(addresses) > 1 {
+			collisions[mac] = slices.Sorted(maps.Keys(addresses))
+		}
+	}
+	return collisions
+}
+
+// statsCollector exposes metrics about the udp metrics themselves, computed from registryMetrics at scrape time
+type statsCollector struct{}
+
+// Describe implements prometheus.Collector
+func (statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- seriesPerMeasurement
+	ch <- macCollision
+}
+
+// Collect implements prometheus.Collector
+func (statsCollector) Collect(ch chan<- prometheus.Metric) {
+	prefix := metricPrefix()
+	counts := map[string]int{}
+
+	registryMetrics.mu.Lock()
+	for metricName, measurement := range registryMetrics.measurements {
+		if metric, ok := registryMetrics.metrics[metricName]; ok {
+			counts[strings.TrimPrefix(measurement, prefix)] += metric.seriesCount()
+		}
+	}
+	registryMetrics.mu.Unlock()
+
+	for measurement, count := range counts {
+		ch <- prometheus.MustNewConstMetric(seriesPerMeasurement, prometheus.GaugeValue, float64(count), measurement)
+	}
+
+	for mac, addresses := range macCollisions(time.Now()) {
+		ch <- prometheus.MustNewConstMetric(macCollision, prometheus.GaugeValue, 1, mac, strings.Join(addresses, ","))
+	}
+}
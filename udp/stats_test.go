@@ -0,0 +1,231 @@
+package udp
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gopkg.in/mcuadros/go-syslog.v2/format"
+)
+
+func TestSeriesPerMeasurement(t *testing.T) {
+	testRegistry := prometheus.NewRegistry()
+	Init(testRegistry)
+	setMetricPrefix("prusa_")
+	defer setMetricPrefix("")
+
+	points := []point{
+		{Measurement: "prusa_temp_noz", Tags: map[string]string{"printer_mac": "AAA"}, Fields: map[string]interface{}{"v": 215.0}},
+		{Measurement: "prusa_temp_noz", Tags: map[string]string{"printer_mac": "BBB"}, Fields: map[string]interface{}{"v": 210.0}},
+		{Measurement: "prusa_temp_noz", Tags: map[string]string{"printer_mac": "BBB"}, Fields: map[string]interface{}{"v": 211.0}},
+		{Measurement: "prusa_fan", Tags: map[string]string{"printer_mac": "AAA"}, Fields: map[string]interface{}{"rpm": int64(1500), "pwm": int64(80)}},
+	}
+	for _, p := range points {
+		registerMetric(p)
+	}
+
+	families, err := testRegistry.Gather()
+	if err != nil {
+		t.Fatalf("registry.Gather() error: %v", err)
+	}
+
+	expected := map[string]float64{"temp_noz": 2, "fan": 2}
+	found := map[string]float64{}
+	for _, family := range families {
+		if family.GetName() != "prusa_udp_series_per_measurement" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			found[metric.GetLabel()[0].GetValue()] = metric.GetGauge().GetValue()
+		}
+	}
+
+	for measurement, count := range expected {
+		if found[measurement] != count {
+			t.Errorf("series for %s = %v, expected %v", measurement, found[measurement], count)
+		}
+	}
+}
+
+func TestRegistrationErrors(t *testing.T) {
+	testRegistry := prometheus.NewRegistry()
+	Init(testRegistry)
+
+	before := testutil.ToFloat64(registrationErrors.WithLabelValues("CONFLICT"))
+
+	// metric with the same name as already registered last push metric, but different labels
+	registerMetric(point{
+		Measurement: "prusa_last_push_timestamp",
+		Tags:        map[string]string{"printer_mac": "CONFLICT", "extra": "tag"},
+		Fields:      map[string]interface{}{"v": 1.0},
+	})
+
+	after := testutil.ToFloat64(registrationErrors.WithLabelValues("CONFLICT"))
+	if after-before != 1 {
+		t.Errorf("registration errors increased by %v, expected 1", after-before)
+	}
+}
+
+func TestMACCollision(t *testing.T) {
+	testRegistry := prometheus.NewRegistry()
+	Init(testRegistry)
+
+	now := time.Now()
+	recordPush("COLLIDING", "10.0.0.2", now)
+	recordPush("COLLIDING", "10.0.0.1", now)
+	recordPush("SINGLE", "10.0.0.3", now)
+	recordPush("SINGLE", "10.0.0.3", now)
+	// printer changed its address long ago
+	recordPush("MOVED", "10.0.0.4", now.Add(-time.Hour))
+	recordPush("MOVED", "10.0.0.5", now)
+
+	families, err := testRegistry.Gather()
+	if err != nil {
+		t.Fatalf("registry.Gather() error: %v", err)
+	}
+
+	found := map[string]string{}
+	for _, family := range families {
+		if family.GetName() != "prusa_udp_mac_collision" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if metric.GetGauge().GetValue() != 1 {
+				t.Errorf("prusa_udp_mac_collision of %s = %v, expected 1", labels["printer_mac"], metric.GetGauge().GetValue())
+			}
+			found[labels["printer_mac"]] = labels["printer_addresses"]
+		}
+	}
+
+	if len(found) != 1 || found["COLLIDING"] != "10.0.0.1,10.0.0.2" {
+		t.Errorf("collisions = %v, expected COLLIDING from 10.0.0.1,10.0.0.2", found)
+	}
+}
+
+func TestMACFilter(t *testing.T) {
+	testRegistry := prometheus.NewRegistry()
+	Init(testRegistry)
+	defer Configure(Settings{})
+
+	push := func(mac, ip string) {
+		process(format.LogParts{
+			"hostname": mac,
+			"client":   ip + ":5000",
+			"message":  "msg=1,tm=1 temp_noz v=215.5 1000",
+		}, "prusa_")
+	}
+
+	tests := []struct {
+		name     string
+		settings Settings
+		mac      string
+		ip       string
+		allowed  bool
+	}{
+		{"Blocked", Settings{Metadata: true, MACBlocklist: []string{"BLOCKED"}}, "blocked", "10.0.1.1", false},
+		{"Not blocked", Settings{Metadata: true, MACBlocklist: []string{"BLOCKED"}}, "OTHER", "10.0.1.2", true},
+		{"Allowed", Settings{Metadata: true, MACAllowlist: []string{"ALLOWED"}}, "ALLOWED", "10.0.1.3", true},
+		{"Not allowed", Settings{Metadata: true, MACAllowlist: []string{"ALLOWED"}}, "UNLISTED", "10.0.1.4", false},
+		{"Allowlist precedence", Settings{Metadata: true, MACAllowlist: []string{"BOTH"}, MACBlocklist: []string{"BOTH"}}, "BOTH", "10.0.1.5", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Configure(tt.settings)
+			before := testutil.ToFloat64(filteredMessages.WithLabelValues(tt.mac))
+
+			push(tt.mac, tt.ip)
+
+			filtered := testutil.ToFloat64(filteredMessages.WithLabelValues(tt.mac)) - before
+			_, pushed := LastPush(tt.ip)
+			if tt.allowed && (filtered != 0 || !pushed) {
+				t.Errorf("metrics of %s dropped (filtered %v, pushed %t), expected them accepted", tt.mac, filtered, pushed)
+			}
+			if !tt.allowed && (filtered != 1 || pushed) {
+				t.Errorf("metrics of %s accepted (filtered %v, pushed %t), expected them dropped", tt.mac, filtered, pushed)
+			}
+		})
+	}
+}
+
+func TestBadTimestamp(t *testing.T) {
+	testRegistry := prometheus.NewRegistry()
+	Init(testRegistry)
+	Configure(Settings{Metadata: true, SourceTimestamps: true, MaxClockSkew: time.Minute})
+	defer Configure(Settings{})
+
+	now := time.Now()
+	// printer sends offset of the sample from tm in microseconds, tm counts from printer boot
+	push := func(mac string, timestamp time.Time) {
+		process(format.LogParts{
+			"hostname": mac,
+			"client":   "10.0.2.1:5000",
+			"message":  fmt.Sprintf("msg=1,tm=5000000 temp_noz v=215.5 %d", time.Until(timestamp).Microseconds()),
+		}, "prusa_")
+	}
+
+	tests := []struct {
+		name      string
+		mac       string
+		timestamp time.Time
+		bad       bool
+	}{
+		{"Far future", "FUTURE", now.Add(24 * time.Hour), true},
+		{"Far past", "PAST", now.Add(-24 * time.Hour), true},
+		{"Within skew", "SYNCED", now.Add(-10 * time.Second), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := testutil.ToFloat64(badTimestamps.WithLabelValues(tt.mac))
+			push(tt.mac, tt.timestamp)
+			if bad := testutil.ToFloat64(badTimestamps.WithLabelValues(tt.mac)) - before; (bad == 1) != tt.bad {
+				t.Errorf("prusa_udp_bad_timestamp_total of %s increased by %v, expected bad %t", tt.mac, bad, tt.bad)
+			}
+
+			families, err := testRegistry.Gather()
+			if err != nil {
+				t.Fatalf("Gather() error: %v", err)
+			}
+			for _, family := range families {
+				if family.GetName() != "prusa_temp_noz" {
+					continue
+				}
+				for _, metric := range family.GetMetric() {
+					for _, label := range metric.GetLabel() {
+						if label.GetName() != "printer_mac" || label.GetValue() != tt.mac {
+							continue
+						}
+						if tt.bad && metric.TimestampMs != nil {
+							t.Errorf("sample of %s has timestamp %d, expected scrape time", tt.mac, metric.GetTimestampMs())
+						}
+						if diff := metric.GetTimestampMs() - tt.timestamp.UnixMilli(); !tt.bad && (diff < -100 || diff > 100) {
+							t.Errorf("sample of %s has timestamp %d, expected %d", tt.mac, metric.GetTimestampMs(), tt.timestamp.UnixMilli())
+						}
+						return
+					}
+				}
+			}
+			t.Errorf("sample of %s not found", tt.mac)
+		})
+	}
+}
+
+func TestSkewWarningDue(t *testing.T) {
+	now := time.Now()
+	if !skewWarningDue("RATELIMITED", now) {
+		t.Error("skewWarningDue() = false for first skewed timestamp, expected true")
+	}
+	if skewWarningDue("RATELIMITED", now.Add(time.Second)) {
+		t.Error("skewWarningDue() = true within the interval, expected false")
+	}
+	if !skewWarningDue("RATELIMITED", now.Add(skewWarningInterval)) {
+		t.Error("skewWarningDue() = false after the interval, expected true")
+	}
+}
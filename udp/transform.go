@@ -1,7 +1,10 @@
 package udp
 
 import (
+	"compress/gzip"
 	"fmt"
+	"io"
+	"net"
 	"strconv"
 	"strings"
 	"time"
@@ -14,6 +17,7 @@ type point struct {
 	Measurement string
 	Tags        map[string]string
 	Fields      map[string]interface{} // Use interface{} to handle different field types
+	Timestamp   time.Time              // zero if the line has no timestamp, absolute after processMessage
 }
 
 func process(data format.LogParts, prefix string) {
@@ -22,7 +26,14 @@ func process(data format.LogParts, prefix string) {
 		log.Error().Msg(fmt.Sprintf("Error processing identifiers: %v", err))
 		return
 	}
-	lastPush.WithLabelValues(mac, strings.Split(ip, ":")[0]).Set(float64(time.Now().Unix())) // Set the last push timestamp
+
+	if !macAllowed(mac) {
+		log.Trace().Msg("Dropping metrics of filtered printer " + mac)
+		filteredMessages.WithLabelValues(mac).Inc()
+		return
+	}
+
+	recordPush(mac, clientHost(ip), time.Now()) // Set the last push timestamp
 
 	log.Debug().Msg(fmt.Sprintf("Processing data for printer %s", mac))
 	metrics, err := processMessage(data["message"].(string), mac, prefix, ip)
@@ -58,13 +69,48 @@ func processIdentifiers(data format.LogParts) (string, string, error) {
 	return mac, ip, nil
 }
 
+// gzipMagic prefixes messages compressed by the printer
+const gzipMagic = "\x1f\x8b"
+
+// maxDecompressedSize limits size of decompressed message, so a small message can not exhaust memory
+const maxDecompressedSize = 1 << 20
+
+// decompressMessage returns the message decompressed if it is gzip compressed, other messages are returned unchanged
+func decompressMessage(message string) (string, error) {
+	if !strings.HasPrefix(message, gzipMagic) {
+		return message, nil
+	}
+
+	reader, err := gzip.NewReader(strings.NewReader(message))
+	if err != nil {
+		return "", fmt.Errorf("error decompressing message: %w", err)
+	}
+	defer reader.Close()
+
+	decompressed, err := io.ReadAll(io.LimitReader(reader, maxDecompressedSize+1))
+	if err != nil {
+		return "", fmt.Errorf("error decompressing message: %w", err)
+	}
+	if len(decompressed) > maxDecompressedSize {
+		return "", fmt.Errorf("decompressed message exceeds %d bytes", maxDecompressedSize)
+	}
+	return string(decompressed), nil
+}
+
 func processMessage(message string, mac string, prefix string, ip string) ([]string, error) {
+	message, err := decompressMessage(message)
+	if err != nil {
+		return nil, err
+	}
+
+	received := time.Now()
 	messageSplit := strings.Split(message, "\n")
 
 	if len(messageSplit) == 0 {
 		return nil, fmt.Errorf("message is empty")
 	}
 
+	tm, hasTime := headerTime(strings.SplitN(messageSplit[0], " ", 2)[0])
 	firstMessage, err := parseFirstMessage(messageSplit[0])
 
 	if err != nil {
@@ -80,11 +126,45 @@ func processMessage(message string, mac string, prefix string, ip string) ([]str
 			log.Error().Msg("Expected error while adding mac label for metric: " + splitted[0] + " error:" + err.Error())
 			continue
 		}
-		messageSplit[i] = strings.Join(splitted, " ")
+		messageSplit[i] = sampleTime(strings.Join(splitted, " "), tm, hasTime, received)
 	}
 	return messageSplit, nil
 }
 
+// headerTime returns printer time in microseconds from tm of the message header, e.g. msg=1,tm=5000000,v=4
+func headerTime(header string) (int64, bool) {
+	for _, field := range strings.Split(header, ",") {
+		if value, ok := strings.CutPrefix(field, "tm="); ok {
+			tm, err := strconv.ParseInt(value, 10, 64)
+			return tm, err == nil
+		}
+	}
+	return 0, false
+}
+
+// sampleTime replaces the trailing number of the line, offset in microseconds from tm of the message header,
+// with absolute timestamp in Unix nanoseconds. Printer clock counts from boot, so printer time tm + offset is
+// converted to the exporter clock by the difference of tm and time the message was received. Lines of messages
+// without tm lose the timestamp and get scrape time.
+func sampleTime(line string, tm int64, hasTime bool, received time.Time) string {
+	parts := splitLine(line)
+	if len(parts) != 3 {
+		return line
+	}
+	offset, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return line
+	}
+
+	withoutTime := strings.TrimSuffix(strings.TrimRight(line, " "), parts[2])
+	if !hasTime {
+		return strings.TrimRight(withoutTime, " ")
+	}
+	clockOffset := received.Sub(time.UnixMicro(tm))
+	timestamp := time.UnixMicro(tm + offset).Add(clockOffset)
+	return withoutTime + strconv.FormatInt(timestamp.UnixNano(), 10)
+}
+
 func parseFirstMessage(message string) (string, error) {
 	splitted := strings.Split(message, " ")
 	if len(splitted) == 0 {
@@ -99,10 +179,38 @@ func updateMetric(splitted []string, prefix string, mac string, ip string) ([]st
 		return nil, fmt.Errorf("splitted message is empty")
 	}
 
-	splitted[0] = fmt.Sprintf("%s%s,printer_mac=%s,printer_address=%s", prefix, splitted[0], mac, strings.Split(ip, ":")[0])
+	measurementTags := prefix + splitted[0]
+	existing := tagKeys(splitted[0])
+	if !existing["printer_mac"] {
+		measurementTags += ",printer_mac=" + mac
+	}
+	if !existing["printer_address"] {
+		measurementTags += ",printer_address=" + clientHost(ip)
+	}
+
+	splitted[0] = measurementTags
 	return splitted, nil
 }
 
+// tagKeys returns unescaped keys of tags in the measurement and tags part of the line
+func tagKeys(measurementTags string) map[string]bool {
+	keys := map[string]bool{}
+	for _, tag := range splitEscaped(measurementTags, ',', 0, false)[1:] {
+		key := splitEscaped(tag, '=', 2, false)[0]
+		keys[unescapeLineProtocol(key)] = true
+	}
+	return keys
+}
+
+// clientHost strips the port from the client address, IPv6 addresses are returned without brackets
+func clientHost(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	return host
+}
+
 func newPoint() *point {
 	return &point{
 		Tags:   make(map[string]string),
@@ -119,26 +227,30 @@ func parseLineProtocol(line string) (*point, error) {
 	}
 
 	measurementTags := parts[0]
-	measurementTagParts := strings.Split(measurementTags, ",")
-	p.Measurement = measurementTagParts[0]
+	measurementTagParts := splitEscaped(measurementTags, ',', 0, false)
+	p.Measurement = unescapeLineProtocol(measurementTagParts[0])
 
 	for i := 1; i < len(measurementTagParts); i++ {
 		tag := measurementTagParts[i]
-		tagParts := strings.SplitN(tag, "=", 2)
+		tagParts := splitEscaped(tag, '=', 2, false)
 		if len(tagParts) != 2 {
 			return nil, fmt.Errorf("invalid tag format: %s", tag)
 		}
-		p.Tags[tagParts[0]] = tagParts[1]
+		key := unescapeLineProtocol(tagParts[0])
+		if _, duplicate := p.Tags[key]; duplicate {
+			continue // first occurrence wins, tags of the printer precede tags added by the exporter
+		}
+		p.Tags[key] = unescapeLineProtocol(tagParts[1])
 	}
 
 	fieldStr := parts[1]
-	fieldParts := strings.Split(fieldStr, ",")
+	fieldParts := splitEscaped(fieldStr, ',', 0, true)
 	for _, field := range fieldParts {
-		kv := strings.SplitN(field, "=", 2)
+		kv := splitEscaped(field, '=', 2, true)
 		if len(kv) != 2 {
 			return nil, fmt.Errorf("invalid field format: %s", field)
 		}
-		key := kv[0]
+		key := unescapeLineProtocol(kv[0])
 		val := kv[1]
 
 		// parsing metrics as different data types
@@ -169,9 +281,42 @@ func parseLineProtocol(line string) (*point, error) {
 		p.Fields[key] = val
 	}
 
+	if len(parts) == 3 {
+		if nanoseconds, err := strconv.ParseInt(parts[2], 10, 64); err == nil {
+			p.Timestamp = time.Unix(0, nanoseconds)
+		}
+	}
+
 	return p, nil
 }
 
+// lineProtocolUnescaper replaces characters escaped in measurement, tag keys, tag values and field keys
+var lineProtocolUnescaper = strings.NewReplacer(`\,`, ",", `\=`, "=", `\ `, " ")
+
+func unescapeLineProtocol(s string) string {
+	return lineProtocolUnescaper.Replace(s)
+}
+
+// splitEscaped splits s on sep that is not escaped with backslash, or inside double quotes when quotes is set.
+// At most n parts are returned when n is greater than 0. Parts are returned still escaped.
+func splitEscaped(s string, sep byte, n int, quotes bool) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++ // just skip the next character
+		case s[i] == '"' && quotes:
+			quoted = !quoted
+		case s[i] == sep && !quoted && (n <= 0 || len(parts) < n-1):
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
 func splitLine(s string) []string {
 	r := []string{}
 
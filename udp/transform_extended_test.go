@@ -1,8 +1,12 @@
 package udp
 
 import (
+	"bytes"
+	"compress/gzip"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewPoint(t *testing.T) {
@@ -96,6 +100,86 @@ func TestParseLineProtocol(t *testing.T) {
 			},
 			expectError: false,
 		},
+		{
+			name:  "Escaped comma and space in tag value",
+			input: `job,printer_mac=ABC123,job_name=benchy\,\ 0.2mm v=1.5 1234567890`,
+			expected: &point{
+				Measurement: "job",
+				Tags:        map[string]string{"printer_mac": "ABC123", "job_name": "benchy, 0.2mm"},
+				Fields:      map[string]interface{}{"v": 1.5},
+			},
+			expectError: false,
+		},
+		{
+			name:  "Escaped equals sign in tag key and value",
+			input: `job,printer_mac=ABC123,a\=b=x\=y v=1.5 1234567890`,
+			expected: &point{
+				Measurement: "job",
+				Tags:        map[string]string{"printer_mac": "ABC123", "a=b": "x=y"},
+				Fields:      map[string]interface{}{"v": 1.5},
+			},
+			expectError: false,
+		},
+		{
+			name:  "Escaped characters in field key",
+			input: `fan,printer_mac=ABC123 print\ fan\,rpm=1500i,pwm\=raw=80i 1234567890`,
+			expected: &point{
+				Measurement: "fan",
+				Tags:        map[string]string{"printer_mac": "ABC123"},
+				Fields:      map[string]interface{}{"print fan,rpm": int64(1500), "pwm=raw": int64(80)},
+			},
+			expectError: false,
+		},
+		{
+			name:  "Comma inside quoted string field",
+			input: `job,printer_mac=ABC123 name="benchy, small",v=1.5 1234567890`,
+			expected: &point{
+				Measurement: "job",
+				Tags:        map[string]string{"printer_mac": "ABC123"},
+				Fields:      map[string]interface{}{"name": "benchy, small", "v": 1.5},
+			},
+			expectError: false,
+		},
+		{
+			name:  "Negative integer field",
+			input: "position,printer_mac=ABC123 z=-5i 1234567890",
+			expected: &point{
+				Measurement: "position",
+				Tags:        map[string]string{"printer_mac": "ABC123"},
+				Fields:      map[string]interface{}{"z": int64(-5)},
+			},
+			expectError: false,
+		},
+		{
+			name:  "Negative float field",
+			input: "current,printer_mac=ABC123 v=-0.12 1234567890",
+			expected: &point{
+				Measurement: "current",
+				Tags:        map[string]string{"printer_mac": "ABC123"},
+				Fields:      map[string]interface{}{"v": -0.12},
+			},
+			expectError: false,
+		},
+		{
+			name:  "Scientific notation float fields",
+			input: "voltage,printer_mac=ABC123 v=1.5e3,low=-2.5E-3 1234567890",
+			expected: &point{
+				Measurement: "voltage",
+				Tags:        map[string]string{"printer_mac": "ABC123"},
+				Fields:      map[string]interface{}{"v": 1500.0, "low": -0.0025},
+			},
+			expectError: false,
+		},
+		{
+			name:  "Duplicate tag keeps first occurrence",
+			input: "temp_noz,printer_address=printer.local,printer_mac=ABC123,printer_address=192.168.1.100 v=25.3 1234567890",
+			expected: &point{
+				Measurement: "temp_noz",
+				Tags:        map[string]string{"printer_mac": "ABC123", "printer_address": "printer.local"},
+				Fields:      map[string]interface{}{"v": 25.3},
+			},
+			expectError: false,
+		},
 		{
 			name:        "Invalid format - no fields",
 			input:       "temperature,sensor=nozzle",
@@ -215,6 +299,86 @@ fan_speed rpm=1500i 1637000000`,
 	}
 }
 
+func TestProcessMessageTimestamps(t *testing.T) {
+	before := time.Now()
+	result, err := processMessage("msg=1,tm=5000000,v=4 temp_noz v=215.5 -2000000\ntemp_bed v=60.5 -1000000\nfan v=1i", "ABC123", "prusa_", "192.168.1.100:8514")
+	after := time.Now()
+	if err != nil {
+		t.Fatalf("processMessage() error = %v", err)
+	}
+
+	offsets := map[string]time.Duration{"prusa_temp_noz": -2 * time.Second, "prusa_temp_bed": -time.Second}
+	for _, line := range result {
+		p, err := parseLineProtocol(line)
+		if err != nil {
+			t.Fatalf("parseLineProtocol(%q) error = %v", line, err)
+		}
+		offset, ok := offsets[p.Measurement]
+		if !ok {
+			if !p.Timestamp.IsZero() {
+				t.Errorf("%s has timestamp %s, expected none", p.Measurement, p.Timestamp)
+			}
+			continue
+		}
+		if p.Timestamp.Before(before.Add(offset)) || p.Timestamp.After(after.Add(offset)) {
+			t.Errorf("%s has timestamp %s, expected %s before reception", p.Measurement, p.Timestamp, -offset)
+		}
+	}
+
+	result, err = processMessage("msg=1 temp_noz v=215.5 1000", "ABC123", "prusa_", "192.168.1.100:8514")
+	if err != nil {
+		t.Fatalf("processMessage() error = %v", err)
+	}
+	if p, err := parseLineProtocol(result[0]); err != nil || !p.Timestamp.IsZero() {
+		t.Errorf("line of message without tm = %q, expected no timestamp", result[0])
+	}
+}
+
+func TestProcessMessageGzip(t *testing.T) {
+	message := `12345 temp_noz v=220.5 1637000000
+temp_bed v=60.0 1637000000
+fan_speed rpm=1500i 1637000000`
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte(message))
+	writer.Close()
+
+	result, err := processMessage(compressed.String(), "ABC123", "prusa_", "192.168.1.100:8514")
+	if err != nil {
+		t.Fatalf("processMessage() error = %v", err)
+	}
+
+	measurements := map[string]bool{}
+	for _, line := range result {
+		point, err := parseLineProtocol(line)
+		if err != nil {
+			t.Fatalf("parseLineProtocol(%q) error = %v", line, err)
+		}
+		if point.Tags["printer_mac"] != "ABC123" {
+			t.Errorf("measurement %s has printer_mac %q, expected ABC123", point.Measurement, point.Tags["printer_mac"])
+		}
+		measurements[point.Measurement] = true
+	}
+	expected := map[string]bool{"prusa_temp_noz": true, "prusa_temp_bed": true, "prusa_fan_speed": true}
+	if !reflect.DeepEqual(measurements, expected) {
+		t.Errorf("processMessage() of compressed message returned measurements %v, expected %v", measurements, expected)
+	}
+
+	if _, err := processMessage("\x1f\x8bcorrupted", "ABC123", "prusa_", "192.168.1.100:8514"); err == nil {
+		t.Error("processMessage() expected error for corrupted compressed message")
+	}
+
+	// decompression bomb is rejected
+	var bomb bytes.Buffer
+	writer = gzip.NewWriter(&bomb)
+	writer.Write(bytes.Repeat([]byte("0"), maxDecompressedSize+1))
+	writer.Close()
+	if _, err := processMessage(bomb.String(), "ABC123", "prusa_", "192.168.1.100:8514"); err == nil {
+		t.Errorf("processMessage() expected error for message decompressed over %d bytes", maxDecompressedSize)
+	}
+}
+
 func TestParseFirstMessage(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -296,6 +460,14 @@ func TestUpdateMetric(t *testing.T) {
 			ip:       "10.0.0.5:8514",
 			expected: "prusa_fan,type=print,printer_mac=DEF456,printer_address=10.0.0.5",
 		},
+		{
+			name:     "IPv6 client address",
+			splitted: []string{"temp_noz", "v=220.5", "1637000000"},
+			prefix:   "prusa_",
+			mac:      "ABC123",
+			ip:       "[fe80::1]:8514",
+			expected: "prusa_temp_noz,printer_mac=ABC123,printer_address=fe80::1",
+		},
 	}
 
 	for _, tt := range tests {
@@ -317,6 +489,25 @@ func TestUpdateMetric(t *testing.T) {
 		})
 	}
 
+	t.Run("Existing printer_address tag", func(t *testing.T) {
+		result, err := updateMetric([]string{"temp_noz,printer_address=printer.local", "v=220.5"}, "prusa_", "ABC123", "192.168.1.100:8514")
+		if err != nil {
+			t.Fatalf("updateMetric() error = %v", err)
+		}
+		expected := "prusa_temp_noz,printer_address=printer.local,printer_mac=ABC123"
+		if result[0] != expected {
+			t.Errorf("updateMetric() result[0] = %v, expected %v", result[0], expected)
+		}
+
+		p, err := parseLineProtocol(strings.Join(result, " "))
+		if err != nil {
+			t.Fatalf("parseLineProtocol() error = %v", err)
+		}
+		if labels := getLabels(p.Tags); !reflect.DeepEqual(labels, []string{"printer_address", "printer_mac"}) {
+			t.Errorf("getLabels() = %v, expected [printer_address printer_mac]", labels)
+		}
+	})
+
 	// Test error case
 	t.Run("Empty splitted message", func(t *testing.T) {
 		_, err := updateMetric([]string{}, "prusa_", "ABC123", "192.168.1.100:8514")
@@ -0,0 +1,79 @@
+package udp
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+)
+
+// metricVec is a settable vector of series sharing one descriptor. Unlike GaugeVec
+// it can be exposed as any value type, which lets absolute counters pushed by the
+// printer be reported as counters.
+type metricVec struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+
+	mu     sync.RWMutex
+	series map[string]series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	timestamp   time.Time // zero means scrape time
+}
+
+func newMetricVec(name string, help string, valueType prometheus.ValueType, labels []string) *metricVec {
+	return &metricVec{
+		desc:      prometheus.NewDesc(name, help, labels, nil),
+		valueType: valueType,
+		series:    make(map[string]series),
+	}
+}
+
+// set stores the value for the series identified by the label values
+func (m *metricVec) set(value float64, labelValues ...string) {
+	m.setWithTimestamp(value, time.Time{}, labelValues...)
+}
+
+// setWithTimestamp stores the value with its timestamp, zero timestamp exposes the value with scrape time
+func (m *metricVec) setWithTimestamp(value float64, timestamp time.Time, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+
+	m.mu.Lock()
+	m.series[key] = series{labelValues: labelValues, value: value, timestamp: timestamp}
+	m.mu.Unlock()
+}
+
+// seriesCount returns number of series in the vector
+func (m *metricVec) seriesCount() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.series)
+}
+
+// Describe implements prometheus.Collector
+func (m *metricVec) Describe(ch chan<- *prometheus.Desc) {
+	ch <- m.desc
+}
+
+// Collect implements prometheus.Collector
+func (m *metricVec) Collect(ch chan<- prometheus.Metric) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, s := range m.series {
+		metric, err := prometheus.NewConstMetric(m.desc, m.valueType, s.value, s.labelValues...)
+		if err != nil {
+			log.Debug().Msgf("Skipping invalid series of %s: %v", m.desc, err)
+			continue
+		}
+		if !s.timestamp.IsZero() {
+			metric = prometheus.NewMetricWithTimestamp(s.timestamp, metric)
+		}
+		ch <- metric
+	}
+}